@@ -0,0 +1,1793 @@
+package codegen
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"loon/session"
+	"loon/session/ty"
+	"loon/util"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+const luaIndent = "  "
+
+var luaKeywords = []string{"and", "break", "do", "else", "elseif", "end", "false", "for", "function", "goto", "if", "in",
+	"local", "nil", "not", "or", "repeat", "return", "then", "true", "until", "while"}
+
+// operator precedences in Lua, higher binds tighter
+const (
+	luaPrecOr      = 1
+	luaPrecAnd     = 2
+	luaPrecCmp     = 3
+	luaPrecBitOr   = 4
+	luaPrecBitXor  = 5
+	luaPrecBitAnd  = 6
+	luaPrecShift   = 7
+	luaPrecConcat  = 8
+	luaPrecAdd     = 9
+	luaPrecMul     = 10
+	luaPrecUnary   = 11
+	luaPrecPow     = 12
+	luaPrecPrimary = 13
+)
+
+var luaOpsBinary = map[string]struct {
+	lua  string
+	prec int
+}{
+	"||": {"or", luaPrecOr}, "&&": {"and", luaPrecAnd},
+	"==": {"==", luaPrecCmp}, "!=": {"~=", luaPrecCmp}, "<": {"<", luaPrecCmp}, ">": {">", luaPrecCmp}, "<=": {"<=", luaPrecCmp}, ">=": {">=", luaPrecCmp},
+	"|": {"|", luaPrecBitOr}, "~": {"~", luaPrecBitXor}, "&": {"&", luaPrecBitAnd}, "<<": {"<<", luaPrecShift}, ">>": {">>", luaPrecShift},
+	"+": {"+", luaPrecAdd}, "-": {"-", luaPrecAdd},
+	"*": {"*", luaPrecMul}, "/": {"/", luaPrecMul}, "//": {"//", luaPrecMul}, "%": {"%", luaPrecMul},
+	"^": {"^", luaPrecPow},
+}
+
+var luaOpsUnary = map[string]string{"-": "-", "!": "not ", "#": "#", "~": "~"}
+
+// what an expr evaluates to, as far as emitting Lua is concerned: per its inferred type if known (see `luaKindOfType`),
+// else per a syntactic guess (see `luaGen.kindOf`)
+type luaKind int
+
+const (
+	luaKindNone luaKind = iota
+	luaKindBool
+	luaKindNum
+	luaKindStr
+	luaKindArr
+	luaKindDict
+	luaKindFunc
+)
+
+// runtime helpers, each emitted (once per chunk) only if used
+var luaHelpers = map[string]string{
+	// the value of omitted (trailing) args, as tested for params with defaults: so a `nil` arg also gets the default
+	"__loon_omitted_fn_arg__": `local __loon_omitted_fn_arg__ = nil`,
+	"__loon_filter__": `local function __loon_filter__(items, pred)
+  local ret = {}
+  for _, item in ipairs(items) do
+    if pred(item) then
+      ret[#ret + 1] = item
+    end
+  end
+  return ret
+end`,
+	// loops over values not known to be arrs or dicts until run-time: arrs by 0-based index and in order, else as by `pairs`
+	"__loon_iter__": `local function __loon_iter__(items)
+  if (#items == 0) and (next(items) ~= nil) then
+    return pairs(items)
+  end
+  local i = 0
+  return function()
+    i = i + 1
+    if i <= #items then
+      return i - 1, items[i]
+    end
+  end
+end`,
+	"__loon_range__": `local function __loon_range__(from, to, step)
+  local ret = {}
+  for i = from, to, step do
+    ret[#ret + 1] = i
+  end
+  return ret
+end`,
+	// the type tests such as `Int foo`, telling `Int`s from `Float`s via Lua 5.3's `math.type`
+	"__loon_is__": `local function __loon_is__(val, type_name)
+  local lua_type = type(val)
+  if type_name == "Bool" then
+    return lua_type == "boolean"
+  elseif type_name == "Str" then
+    return lua_type == "string"
+  end
+  return math.type(val) == ((type_name == "Int") and "integer" or "float")
+end`,
+	// the conversions `Int(val)` and `Float(val)`, to `nil` for non-numeric strs and (for `Int`) non-integral numbers
+	"__loon_to__": `local function __loon_to__(val, type_name)
+  local num = tonumber(val)
+  if (num == nil) or (type_name == "Float") then
+    return num and (num + 0.0)
+  end
+  return (num % 1 == 0) and math.floor(num) or nil
+end`,
+	// `items[from..to]`-like slicing, of arrs or (only if with a step) of strs
+	"__loon_sub__": `local function __loon_sub__(items, from, to, step)
+  local ret, is_str = {}, type(items) == "string"
+  for i = from, to or #items, step do
+    ret[#ret + 1] = is_str and items:sub(i, i) or items[i]
+  end
+  return is_str and table.concat(ret) or ret
+end`,
+	// the `...foo` rest of arr and tuple destructurings, with `num_after` values after it
+	"__loon_slice__": `local function __loon_slice__(items, from, num_after)
+  local ret = {}
+  for i = from, #items - num_after do
+    ret[#ret + 1] = items[i]
+  end
+  return ret
+end`,
+	// arr and tuple literals with `...foo` spreads, as `__loon_concat__({ 1, 2 }, foo, { 3 })`
+	"__loon_concat__": `local function __loon_concat__(...)
+  local ret = {}
+  for i = 1, select("#", ...) do
+    for _, item in ipairs((select(i, ...))) do
+      ret[#ret + 1] = item
+    end
+  end
+  return ret
+end`,
+	// struct type decls, whose tables of methods and statics are also the metatables of their instances, with
+	// the members of the embedded structs promoted (searched in order of embedding)
+	"__loon_struct__": `local function __loon_struct__(...)
+  local ret, embeds = {}, { ... }
+  ret.__index = ret
+  return setmetatable(ret, { __index = function(_, key)
+    for _, embed in ipairs(embeds) do
+      local val = embed[key]
+      if val ~= nil then
+        return val
+      end
+    end
+  end })
+end`,
+	// instance methods not being called but taken as values, as in `bar := foo.bar`
+	"__loon_method__": `local function __loon_method__(self, name)
+  return function(...)
+    return self[name](self, ...)
+  end
+end`,
+	// dict literals with `...foo` spreads, as `__loon_merge__(foo, { bar = baz })`
+	"__loon_merge__": `local function __loon_merge__(...)
+  local ret = {}
+  for i = 1, select("#", ...) do
+    for key, val in pairs((select(i, ...))) do
+      ret[key] = val
+    end
+  end
+  return ret
+end`,
+}
+
+// LuaPack emits all of `pack`'s source files into a single Lua chunk, with `mainSrcFilePath` (if any) coming last.
+// Unless `topLevelGlobals` (see `Lua`), the top-level declarations of all files are forward-declared as `local`s
+// up-front, so that each file sees those of all others, wherever they are declared.
+func LuaPack(pack *session.SrcPack, mainSrcFilePath string, topLevelGlobals bool) (string, *LuaSrcMap, error) {
+	src_files := sl.SortedPer(sl.Where(pack.Files, func(it *session.SrcFile) bool { return !it.IsFauxFile() }),
+		func(file1 *session.SrcFile, file2 *session.SrcFile) int {
+			if is_main1, is_main2 := (file1.FilePath == mainSrcFilePath), (file2.FilePath == mainSrcFilePath); is_main1 != is_main2 {
+				return util.If(is_main1, 1, -1)
+			}
+			return strings.Compare(file1.FilePath, file2.FilePath)
+		})
+	var buf strings.Builder
+	var src_map LuaSrcMap
+	var num_lines int
+	if names := luaTopLevelNames(src_files...); (!topLevelGlobals) && (len(names) > 0) {
+		buf.WriteString("local " + str.Join(names, ", ") + "\n")
+		num_lines++
+	}
+	for _, src_file := range src_files {
+		src_lua, file_src_map, err := luaChunk(src_file, 0, topLevelGlobals, true, false)
+		if err != nil {
+			return "", nil, err
+		}
+		src_map.append(file_src_map, num_lines)
+		buf.WriteString(src_lua)
+		num_lines += strings.Count(src_lua, "\n")
+	}
+	return buf.String(), &src_map, nil
+}
+
+// Lua emits readable Lua source code for `srcFile`, which must be free of error `Diag`s,
+// together with the mapping of its lines back to their originating `srcFile` spans.
+// If `topLevelGlobals`, top-level declarations become Lua globals instead of `local`s,
+// as needed when later chunks (such as REPL inputs) are to see them. Otherwise, they are all forward-declared
+// as `local`s at the start of the chunk, so that funcs can refer to those declared after them.
+func Lua(srcFile *session.SrcFile, topLevelGlobals bool) (string, *LuaSrcMap, error) {
+	return luaChunk(srcFile, 0, topLevelGlobals, false, false)
+}
+
+// LuaReplChunk emits Lua source code for the top-level expressions of `srcFile` (usually the faux file of
+// a REPL session) starting at index `fromExprIdx`, as a chunk whose top-level declarations are
+// globals (so that subsequent chunks see them) and that returns the value of its last expression.
+func LuaReplChunk(srcFile *session.SrcFile, fromExprIdx int) (string, *LuaSrcMap, error) {
+	return luaChunk(srcFile, fromExprIdx, true, false, true)
+}
+
+// LuaExpansion emits Lua source code for just `expr` of `srcFile` (without the helpers it uses), such as for showing
+// in hovers what sugared forms like `foo += 1`, `_ + 1` or `foo .= { bar: 1 }` amount to. It is "" if that fails:
+// unlike `Lua`, it's used on not necessarily error-free source files.
+func LuaExpansion(srcFile *session.SrcFile, expr session.Expr) (ret string) {
+	gen := luaGen{srcFile: srcFile, kinds: map[string]luaKind{}, shared: &luaGenShared{helpers: map[string]bool{}}}
+	defer func() {
+		if recover() != nil {
+			ret = ""
+		}
+	}()
+	if assign, _ := expr.(*session.ExprAssign); assign != nil {
+		gen.stmt(assign, luaDst{})
+	} else {
+		gen.line(gen.expr(expr, 0))
+	}
+	ret, _ = luaSrcMapFrom(gen.out.String(), srcFile.FilePath, gen.shared.spans)
+	return strings.TrimSpace(ret)
+}
+
+// if `forwardDeclared`, the caller has already emitted the `local`s of the top-level decls of `srcFile`
+func luaChunk(srcFile *session.SrcFile, fromExprIdx int, topLevelGlobals bool, forwardDeclared bool, returnLast bool) (ret string, srcMap *LuaSrcMap, err error) {
+	gen := luaGen{srcFile: srcFile, kinds: map[string]luaKind{}, topLevelDeclared: true, shared: &luaGenShared{helpers: map[string]bool{}}}
+	defer func() {
+		if fail := recover(); fail != nil {
+			gen_err, is := fail.(*luaGenErr)
+			if !is {
+				panic(fail)
+			}
+			err = gen_err
+		}
+	}()
+	for _, expr := range srcFile.Trees.Exprs[:fromExprIdx] { // no code for these, but knowledge of their decls
+		if assign, _ := expr.(*session.ExprAssign); (assign != nil) && (assign.Op == ":=") {
+			if ident, _ := assign.Lhs.(*session.ExprIdent); ident != nil {
+				gen.kinds[ident.Name] = gen.kindOf(assign.Rhs)
+			}
+		}
+	}
+	gen.stmts(srcFile.Trees.Exprs[fromExprIdx:], luaDst{isReturn: returnLast})
+	var buf strings.Builder
+	if names := luaTopLevelNames(srcFile); (!topLevelGlobals) && (!forwardDeclared) && (len(names) > 0) {
+		buf.WriteString("local " + str.Join(names, ", ") + "\n")
+	}
+	for _, name := range sl.Sorted(slices.Collect(maps.Keys(gen.shared.helpers))) {
+		buf.WriteString(luaHelpers[name] + "\n")
+	}
+	buf.WriteString(gen.out.String())
+	ret, srcMap = luaSrcMapFrom(buf.String(), srcFile.FilePath, gen.shared.spans)
+	return
+}
+
+type luaGenErr struct {
+	srcFile *session.SrcFile
+	span    session.SrcFileSpan
+	msg     string
+}
+
+func (me *luaGenErr) Error() string {
+	return me.span.LocStr(me.srcFile.FilePath) + ": " + me.msg
+}
+
+type luaGen struct {
+	srcFile *session.SrcFile
+	out     strings.Builder
+	indent  int
+	kinds   map[string]luaKind
+	span    *session.SrcFileSpan // of the statement currently being emitted
+	shared  *luaGenShared
+	// whether in the body of a func failing with errors, which per the `value, err` convention returns
+	// `value, nil` on success and `nil, err` on failure
+	errReturns bool
+	// of the innermost loop (for `~>`) and block expr (for `<~`) being emitted, if any in the current func
+	loop  *luaJumpTarget
+	block *luaJumpTarget
+
+	// whether top-level decls need no `local` where assigned, being either globals or forward-declared
+	topLevelDeclared bool
+}
+
+// a loop or block that `~>` or `<~` jumps to the end of, via a `goto` to its `label` (made and emitted only if used)
+type luaJumpTarget struct {
+	dst   luaDst // for blocks, where `<~` results go
+	label string
+}
+
+// state shared by a `luaGen` and all its `sub`s
+type luaGenShared struct {
+	numTmps int
+	helpers map[string]bool
+	spans   []*session.SrcFileSpan // indexed by the `luaSrcMapMarker`s prefixed to emitted lines
+}
+
+// where the value of an emitted statement goes
+type luaDst struct {
+	isReturn bool
+	assignTo string
+}
+
+func (me *luaGen) failIf(cond bool, expr session.Expr, msg string) {
+	if cond {
+		panic(&luaGenErr{srcFile: me.srcFile, span: expr.Base().Toks.Span(), msg: msg})
+	}
+}
+
+func (me *luaGen) line(src string) {
+	me.out.WriteString(str.Repeat(luaIndent, me.indent))
+	if me.span != nil {
+		me.out.WriteString(luaSrcMapMarker(len(me.shared.spans)))
+		me.shared.spans = append(me.shared.spans, me.span)
+	}
+	me.out.WriteString(src)
+	me.out.WriteByte('\n')
+}
+
+func (me *luaGen) nested(do func()) {
+	me.indent++
+	do()
+	me.indent--
+}
+
+// emits `header` (such as `else`) followed by the statements emitted by `body` one level deeper, or neither if
+// there are none, and reports which
+func (me *luaGen) nestedUnlessEmpty(header string, body func(gen *luaGen)) bool {
+	gen := me.sub(me.indent + 1)
+	gen.loop, gen.block, gen.topLevelDeclared = me.loop, me.block, me.topLevelDeclared
+	body(gen)
+	if gen.out.Len() == 0 {
+		return false
+	}
+	me.line(header)
+	me.out.WriteString(gen.out.String())
+	return true
+}
+
+func (me *luaGen) newTmp() string {
+	me.shared.numTmps++
+	return "_tmp_" + str.FromInt(me.shared.numTmps-1)
+}
+
+// emits a `goto` to the end of `target`, the label of which `label` then emits
+func (me *luaGen) jump(target *luaJumpTarget, labelPrefix string) {
+	if target.label == "" {
+		target.label = str.RePrefix(me.newTmp(), "_tmp", labelPrefix)
+	}
+	me.line("goto " + target.label)
+}
+
+func (me *luaGen) label(target *luaJumpTarget) {
+	if target.label != "" {
+		me.line("::" + target.label + "::")
+	}
+}
+
+// whether emitting `expr` would emit statements, such as those propagating errors of calls, right before the current
+// one: if so, it must not be an operand evaluated only conditionally, such as the right-hand side of `&&` or `||`
+func (me *luaGen) needsHoisting(expr session.Expr) bool {
+	gen, num_tmps := me.sub(me.indent), me.shared.numTmps
+	gen.loop, gen.block, gen.topLevelDeclared = me.loop, me.block, me.topLevelDeclared
+	_ = gen.expr(expr, 0)
+	me.shared.numTmps = num_tmps
+	return gen.out.Len() > 0
+}
+
+// a generator for a nested chunk of statements, such as a function body, that will be spliced into the current one
+func (me *luaGen) sub(indent int) *luaGen {
+	return &luaGen{srcFile: me.srcFile, indent: indent, kinds: maps.Clone(me.kinds), span: me.span, shared: me.shared, errReturns: me.errReturns}
+}
+
+func (me *luaGen) helper(name string) string {
+	me.shared.helpers[name] = true
+	return name
+}
+
+// emits `exprs` as statements, with the last one's value (if any) going into `dst`
+func (me *luaGen) stmts(exprs session.Exprs, dst luaDst) {
+	for i, expr := range exprs {
+		me.stmt(expr, util.If(i == len(exprs)-1, dst, luaDst{}))
+		if _, is_return := expr.(*session.ExprReturn); is_return {
+			break // the rest is unreachable, as hinted by the session's `Unused` diags
+		}
+	}
+}
+
+func (me *luaGen) stmt(expr session.Expr, dst luaDst) {
+	if toks := expr.Base().Toks; len(toks) > 0 {
+		span_parent, span := me.span, toks.Span()
+		me.span = &span
+		defer func() { me.span = span_parent }()
+	}
+	switch it := expr.(type) {
+	case *session.ExprAssign:
+		me.stmtAssign(it)
+	case *session.ExprLoop:
+		me.stmtLoop(it, luaDst{})
+	case *session.ExprContinue:
+		me.failIf(me.loop == nil, it, "`~>` outside of any loop")
+		me.jump(me.loop, "_continue")
+	case *session.ExprReturn:
+		if it.OfBlock {
+			me.stmtResult(it)
+		} else if it.Val == nil {
+			me.line("return")
+		} else {
+			me.stmtReturn(it.Val)
+		}
+	case *session.ExprErrUnion:
+		me.stmtErrUnion(it, dst)
+	case *session.ExprNilSafeCall:
+		me.stmtNilSafeCall(it, dst)
+	case *session.ExprBlock:
+		me.stmtBlock(it, dst)
+	case *session.ExprSwitch:
+		me.stmtSwitch(it, dst)
+	case *session.ExprCond:
+		me.line("if " + me.expr(it.Cond, 0) + " then")
+		me.nested(func() { me.stmtBranch(it.Then, dst) })
+		for it.Else != nil {
+			if else_if, is := it.Else.(*session.ExprCond); is && !me.needsHoisting(else_if.Cond) {
+				it = else_if
+				me.line("elseif " + me.expr(it.Cond, 0) + " then")
+				me.nested(func() { me.stmtBranch(it.Then, dst) })
+			} else {
+				me.nestedUnlessEmpty("else", func(gen *luaGen) { gen.stmtBranch(it.Else, dst) })
+				break
+			}
+		}
+		me.line("end")
+	default:
+		call, _ := expr.(*session.ExprCall)
+		if loop := luaFilterLoop(call); loop != nil {
+			me.stmtLoop(loop, luaDst{})
+			return
+		}
+		switch op, _ := expr.(*session.ExprOpUnary); {
+		case (op != nil) && (op.Op == "?!"):
+			me.line("return nil, " + me.expr(op.Operand, 0))
+		case dst.isReturn:
+			me.stmtReturn(expr)
+		case dst.assignTo != "":
+			me.line(dst.assignTo + " = " + me.expr(expr, 0))
+		case session.ExprIsPure(expr):
+			// no effects and value unused: discarded, as hinted by the session's `Unused` diags
+		case (call != nil) && luaCallFails(call):
+			me.exprPropagated(me.exprCall(call))
+		default:
+			me.failIf(call == nil, expr, "expression is not a statement, and its value is unused")
+			me.line(me.expr(expr, 0))
+		}
+	}
+}
+
+// a block expr (or stand-alone block), as a Lua `do` block unless its value is returned
+func (me *luaGen) stmtBlock(it *session.ExprBlock, dst luaDst) {
+	block_parent := me.block
+	me.block = &luaJumpTarget{dst: dst}
+	defer func() { me.block = block_parent }()
+	stmts := it.Stmts
+	if len(stmts) > 0 {
+		if last, _ := stmts[len(stmts)-1].(*session.ExprReturn); (last != nil) && last.OfBlock { // no need to jump to right here
+			stmts = append(session.Exprs{}, stmts[:len(stmts)-1]...)
+			if last.Val != nil {
+				stmts = append(stmts, last.Val)
+			}
+		}
+	}
+	if dst.isReturn {
+		me.stmts(stmts, dst)
+		return
+	}
+	me.line("do")
+	me.nested(func() {
+		me.stmts(stmts, dst)
+		me.label(me.block)
+	})
+	me.line("end")
+}
+
+// `<~ foo`: `foo` into the `dst` of the enclosing block expr, then (unless returned) a jump to the end of that block
+func (me *luaGen) stmtResult(it *session.ExprReturn) {
+	me.failIf(me.block == nil, it, "`<~` outside of any block")
+	switch {
+	case it.Val != nil:
+		me.stmt(it.Val, me.block.dst)
+	case me.block.dst.isReturn:
+		me.line("return")
+	}
+	if !me.block.dst.isReturn {
+		me.jump(me.block, "_block")
+	}
+}
+
+func (me *luaGen) stmtReturn(val session.Expr) {
+	if !me.errReturns {
+		me.line("return " + me.expr(val, 0)) // so tuples, like everywhere else, as tables
+	} else if call, _ := val.(*session.ExprCall); (call != nil) && luaCallFails(call) {
+		me.line("return " + me.exprCall(call)) // passing on both its value and its error
+	} else {
+		me.line("return " + me.expr(val, 0) + ", nil")
+	}
+}
+
+func (me *luaGen) stmtErrUnion(it *session.ExprErrUnion, dst luaDst) {
+	val := me.exprErrUnion(it, dst.isReturn || (dst.assignTo != ""))
+	switch {
+	case dst.isReturn:
+		me.line("return " + val + util.If(me.errReturns, ", nil", ""))
+	case dst.assignTo != "":
+		me.line(dst.assignTo + " = " + val)
+	}
+}
+
+// `foo ?> bar`: the call `bar(foo)` only if `foo` is not `nil`, else (for any `dst`) a `nil` value
+func (me *luaGen) stmtNilSafeCall(it *session.ExprNilSafeCall, dst luaDst) {
+	subj := me.expr(it.Subj, 0)
+	if subj != luaIdent(subj) {
+		tmp := me.newTmp()
+		me.line("local " + tmp + " = " + subj)
+		subj = tmp
+	}
+	call := &session.ExprCall{ExprBase: session.ExprBase{Toks: it.Toks}, Callee: it.Callee, Args: session.Exprs{&session.ExprIdent{Name: subj}}}
+	me.line("if " + subj + " ~= nil then")
+	me.nested(func() { me.stmt(call, dst) })
+	if dst.assignTo != "" {
+		me.line("else")
+		me.nested(func() { me.line(dst.assignTo + " = nil") })
+	}
+	me.line("end")
+}
+
+// `foo ?! bar`, per the `value, err` convention: on a non-nil `err`, the handler func (or fallback value) `bar` replaces
+// (if `isValueUsed`) `value`, which is returned
+func (me *luaGen) exprErrUnion(it *session.ExprErrUnion, isValueUsed bool) string {
+	val, err := me.newTmp(), me.newTmp()
+	subj := ""
+	if call, _ := it.Subj.(*session.ExprCall); call != nil {
+		subj = me.exprCall(call)
+	} else {
+		subj = me.expr(it.Subj, 0)
+	}
+	me.line("local " + val + ", " + err + " = " + subj)
+	me.line("if " + err + " ~= nil then")
+	me.nested(func() {
+		dst_on_err := util.If(isValueUsed, luaDst{assignTo: val}, luaDst{})
+		if fn, _ := it.OnErr.(*session.ExprFunc); (fn != nil) && (len(fn.Params) == 1) {
+			param := me.expr(fn.Params[0], 0)
+			me.kinds[param] = luaKindNone
+			me.line("local " + param + " = " + err)
+			me.stmts(fn.Body, dst_on_err)
+		} else {
+			me.stmt(it.OnErr, dst_on_err)
+		}
+	})
+	me.line("end")
+	return val
+}
+
+func (me *luaGen) stmtBranch(branch session.Expr, dst luaDst) {
+	if block, is := branch.(*session.ExprBlock); is {
+		me.stmts(block.Stmts, dst)
+	} else {
+		me.stmt(branch, dst)
+	}
+}
+
+func (me *luaGen) stmtAssign(it *session.ExprAssign) {
+	if ident, _ := it.Lhs.(*session.ExprIdent); (ident != nil) && (it.Op == ":=") && (ident.Decl != nil) && ident.Decl.IsUnused() {
+		return // as hinted by the session's `Unused` diags
+	} else if (ident != nil) && (it.Op == ":=") && str.IsUp(ident.Name[:1]) {
+		if (ident.Decl != nil) && (ident.Decl.Struct != nil) {
+			me.stmtStruct(ident.Decl.Struct, it)
+		}
+		return // other type decls exist only at compile-time
+	} else if member, _ := it.Lhs.(*session.ExprMember); (member != nil) && (it.Op == ":=") { // as in `Cat.isLikelyChallenging := () -> .lovesKeyboards`
+		var method *session.StructMember
+		if ident, _ := member.Subj.(*session.ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Struct != nil) {
+			method = sl.FirstWhere(ident.Decl.Struct.Members, func(candidate *session.StructMember) bool { return candidate.Expr == session.Expr(it) })
+		}
+		me.line(me.expr(member, luaPrecPrimary) + " = " + me.exprStructMember(method, it.Rhs))
+		return
+	}
+	if it.Op == ".=" {
+		me.stmtUpdate(it)
+		return
+	} else if _, is_tuple := it.Rhs.(*session.ExprTuple); luaIsDestructuring(it.Lhs) || (luaIsPattern(it.Lhs) && !is_tuple) {
+		src := ""
+		if call, _ := it.Rhs.(*session.ExprCall); (call != nil) && (luaKindOfType(call.Type) != luaKindArr) {
+			src = "{ " + me.expr(call, 0) + " }" // the multiple return values of a Lua func, as a tuple
+		} else {
+			src = me.expr(it.Rhs, 0)
+		}
+		if src != luaIdent(src) { // not already a local, such as a hoisted block's
+			tmp := me.newTmp()
+			me.line("local " + tmp + " = " + src)
+			src = tmp
+		}
+		me.stmtDestructure(it.Lhs, src, me.isLocalDecl(it))
+		return
+	}
+	if op := str.TrimSuff(it.Op, "="); (it.Op != ":=") && (op != "") {
+		me.line(me.expr(it.Lhs, luaPrecPrimary) + " = " + me.expr(&session.ExprOpBinary{ExprBase: it.ExprBase, Op: op, Lhs: it.Lhs, Rhs: it.Rhs}, 0))
+		return
+	}
+
+	lhs_names := []session.Expr{it.Lhs}
+	if tuple, is := it.Lhs.(*session.ExprTuple); is {
+		lhs_names = tuple.Items
+	}
+	lhs := str.Join(sl.To(lhs_names, func(lhs session.Expr) string {
+		if it.Op == ":=" {
+			ident, _ := lhs.(*session.ExprIdent)
+			me.failIf(ident == nil, lhs, "expected a name to declare")
+		}
+		return me.expr(lhs, luaPrecPrimary)
+	}), ", ")
+	if ident, _ := it.Lhs.(*session.ExprIdent); (ident != nil) && (it.Op == ":=") {
+		me.kinds[ident.Name] = me.kindOf(it.Rhs)
+	}
+
+	_, is_func := it.Rhs.(*session.ExprFunc)
+	_, is_block := it.Rhs.(*session.ExprBlock)
+	_, is_cond := it.Rhs.(*session.ExprCond)
+	_, is_switch := it.Rhs.(*session.ExprSwitch)
+	loop, _ := it.Rhs.(*session.ExprLoop)
+	if is_func || is_block || is_switch || (loop != nil) || (is_cond && !me.isInlinable(it.Rhs)) {
+		if me.isLocalDecl(it) {
+			me.line("local " + lhs)
+		}
+		if loop != nil {
+			me.stmtLoop(loop, luaDst{assignTo: lhs})
+		} else {
+			me.stmt(it.Rhs, luaDst{assignTo: lhs})
+		}
+		return
+	}
+	var rhs string // not via `util.If`, as emitting either may also emit hoisted statements
+	if len(lhs_names) > 1 {
+		rhs = me.exprList(it.Rhs)
+	} else {
+		rhs = me.expr(it.Rhs, 0)
+	}
+	me.line(util.If(me.isLocalDecl(it), "local ", "") + lhs + " = " + rhs)
+}
+
+// emits the local decls (or, if not `isDecl`, the assignments) of all the names in the destructuring `pattern`,
+// taken from the Lua table in the local `src`
+func (me *luaGen) stmtDestructure(pattern session.Expr, src string, isDecl bool) {
+	var names, vals []string
+	var nested []struct { // sub-patterns, and the tmps holding the sub-tables they destructure
+		pattern session.Expr
+		src     string
+	}
+	add := func(target session.Expr, val string, kind luaKind) {
+		if ident, _ := target.(*session.ExprIdent); (ident != nil) && (ident.Name == "_") {
+			return
+		} else if luaIsPattern(target) {
+			tmp := me.newTmp()
+			me.line("local " + tmp + " = " + val)
+			nested = append(nested, struct {
+				pattern session.Expr
+				src     string
+			}{target, tmp})
+			return
+		}
+		name := me.expr(target, luaPrecPrimary)
+		names, vals = append(names, name), append(vals, val)
+		if ident, _ := target.(*session.ExprIdent); (ident != nil) && isDecl {
+			me.kinds[name] = kind
+		}
+	}
+	switch it := pattern.(type) {
+	case *session.ExprDict:
+		for _, entry := range it.Entries {
+			add(entry.Val, src+luaMemberAccess(entry.Name), luaKindNone)
+		}
+	default:
+		var items session.Exprs
+		if arr, _ := it.(*session.ExprArr); arr != nil {
+			items = arr.Items
+		} else {
+			items = it.(*session.ExprTuple).Items
+		}
+		idx_spread := sl.IdxWhere(items, func(it session.Expr) bool { _, is := it.(*session.ExprSpread); return is })
+		for i, item := range items {
+			if i == idx_spread {
+				add(item.(*session.ExprSpread).Subj, me.itemAt(src, items, i), luaKindArr)
+			} else {
+				add(item, me.itemAt(src, items, i), luaKindNone)
+			}
+		}
+	}
+	if len(names) > 0 {
+		me.line(util.If(isDecl, "local ", "") + str.Join(names, ", ") + " = " + str.Join(vals, ", "))
+	}
+	for _, it := range nested {
+		me.stmtDestructure(it.pattern, it.src, isDecl)
+	}
+}
+
+// for the arr or tuple pattern `items`, the Lua expr of the part of the table in the local `src` for the item at `i`:
+// indexed from the start if before any `...foo` spread, else from the end, and for the spread itself, a slice
+func (me *luaGen) itemAt(src string, items session.Exprs, i int) string {
+	idx_spread, num_after := sl.IdxWhere(items, func(it session.Expr) bool { _, is := it.(*session.ExprSpread); return is }), len(items)-i-1
+	switch {
+	case i == idx_spread:
+		return me.helper("__loon_slice__") + "(" + src + ", " + str.FromInt(i+1) + ", " + str.FromInt(num_after) + ")"
+	case (idx_spread >= 0) && (i > idx_spread):
+		return src + "[#" + src + util.If(num_after == 0, "", " - "+str.FromInt(num_after)) + "]"
+	}
+	return src + "[" + str.FromInt(i+1) + "]"
+}
+
+// `foo ?.. cases`, with the scrutinee evaluated only once: an `if`/`elseif` chain of the cases' conds (any of which
+// matching), with the (first) catch-all case as its `else`. For `_.bar()`-like guards, the scrutinee is the local `_`
+func (me *luaGen) stmtSwitch(it *session.ExprSwitch, dst luaDst) {
+	subj := me.expr(it.Subj, 0)
+	if _, is_ident := it.Subj.(*session.ExprIdent); !is_ident {
+		tmp := me.newTmp()
+		me.line("local " + tmp + " = " + subj)
+		subj = tmp
+	}
+	if sl.Any(it.Cases, func(case_ *session.ExprSwitchCase) bool {
+		return sl.Any(case_.Conds, func(cond session.Expr) bool { return session.ExprSwitchCondKindOf(cond) == session.ExprSwitchCondGuard })
+	}) {
+		me.line("local _ = " + subj)
+		me.kinds["_"] = me.kindOf(it.Subj)
+	}
+	var catch_all *session.ExprSwitchCase
+	var catch_all_name string
+	keyword := "if "
+	for _, case_ := range it.Cases {
+		var tests, binds []string
+		for _, cond := range case_.Conds {
+			switch session.ExprSwitchCondKindOf(cond) {
+			case session.ExprSwitchCondCatchAll:
+				catch_all, catch_all_name = case_, cond.(*session.ExprIdent).Name
+			case session.ExprSwitchCondGuard:
+				me.failIf(((keyword != "if ") || (len(tests) > 0)) && me.needsHoisting(cond), cond, "guards failing with errors are not yet supported by code generation other than as the first one")
+				tests = append(tests, me.expr(cond, luaPrecOr+1))
+			case session.ExprSwitchCondPattern:
+				test, pattern_binds := me.switchPattern(cond, subj)
+				tests, binds = append(tests, str.Join(test, " and ")), append(binds, pattern_binds...)
+			default:
+				tests = append(tests, subj+" == "+me.expr(cond, luaPrecCmp+1))
+			}
+		}
+		if catch_all != nil {
+			break // any later cases are unreachable
+		}
+		me.failIf((len(binds) > 0) && (len(case_.Conds) > 1), case_, "destructuring cases with other conditions are not yet supported by code generation")
+		me.line(keyword + str.Join(tests, " or ") + " then")
+		me.nested(func() {
+			for _, bind := range binds {
+				me.line(bind)
+			}
+			me.stmtBranch(case_.Body, dst)
+		})
+		keyword = "elseif "
+	}
+	is_open := (keyword != "if ") // whether an `if` (or `do`) awaits its `end`
+	if catch_all != nil {
+		is_open = me.nestedUnlessEmpty(util.If(is_open, "else", "do"), func(gen *luaGen) {
+			if catch_all_name != "_" {
+				gen.line("local " + luaIdent(catch_all_name) + " = " + subj)
+				gen.kinds[luaIdent(catch_all_name)] = gen.kindOf(it.Subj)
+			}
+			gen.stmtBranch(catch_all.Body, dst)
+		}) || is_open
+	}
+	if is_open {
+		me.line("end")
+	}
+}
+
+// for the destructuring `pattern` of a `?..` case, the Lua conditions for the table in `src` to match it and the
+// local decls of its `_foo` names
+func (me *luaGen) switchPattern(pattern session.Expr, src string) (tests []string, binds []string) {
+	tests = []string{"type(" + src + `) == "table"`}
+	match := func(target session.Expr, val string) {
+		if ident, _ := target.(*session.ExprIdent); (ident != nil) && str.Begins(ident.Name, "_") {
+			if ident.Name != "_" {
+				binds = append(binds, "local "+luaIdent(ident.Name)+" = "+val)
+				me.kinds[luaIdent(ident.Name)] = luaKindNone
+			}
+		} else if luaIsPattern(target) {
+			sub_tests, sub_binds := me.switchPattern(target, val)
+			tests, binds = append(tests, sub_tests...), append(binds, sub_binds...)
+		} else {
+			tests = append(tests, val+" == "+me.expr(target, luaPrecCmp+1))
+		}
+	}
+	switch it := pattern.(type) {
+	case *session.ExprDict:
+		for _, entry := range it.Entries {
+			me.failIf(entry.Name == "", entry, "expected a named entry in the destructuring pattern")
+			match(entry.Val, src+luaMemberAccess(entry.Name))
+		}
+	default:
+		var items session.Exprs
+		if arr, _ := it.(*session.ExprArr); arr != nil {
+			items = arr.Items
+		} else {
+			items = it.(*session.ExprTuple).Items
+		}
+		if luaHasSpreads(items) {
+			tests = append(tests, "#"+src+" >= "+str.FromInt(len(items)-1))
+		} else {
+			tests = append(tests, "#"+src+" == "+str.FromInt(len(items)))
+		}
+		for i, item := range items {
+			if spread, _ := item.(*session.ExprSpread); spread != nil {
+				match(spread.Subj, me.itemAt(src, items, i))
+			} else {
+				match(item, me.itemAt(src, items, i))
+			}
+		}
+	}
+	return
+}
+
+// `foo .= { bar: baz }`: as `foo = { ...foo, bar: baz }`, a shallow copy of `foo` with the fields of the right-hand
+// side, so that other references to the prior `foo` remain unaffected
+func (me *luaGen) stmtUpdate(it *session.ExprAssign) {
+	var lhs string
+	switch lhs_expr := it.Lhs.(type) {
+	case *session.ExprIdent:
+		lhs = me.expr(lhs_expr, luaPrecPrimary)
+	case *session.ExprMember:
+		me.failIf(lhs_expr.IsNilSafe, it.Lhs, "`?.` on the left-hand side of `.=` is not supported")
+		if lhs = me.expr(lhs_expr.Subj, 0); lhs != luaIdent(lhs) { // evaluated once, for both the read and the write
+			tmp := me.newTmp()
+			me.line("local " + tmp + " = " + lhs)
+			lhs = tmp
+		}
+		lhs += luaMemberAccess(lhs_expr.Name)
+	default:
+		me.failIf(true, it.Lhs, "`.=` on other than names and fields is not yet supported by code generation")
+	}
+	src := me.helper("__loon_merge__") + "(" + lhs + ", " + me.expr(it.Rhs, 0) + ")"
+	if me.srcFile.StructOf(it.Lhs.Base().Type) != nil { // struct instances keep their methods
+		src = "setmetatable(" + src + ", getmetatable(" + lhs + "))"
+	}
+	me.line(lhs + " = " + src)
+}
+
+// a struct type decl: the table of its methods and statics (see `__loon_struct__`), with those of its embedded
+// structs promoted. Its instance fields exist only in its instances (see `exprStructLit`)
+func (me *luaGen) stmtStruct(it *session.Struct, decl *session.ExprAssign) {
+	name := luaIdent(it.Decl.Name)
+	embeds := sl.To(sl.Where(it.Members, func(member *session.StructMember) bool {
+		return (member.Kind == session.StructMemberEmbed) && (member.Embeds != nil)
+	}), func(member *session.StructMember) string { return luaIdent(member.Embeds.Decl.Name) })
+	me.line(util.If(me.isLocalDecl(decl), "local ", "") + name + " = " + me.helper("__loon_struct__") + "(" + str.Join(embeds, ", ") + ")")
+	for _, member := range it.Members {
+		if entry, _ := member.Expr.(*session.ExprDictEntry); (entry != nil) && ((member.Kind == session.StructMemberMethod) || (member.Kind == session.StructMemberStatic)) {
+			me.line(name + luaMemberAccess(member.Name) + " = " + me.exprStructMember(member, entry.Val))
+		}
+	}
+}
+
+// the value `val` of the struct `member`, which for instance methods is a func taking the instance first
+func (me *luaGen) exprStructMember(member *session.StructMember, val session.Expr) string {
+	if (member == nil) || (member.Kind != session.StructMemberMethod) {
+		return me.expr(val, 0)
+	}
+	fn, _ := val.(*session.ExprFunc)
+	me.failIf(fn == nil, val, "instance methods other than func literals are not yet supported by code generation")
+	return me.exprFunc(fn, "self")
+}
+
+// a struct literal `Foo { bar: baz }`: a table of the given instance fields plus those (also promoted) ones with
+// defaults, either of their decl or of the embedding of their struct, with the `Foo` table as its metatable
+func (me *luaGen) exprStructLit(it *session.Struct, dict *session.ExprDict) string {
+	var names []string
+	vals := map[string]session.Expr{}
+	luaStructDefaults(it, vals, &names, map[*session.Struct]bool{})
+	names = sl.Where(names, func(name string) bool {
+		return !sl.Any(dict.Entries, func(entry *session.ExprDictEntry) bool { return entry.Name == name })
+	})
+	fields := sl.To(names, func(name string) string { return luaDictKey(name) + me.expr(vals[name], 0) })
+	for _, entry := range dict.Entries {
+		fields = append(fields, luaDictKey(entry.Name)+me.expr(entry.Val, 0))
+	}
+	return "setmetatable(" + util.If(len(fields) == 0, "{}", "{ "+str.Join(fields, ", ")+" }") + ", " + luaIdent(it.Decl.Name) + ")"
+}
+
+// collects into `vals` (and their `names` in order) the default values of the (also promoted) instance fields of
+// `it`. Those of its own decl take precedence over those of its embeddings, and earlier embeddings over later ones
+func luaStructDefaults(it *session.Struct, vals map[string]session.Expr, names *[]string, seen map[*session.Struct]bool) {
+	if seen[it] {
+		return
+	}
+	seen[it] = true
+	set := func(name string, val session.Expr) {
+		if _, exists := vals[name]; !exists {
+			*names = append(*names, name)
+		}
+		vals[name] = val
+	}
+	for i := len(it.Members) - 1; i >= 0; i-- {
+		if embed := it.Members[i]; (embed.Kind == session.StructMemberEmbed) && (embed.Embeds != nil) {
+			luaStructDefaults(embed.Embeds, vals, names, seen)
+			if call, _ := embed.Expr.(*session.ExprDictEntry).Val.(*session.ExprCall); (call != nil) && (len(call.Args) == 1) {
+				if dict, _ := call.Args[0].(*session.ExprDict); dict != nil {
+					for _, entry := range dict.Entries {
+						set(entry.Name, entry.Val)
+					}
+				}
+			}
+		}
+	}
+	for _, field := range it.Members {
+		if entry, _ := field.Expr.(*session.ExprDictEntry); (field.Kind == session.StructMemberField) && (entry != nil) && (entry.Default != nil) {
+			set(field.Name, entry.Default)
+		}
+	}
+}
+
+// the (also promoted) member of a struct that `it` accesses, if any: for `Foo.bar` on the struct type `Foo`, a
+// static one, else one of the instance
+func (me *luaGen) structMemberOf(it *session.ExprMember) *session.StructMember {
+	if ident, _ := it.Subj.(*session.ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Struct != nil) {
+		return ident.Decl.Struct.Member(it.Name, true)
+	} else if strct := me.srcFile.StructOf(it.Subj.Base().Type); strct != nil {
+		return strct.Member(it.Name, false)
+	}
+	return nil
+}
+
+func (me *luaGen) isLocalDecl(it *session.ExprAssign) bool {
+	return (it.Op == ":=") && !(me.topLevelDeclared && (me.indent == 0))
+}
+
+// the Lua names of the top-level decls of `srcFiles` that exist at run-time (so not those of non-struct type decls), in order
+func luaTopLevelNames(srcFiles ...*session.SrcFile) (ret []string) {
+	for _, src_file := range srcFiles {
+		for _, expr := range src_file.Trees.Exprs {
+			if assign, _ := expr.(*session.ExprAssign); (assign != nil) && (assign.Op == ":=") {
+				session.ExprWalk(assign.Lhs, func(it session.Expr) bool {
+					if ident, _ := it.(*session.ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) &&
+						ident.Decl.IsTopLevel() && ((ident.Decl.Struct != nil) || !str.IsUp(ident.Name[:1])) {
+						ret = append(ret, luaIdent(ident.Name))
+					}
+					return true
+				})
+			}
+		}
+	}
+	return
+}
+
+// a Lua `for` or `while` loop. For loop exprs (with a `dst`), each iteration's body value (unless skipped by `~>`)
+// is appended to an accumulator table that then goes into `dst`
+func (me *luaGen) stmtLoop(it *session.ExprLoop, dst luaDst) {
+	loop_parent := me.loop
+	me.loop = &luaJumpTarget{}
+	defer func() { me.loop = loop_parent }()
+	if dst.assignTo == "" {
+		me.stmtLoopAround(it, func() {
+			me.stmts(it.Body.Body, luaDst{})
+			me.label(me.loop)
+		})
+		return
+	}
+	accum, num := me.newTmp(), me.newTmp()
+	me.line("do")
+	me.nested(func() {
+		me.line("local " + accum + " = {}")
+		me.line("local " + num + " = 1")
+		me.stmtLoopAround(it, func() {
+			me.stmts(it.Body.Body, luaDst{assignTo: accum + "[" + num + "]"})
+			me.line(num + " = " + num + " + 1")
+			me.label(me.loop)
+		})
+		me.line(dst.assignTo + " = " + accum)
+	})
+	me.line("end")
+}
+
+// the `for` or `while` loop of `it`, with `body` emitting its body
+func (me *luaGen) stmtLoopAround(it *session.ExprLoop, body func()) {
+	if it.IsWhile() {
+		cond := me.sub(me.indent + 1)
+		src_cond := cond.expr(it.Subj, 0)
+		if cond.out.Len() == 0 {
+			me.line("while " + src_cond + " do")
+		} else { // the condition needed hoisted statements, which must run on every iteration
+			me.line("while true do")
+			me.out.WriteString(cond.out.String())
+			me.nested(func() { me.line("if not " + luaParensed(src_cond, cond.isInlineCompound(it.Subj)) + " then break end") })
+		}
+		me.nested(body)
+		me.line("end")
+		return
+	}
+
+	subj := it.Subj
+	var pred *session.ExprFunc // of a filtering `foo[pred]` subj, looped over as `foo`, but running the body only if `pred`
+	if index, _ := subj.(*session.ExprIndex); index != nil {
+		if pred, _ = index.Index.(*session.ExprFunc); pred != nil {
+			subj = index.Subj
+		}
+	}
+	destructuring := me.sub(me.indent + util.If(pred == nil, 1, 2))
+	params := destructuring.params(it.Body.Params, nil)
+	name_idx, name_val := "_", params[0]
+	if len(params) > 1 {
+		name_idx, name_val = params[0], params[1]
+	}
+	if pred != nil {
+		me.stmtLoopFiltered(subj, pred, name_idx, name_val, destructuring, body)
+		return
+	}
+	var pre_body []string
+	if arr, _ := subj.(*session.ExprArr); (arr != nil) && (luaArrRange(arr) != nil) {
+		subj = luaArrRange(arr)
+	}
+	switch kind := me.kindOf(subj); {
+	case kind == luaKindArr:
+		var rng *session.ExprRange // for an arr slice, iterated without materializing it (unlike filtering, as in `arr[_ > 0]`)
+		slice, _ := subj.(*session.ExprIndex)
+		if slice != nil {
+			rng, _ = slice.Index.(*session.ExprRange)
+		}
+		if rng != nil {
+			items := me.expr(slice.Subj, 0)
+			if items != luaIdent(items) {
+				tmp := me.newTmp()
+				me.line("local " + tmp + " = " + items)
+				items = tmp
+			}
+			from, to, step := me.exprSliceBounds(rng, items)
+			if _, is_lit := rng.From.(*session.ExprLit); (name_idx != "_") && (rng.From != nil) && !is_lit {
+				tmp := me.newTmp()
+				me.line("local " + tmp + " = " + from)
+				from = tmp
+			}
+			idx := me.newTmp()
+			me.line("for " + idx + " = " + from + ", " + to + util.If(step == "1", "", ", "+step) + " do")
+			if name_idx != "_" {
+				pre_body = append(pre_body, "local "+name_idx+" = "+luaParensed(idx+" - "+from, step != "1")+util.If(step == "1", "", " // "+step))
+			}
+			pre_body = append(pre_body, "local "+name_val+" = "+items+"["+idx+"]")
+		} else if rng, _ = subj.(*session.ExprRange); rng != nil {
+			from, to, step := me.exprRangeBounds(rng)
+			me.kinds[name_val] = luaKindNum
+			if name_idx == "_" {
+				me.line("for " + name_val + " = " + from + ", " + to + util.If(step == "1", "", ", "+step) + " do")
+			} else {
+				if _, is_lit := rng.From.(*session.ExprLit); !is_lit {
+					tmp := me.newTmp()
+					me.line("local " + tmp + " = " + from)
+					from = tmp
+				}
+				count := luaParensed(to+util.If(from == "0", "", " - "+from), step != "1") + util.If(step == "1", "", " // "+step)
+				me.line("for " + name_idx + " = 0, " + count + " do")
+				pre_body = append(pre_body, "local "+name_val+" = "+util.If(from == "0", "", from+" + ")+name_idx+util.If(step == "1", "", " * "+step))
+			}
+		} else if name_idx == "_" {
+			me.line("for _, " + name_val + " in ipairs(" + me.expr(subj, 0) + ") do")
+		} else {
+			tmp := me.newTmp()
+			me.line("for " + tmp + ", " + name_val + " in ipairs(" + me.expr(subj, 0) + ") do")
+			pre_body = append(pre_body, "local "+name_idx+" = "+tmp+" - 1")
+		}
+	case kind == luaKindNone: // such as a param of a generic func, so either
+		me.line("for " + name_idx + ", " + name_val + " in " + me.helper("__loon_iter__") + "(" + me.expr(subj, 0) + ") do")
+	default:
+		me.line("for " + name_idx + ", " + name_val + " in pairs(" + me.expr(subj, 0) + ") do")
+	}
+	me.nested(func() {
+		for _, src := range pre_body {
+			me.line(src)
+		}
+		me.out.WriteString(destructuring.out.String())
+		body()
+	})
+	me.line("end")
+}
+
+// a loop over those items of the arr `items` satisfying `pred`, as for `my_numbers[_ % 2 == 1] (n) -> print(n)`: with an
+// `if` around the body, rather than over a new filtered arr (as by `__loon_filter__`), and with `nameIdx` (if any)
+// counting just the satisfying items
+func (me *luaGen) stmtLoopFiltered(items session.Expr, pred *session.ExprFunc, nameIdx string, nameVal string, destructuring *luaGen, body func()) {
+	item, cond := nameVal, ""
+	if param, _ := pred.Params[0].(*session.ExprIdent); (len(pred.Params) == 1) && (param != nil) && (len(pred.Body) == 1) && !me.needsHoisting(pred.Body[0]) {
+		item = me.expr(param, 0) // so `pred`'s body, such as `__a0__ % 2 == 1`, is the condition as-is
+		me.kinds[item] = luaKindNone
+		cond = me.expr(pred.Body[0], 0)
+	} else {
+		tmp := me.newTmp()
+		me.line("local " + tmp + " = " + me.expr(pred, 0))
+		cond = tmp + "(" + item + ")"
+	}
+	num := ""
+	if nameIdx != "_" {
+		num = me.newTmp()
+		me.line("local " + num + " = 0")
+	}
+	me.line("for _, " + item + " in ipairs(" + me.expr(items, 0) + ") do")
+	me.nested(func() {
+		me.line("if " + cond + " then")
+		me.nested(func() {
+			if item != nameVal {
+				me.line("local " + nameVal + " = " + item)
+			}
+			if num != "" {
+				me.line("local " + nameIdx + " = " + num)
+				me.line(num + " = " + num + " + 1")
+			}
+			me.out.WriteString(destructuring.out.String())
+			body()
+		})
+		me.line("end")
+	})
+	me.line("end")
+}
+
+// the loop that `call` amounts to if it is one such as `my_numbers[_ % 2 == 1] print` (see `session.ExprCall.FilterLoop`),
+// with the callee's param named as `pred`'s (so that its loop var needs no renaming), else nil
+func luaFilterLoop(call *session.ExprCall) *session.ExprLoop {
+	if call == nil {
+		return nil
+	}
+	filter, callee := call.FilterLoop()
+	if filter == nil {
+		return nil
+	}
+	item := &session.ExprIdent{Name: "__item__"}
+	if param, _ := filter.Index.(*session.ExprFunc).Params[0].(*session.ExprIdent); param != nil {
+		item.Name = param.Name
+	}
+	return &session.ExprLoop{ExprBase: call.ExprBase, Subj: filter, Body: &session.ExprFunc{ExprBase: call.ExprBase, Params: session.Exprs{item},
+		Body: session.Exprs{&session.ExprCall{ExprBase: call.ExprBase, Callee: callee, Args: session.Exprs{item}}}}}
+}
+
+// like `expr`, but tuple literals turn into Lua's comma-separated multiple values
+func (me *luaGen) exprList(expr session.Expr) string {
+	if tuple, is := expr.(*session.ExprTuple); is {
+		return str.Join(sl.To(tuple.Items, func(it session.Expr) string { return me.expr(it, 0) }), ", ")
+	}
+	return me.expr(expr, 0)
+}
+
+func (me *luaGen) expr(expr session.Expr, parentPrec int) (ret string) {
+	prec := luaPrecPrimary
+	switch it := expr.(type) {
+	case *session.ExprIdent:
+		ret = luaIdent(it.Name)
+	case *session.ExprLit:
+		ret = luaLit(it)
+	case *session.ExprSelf:
+		ret = "self"
+	case *session.ExprMember:
+		if member := me.structMemberOf(it); (member != nil) && (member.Kind == session.StructMemberEmbed) && !it.IsNilSafe {
+			ret = me.expr(it.Subj, parentPrec) // the embedded struct's fields are those of the instance itself
+			break
+		} else if (member != nil) && (member.Kind == session.StructMemberMethod) && !it.IsNilSafe {
+			ret = me.helper("__loon_method__") + "(" + me.expr(it.Subj, 0) + ", " + luaStr(it.Name) + ")"
+			break
+		} else if !it.IsNilSafe {
+			ret = me.exprPrefix(it.Subj) + luaMemberAccess(it.Name)
+			break
+		}
+		subj := me.expr(it.Subj, 0) // `foo?.bar` as `foo and foo.bar`
+		if subj != luaIdent(subj) {
+			tmp := me.newTmp()
+			me.line("local " + tmp + " = " + subj)
+			subj = tmp
+		}
+		prec, ret = luaPrecAnd, subj+" and "+subj+luaMemberAccess(it.Name)
+	case *session.ExprIndex:
+		if _, is_filter := it.Index.(*session.ExprFunc); is_filter {
+			ret = me.helper("__loon_filter__") + "(" + me.expr(it.Subj, 0) + ", " + me.expr(it.Index, 0) + ")"
+		} else if rng, _ := it.Index.(*session.ExprRange); rng != nil {
+			ret = me.exprSlice(it.Subj, rng)
+		} else {
+			ret = me.exprPrefix(it.Subj) + "[" + me.exprIndex(it.Index) + "]"
+		}
+	case *session.ExprCall:
+		if type_name, subj := it.TypeTest(); subj != nil {
+			ret = me.helper("__loon_is__") + "(" + me.exprList(subj) + `, "` + type_name + `")`
+			break
+		} else if type_name, subj := it.Conversion(); (subj != nil) && (type_name == "Str") {
+			ret = "tostring(" + me.expr(subj, 0) + ")"
+			break
+		} else if subj != nil {
+			ret = me.helper("__loon_to__") + "(" + me.expr(subj, 0) + `, "` + type_name + `")`
+			break
+		}
+		if loop := luaFilterLoop(it); loop != nil { // a loop, so hoisted, and of no value
+			me.stmtLoop(loop, luaDst{})
+			ret = "nil"
+			break
+		}
+		if callee, _ := it.Callee.(*session.ExprIdent); it.IsUnary && (len(it.Args) == 1) && (callee != nil) && (callee.Decl != nil) && (callee.Decl.Struct != nil) {
+			if dict, _ := it.Args[0].(*session.ExprDict); dict != nil {
+				ret = me.exprStructLit(callee.Decl.Struct, dict)
+				break
+			}
+		}
+		if ret = me.exprCall(it); luaCallFails(it) {
+			ret = me.exprPropagated(ret)
+		}
+	case *session.ExprOpUnary:
+		me.failIf(it.Op == "?!", expr, "failing with an error is not yet supported by code generation other than as a statement")
+		prec, ret = luaPrecUnary, luaOpsUnary[it.Op]+me.expr(it.Operand, luaPrecUnary)
+	case *session.ExprOpBinary:
+		if ((it.Op == "&&") || (it.Op == "||")) && me.needsHoisting(it.Rhs) {
+			ret = me.exprShortCircuit(it)
+			break
+		}
+		op := luaOpsBinary[it.Op]
+		kind_lhs, kind_rhs := me.kindOf(it.Lhs), me.kindOf(it.Rhs)
+		if (it.Op == "+") && ((kind_lhs == luaKindStr) || (kind_rhs == luaKindStr)) {
+			op.lua, op.prec = "..", luaPrecConcat
+		} else if ((it.Op == "&") || (it.Op == "|")) && ((kind_lhs == luaKindBool) || (kind_rhs == luaKindBool)) {
+			op = luaOpsBinary[it.Op+it.Op]
+		}
+		prec = op.prec
+		is_right_assoc := (op.prec == luaPrecPow) || (op.prec == luaPrecConcat)
+		ret = me.expr(it.Lhs, util.If(is_right_assoc, prec+1, prec)) + " " + op.lua + " " + me.expr(it.Rhs, util.If(is_right_assoc, prec, prec+1))
+	case *session.ExprTuple:
+		ret = me.exprTable(it.Items)
+	case *session.ExprArr:
+		if rng := luaArrRange(it); rng != nil {
+			ret = me.expr(rng, parentPrec)
+		} else {
+			ret = me.exprTable(it.Items)
+		}
+	case *session.ExprRange:
+		from, to, step := me.exprRangeBounds(it)
+		ret = me.helper("__loon_range__") + "(" + from + ", " + to + ", " + step + ")"
+	case *session.ExprDict:
+		ret = me.exprDict(it)
+	case *session.ExprStrInterp:
+		prec = luaPrecConcat
+		ret = str.Join(sl.To(it.Parts, func(part session.Expr) string {
+			if me.kindOf(part) == luaKindStr {
+				return me.expr(part, luaPrecConcat+1)
+			}
+			return "tostring(" + me.expr(part, 0) + ")"
+		}), " .. ")
+	case *session.ExprFunc:
+		ret = me.exprFunc(it)
+	case *session.ExprCond:
+		if me.isInlinable(it) && !(me.needsHoisting(it.Then) || me.needsHoisting(it.Else)) {
+			prec = luaPrecOr
+			ret = me.expr(it.Cond, luaPrecAnd+1) + " and " + me.expr(it.Then, luaPrecAnd+1) + " or " + me.expr(it.Else, luaPrecOr+1)
+		} else {
+			ret = me.exprHoisted(it)
+		}
+	case *session.ExprBlock, *session.ExprSwitch, *session.ExprLoop, *session.ExprNilSafeCall:
+		ret = me.exprHoisted(it)
+	case *session.ExprErrUnion:
+		ret = me.exprErrUnion(it, true)
+	default:
+		me.failIf(true, expr, "expression not supported here")
+	}
+	if prec < parentPrec {
+		ret = "(" + ret + ")"
+	}
+	return
+}
+
+// the call itself, without any propagation of the error it may fail with (see `exprPropagated`)
+func (me *luaGen) exprCall(call *session.ExprCall) string {
+	args := call.Args
+	if call.IsUnary && (len(args) == 1) {
+		if tuple, _ := args[0].(*session.ExprTuple); tuple != nil {
+			args = tuple.Items // `foo (bar, baz)` is the same as `foo(bar, baz)`
+		}
+	}
+	srcs := sl.To(args, func(arg session.Expr) string { return me.exprList(arg) })
+	if member, _ := call.Callee.(*session.ExprMember); (member != nil) && !member.IsNilSafe {
+		embed, _ := member.Subj.(*session.ExprMember)
+		if embed != nil {
+			if it := me.structMemberOf(embed); (it != nil) && (it.Kind == session.StructMemberEmbed) && (it.Embeds != nil) {
+				// the embedded struct's method (rather than any overriding one), as in `.Animal.str()`
+				return luaIdent(it.Embeds.Decl.Name) + luaMemberAccess(member.Name) + "(" + str.Join(append([]string{me.expr(embed.Subj, 0)}, srcs...), ", ") + ")"
+			}
+		}
+		_, is_str := member.Subj.Base().Type.(ty.TypeStr)
+		if it := me.structMemberOf(member); is_str || (me.kindOf(member.Subj) == luaKindStr) || ((it != nil) && (it.Kind == session.StructMemberMethod)) {
+			// instance methods, or those of Lua's `string` library on strs, as in `foo.lower()`
+			subj := me.exprPrefix(member.Subj)
+			if luaMemberAccess(member.Name)[0] == '.' {
+				return subj + ":" + member.Name + "(" + str.Join(srcs, ", ") + ")"
+			}
+			tmp := me.newTmp() // for names not allowing `subj:name()`, such as Lua keywords
+			me.line("local " + tmp + " = " + subj)
+			return tmp + luaMemberAccess(member.Name) + "(" + str.Join(append([]string{tmp}, srcs...), ", ") + ")"
+		}
+	}
+	return me.exprPrefix(call.Callee) + "(" + str.Join(srcs, ", ") + ")"
+}
+
+// for the call `src` failing with errors but not handled by `?!`: emits, right before the current statement, its
+// call and the propagation of any error it fails with (to the caller of the enclosing func), returning its value
+func (me *luaGen) exprPropagated(src string) string {
+	val, err := me.newTmp(), me.newTmp()
+	me.line("local " + val + ", " + err + " = " + src)
+	me.line("if " + err + " ~= nil then return nil, " + err + " end")
+	return val
+}
+
+// for callees and subjects of member accesses or indexing, which in Lua must be prefixexps
+func (me *luaGen) exprPrefix(expr session.Expr) string {
+	switch expr.(type) {
+	case *session.ExprIdent, *session.ExprMember, *session.ExprIndex, *session.ExprCall, *session.ExprSelf:
+		return me.expr(expr, luaPrecPrimary)
+	}
+	return "(" + me.expr(expr, 0) + ")"
+}
+
+// loon arrays are 0-based while Lua's are 1-based; dict keys are taken as-is
+func (me *luaGen) exprIndex(index session.Expr) string {
+	if lit, _ := index.(*session.ExprLit); lit != nil {
+		switch val := lit.Val.(type) {
+		case uint64:
+			if val < math.MaxInt64 {
+				return strconv.FormatUint(val+1, 10)
+			}
+		case int64:
+			return strconv.FormatInt(val+1, 10)
+		case string:
+			return luaLit(lit)
+		}
+	}
+	return me.expr(index, luaPrecAdd+1) + " + 1"
+}
+
+// `subj[rng]` as `string.sub` for strs, else via the `__loon_sub__` helper
+func (me *luaGen) exprSlice(subj session.Expr, rng *session.ExprRange) string {
+	src := me.expr(subj, 0)
+	from, to, step := me.exprSliceBounds(rng, "")
+	if _, is_str := subj.Base().Type.(ty.TypeStr); (rng.Step == nil) && (is_str || (me.kindOf(subj) == luaKindStr)) {
+		return "string.sub(" + src + ", " + from + util.If(to == "", "", ", "+to) + ")"
+	}
+	return me.helper("__loon_sub__") + "(" + src + ", " + from + ", " + util.If(to == "", "nil", to) + ", " + step + ")"
+}
+
+// the 1-based inclusive Lua bounds of slicing by `rng`, with an open-ended upper bound being `#items`
+// (or empty if no `items` given)
+func (me *luaGen) exprSliceBounds(rng *session.ExprRange, items string) (from string, to string, step string) {
+	from, step = "1", "1"
+	if rng.From != nil {
+		from = me.exprIndex(rng.From)
+	}
+	if rng.Step != nil {
+		step = me.expr(rng.Step, 0)
+	}
+	switch {
+	case rng.To == nil:
+		to = util.If(items == "", "", "#"+items)
+	case rng.IsExclusive: // the 0-based exclusive `n` is the 1-based inclusive `n`
+		to = me.expr(rng.To, 0)
+	default:
+		to = me.exprIndex(rng.To)
+	}
+	return
+}
+
+// the Lua `for` bounds, with `..`'s exclusive upper bound made inclusive
+func (me *luaGen) exprRangeBounds(rng *session.ExprRange) (from string, to string, step string) {
+	from, to, step = me.expr(rng.From, 0), me.expr(rng.To, util.If(rng.IsExclusive, luaPrecAdd+1, 0)), "1"
+	if rng.Step != nil {
+		step = me.expr(rng.Step, 0)
+	}
+	if rng.IsExclusive {
+		to += util.If(str.Begins(step, "-"), " + 1", " - 1")
+	}
+	return
+}
+
+func (me *luaGen) exprDict(dict *session.ExprDict) string {
+	if len(dict.Entries) == 0 {
+		return "{}"
+	}
+	if sl.Any(dict.Entries, func(it *session.ExprDictEntry) bool { _, is := it.Val.(*session.ExprSpread); return is }) {
+		var args []string
+		run := &session.ExprDict{ExprBase: dict.ExprBase}
+		for _, entry := range dict.Entries {
+			if spread, _ := entry.Val.(*session.ExprSpread); spread == nil {
+				run.Entries = append(run.Entries, entry)
+			} else {
+				if len(run.Entries) > 0 {
+					args, run = append(args, me.exprDict(run)), &session.ExprDict{ExprBase: dict.ExprBase}
+				}
+				args = append(args, me.expr(spread.Subj, 0))
+			}
+		}
+		if len(run.Entries) > 0 {
+			args = append(args, me.exprDict(run))
+		}
+		return me.helper("__loon_merge__") + "(" + str.Join(args, ", ") + ")"
+	}
+	is_multi_line := (dict.Toks.Span().Start.Line != dict.Toks.Span().End.Line)
+	if is_multi_line {
+		me.indent++
+	}
+	entries := sl.To(dict.Entries, func(entry *session.ExprDictEntry) string {
+		var key string
+		var str_key string
+		var is_str_key bool
+		if lit, _ := entry.Key.(*session.ExprLit); lit != nil {
+			str_key, is_str_key = lit.Val.(string)
+		}
+		switch {
+		case entry.Name != "":
+			key = luaDictKey(entry.Name)
+		case is_str_key:
+			key = luaDictKey(str_key)
+		case entry.Key != nil:
+			key = "[" + me.expr(entry.Key, 0) + "] = "
+		}
+		return key + me.expr(entry.Val, 0)
+	})
+	if !is_multi_line {
+		return "{ " + str.Join(entries, ", ") + " }"
+	}
+	me.indent--
+	ind := str.Repeat(luaIndent, me.indent)
+	return "{\n" + ind + luaIndent + str.Join(entries, ",\n"+ind+luaIndent) + "\n" + ind + "}"
+}
+
+func (me *luaGen) exprTable(items session.Exprs) string {
+	if len(items) == 0 {
+		return "{}"
+	}
+	if luaHasSpreads(items) {
+		var args []string
+		var run session.Exprs
+		for _, item := range items {
+			if spread, _ := item.(*session.ExprSpread); spread == nil {
+				run = append(run, item)
+			} else {
+				if len(run) > 0 {
+					args, run = append(args, me.exprTable(run)), nil
+				}
+				args = append(args, me.expr(spread.Subj, 0))
+			}
+		}
+		if len(run) > 0 {
+			args = append(args, me.exprTable(run))
+		}
+		return me.helper("__loon_concat__") + "(" + str.Join(args, ", ") + ")"
+	}
+	return "{ " + str.Join(sl.To(items, func(it session.Expr) string { return me.expr(it, 0) }), ", ") + " }"
+}
+
+func (me *luaGen) exprFunc(fn *session.ExprFunc, leadingParams ...string) string {
+	body := me.sub(me.indent + 1)
+	params := str.Join(append(leadingParams, body.params(fn.Params, fn.ParamDefaults)...), ", ")
+	if len(fn.Body) == 0 {
+		return "function(" + params + ") end"
+	}
+	if fn_type, _ := fn.Type.(*ty.TypeFun); fn_type != nil {
+		_, body.errReturns = fn_type.Ret.(*ty.TypeErrUnion)
+	}
+	body.stmts(fn.Body, luaDst{isReturn: true})
+	return "function(" + params + ")\n" + body.out.String() + str.Repeat(luaIndent, me.indent) + "end"
+}
+
+// the Lua names of the func (or loop body) `params`, with destructuring ones (see `stmtDestructure`) being
+// tmps that are destructured by the (so far) emitted statements of `me`, the body. These first set any
+// omitted params to their `defaults` (if any), in order, so that a default can use the params before it
+func (me *luaGen) params(params session.Exprs, defaults session.Exprs) (ret []string) {
+	for i, param := range params {
+		name := ""
+		if luaIsPattern(param) {
+			name = me.newTmp()
+		} else {
+			name = me.expr(param, 0)
+			me.kinds[name] = luaKindNone
+		}
+		if (i < len(defaults)) && (defaults[i] != nil) {
+			me.line("if " + name + " == " + me.helper("__loon_omitted_fn_arg__") + " then")
+			me.nested(func() { me.stmt(defaults[i], luaDst{assignTo: name}) })
+			me.line("end")
+		}
+		if luaIsPattern(param) {
+			me.stmtDestructure(param, name, true)
+		}
+		ret = append(ret, name)
+	}
+	return
+}
+
+// `foo && bar` or `foo || bar` where `bar` `needsHoisting`: computed by an `if` into a fresh local right before the
+// current statement, so that `bar`'s hoisted statements run only if it gets evaluated
+func (me *luaGen) exprShortCircuit(it *session.ExprOpBinary) string {
+	tmp := me.newTmp()
+	me.line("local " + tmp + " = " + me.expr(it.Lhs, 0))
+	me.line("if " + util.If(it.Op == "&&", tmp, "not "+tmp) + " then")
+	me.nested(func() { me.line(tmp + " = " + me.expr(it.Rhs, 0)) })
+	me.line("end")
+	return tmp
+}
+
+// emits the statement(s) computing `expr` into a fresh local right before the current statement
+func (me *luaGen) exprHoisted(expr session.Expr) string {
+	tmp := me.newTmp()
+	me.line("local " + tmp)
+	if loop, is := expr.(*session.ExprLoop); is {
+		me.stmtLoop(loop, luaDst{assignTo: tmp})
+	} else {
+		me.stmt(expr, luaDst{assignTo: tmp})
+	}
+	return tmp
+}
+
+// whether `cond` can be expressed as Lua's `cond and then_val or else_val`
+func (me *luaGen) isInlinable(expr session.Expr) bool {
+	cond, _ := expr.(*session.ExprCond)
+	if (cond == nil) || (cond.Else == nil) {
+		return false
+	}
+	for _, branch := range []session.Expr{cond.Then, cond.Else} {
+		switch branch.(type) {
+		case *session.ExprBlock, *session.ExprReturn, *session.ExprContinue:
+			return false
+		}
+		if _, is_cond := branch.(*session.ExprCond); is_cond && !me.isInlinable(branch) {
+			return false
+		}
+	}
+	switch it := cond.Then.(type) {
+	case *session.ExprLit:
+		return (it.Val != nil) && (it.Val != false)
+	case *session.ExprArr, *session.ExprTuple, *session.ExprFunc:
+		return true
+	case *session.ExprOpBinary:
+		_, is_arith := luaOpsBinary[it.Op]
+		return is_arith && (luaOpsBinary[it.Op].prec >= luaPrecBitOr)
+	}
+	return false
+}
+
+// whether `expr`, if emitted as an operand, would need parens in most contexts
+func (me *luaGen) isInlineCompound(expr session.Expr) bool {
+	switch expr.(type) {
+	case *session.ExprOpBinary, *session.ExprOpUnary, *session.ExprCond, *session.ExprStrInterp:
+		return true
+	}
+	return false
+}
+
+// a purely syntactic guess of what `expr` evaluates to
+func (me *luaGen) kindOf(expr session.Expr) luaKind {
+	if kind := luaKindOfType(expr.Base().Type); kind != luaKindNone {
+		return kind
+	}
+	switch it := expr.(type) {
+	case *session.ExprIdent:
+		return me.kinds[it.Name]
+	case *session.ExprLit:
+		switch it.Val.(type) {
+		case bool:
+			return luaKindBool
+		case string, rune:
+			return luaKindStr
+		case int64, uint64, float64:
+			return luaKindNum
+		}
+	case *session.ExprStrInterp:
+		return luaKindStr
+	case *session.ExprArr, *session.ExprTuple, *session.ExprRange:
+		return luaKindArr
+	case *session.ExprDict:
+		return luaKindDict
+	case *session.ExprFunc:
+		return luaKindFunc
+	case *session.ExprIndex:
+		if _, is_filter := it.Index.(*session.ExprFunc); is_filter {
+			return luaKindArr
+		} else if _, is_slice := it.Index.(*session.ExprRange); is_slice {
+			_, is_str := it.Subj.Base().Type.(ty.TypeStr)
+			return util.If(is_str || (me.kindOf(it.Subj) == luaKindStr), luaKindStr, luaKindArr)
+		}
+	case *session.ExprCall:
+		if _, subj := it.TypeTest(); subj != nil {
+			return luaKindBool
+		} else if type_name, subj := it.Conversion(); subj != nil {
+			return util.If(type_name == "Str", luaKindStr, luaKindNum)
+		}
+	case *session.ExprOpUnary:
+		return util.If(it.Op == "!", luaKindBool, luaKindNum)
+	case *session.ExprOpBinary:
+		kind_lhs, kind_rhs := me.kindOf(it.Lhs), me.kindOf(it.Rhs)
+		switch luaOpsBinary[it.Op].prec {
+		case luaPrecOr, luaPrecAnd, luaPrecCmp:
+			return luaKindBool
+		}
+		switch {
+		case (it.Op == "+") && ((kind_lhs == luaKindStr) || (kind_rhs == luaKindStr)):
+			return luaKindStr
+		case ((it.Op == "&") || (it.Op == "|")) && ((kind_lhs == luaKindBool) || (kind_rhs == luaKindBool)):
+			return luaKindBool
+		}
+		return luaKindNum
+	case *session.ExprCond:
+		if kind := me.kindOf(it.Then); (it.Else != nil) && (kind == me.kindOf(it.Else)) {
+			return kind
+		}
+	}
+	return luaKindNone
+}
+
+// the `luaKind` of all values of type `t`, if any: so none for type vars not inferred further, or for unions of
+// types of different kinds
+func luaKindOfType(t ty.Type) luaKind {
+	switch t := t.(type) {
+	case ty.TypeBool:
+		return luaKindBool
+	case ty.TypeInt, ty.TypeFloat:
+		return luaKindNum
+	case ty.TypeStr:
+		return luaKindStr
+	case *ty.TypeArr, *ty.TypeTuple:
+		return luaKindArr
+	case *ty.TypeDict:
+		return luaKindDict
+	case *ty.TypeFun:
+		return luaKindFunc
+	case *ty.TypeUnion:
+		kind := luaKindOfType(t.Types[0])
+		for _, it := range t.Types[1:] {
+			if luaKindOfType(it) != kind {
+				return luaKindNone
+			}
+		}
+		return kind
+	}
+	return luaKindNone
+}
+
+func luaIdent(name string) string {
+	if sl.Has(luaKeywords, name) {
+		return name + "_"
+	}
+	var buf strings.Builder
+	for i, r := range name {
+		switch {
+		case (r == '_') || ((r >= 'a') && (r <= 'z')) || ((r >= 'A') && (r <= 'Z')) || ((i > 0) && (r >= '0') && (r <= '9')):
+			buf.WriteRune(r)
+		case (i == 0) && (r == '@'):
+			buf.WriteString("_at_")
+		default:
+			buf.WriteString("_" + strconv.FormatInt(int64(r), 36) + "_")
+		}
+	}
+	return buf.String()
+}
+
+// whether `call` is of a func failing with errors, as per the session's type inference
+func luaCallFails(call *session.ExprCall) bool {
+	if fn, _ := call.Callee.Base().Type.(*ty.TypeFun); fn != nil {
+		_, fails := fn.Ret.(*ty.TypeErrUnion)
+		return fails
+	}
+	return false
+}
+
+// `[foo...bar]` is the same as just `foo...bar`
+func luaArrRange(arr *session.ExprArr) *session.ExprRange {
+	if len(arr.Items) == 1 {
+		rng, _ := arr.Items[0].(*session.ExprRange)
+		return rng
+	}
+	return nil
+}
+
+// whether `lhs` (of a `:=`, `=` or func param) needs destructuring, rather than being a name (or, for `=`, other
+// assignable) or a tuple of such that Lua's own multiple assignment handles
+func luaIsDestructuring(lhs session.Expr) bool {
+	switch it := lhs.(type) {
+	case *session.ExprArr, *session.ExprDict:
+		return true
+	case *session.ExprTuple:
+		return sl.Any(it.Items, func(item session.Expr) bool {
+			_, is_spread := item.(*session.ExprSpread)
+			return is_spread || luaIsPattern(item)
+		})
+	}
+	return false
+}
+
+func luaHasSpreads(items session.Exprs) bool {
+	return sl.Any(items, func(it session.Expr) bool {
+		_, is := it.(*session.ExprSpread)
+		return is
+	})
+}
+
+func luaIsPattern(expr session.Expr) bool {
+	switch expr.(type) {
+	case *session.ExprArr, *session.ExprDict, *session.ExprTuple:
+		return true
+	}
+	return false
+}
+
+func luaDictKey(name string) string {
+	if ident := luaIdent(name); ident == name {
+		return name + " = "
+	}
+	return "[" + luaStr(name) + "] = "
+}
+
+func luaParensed(src string, needsParens bool) string {
+	return util.If(needsParens, "("+src+")", src)
+}
+
+func luaMemberAccess(name string) string {
+	if ident := luaIdent(name); ident == name {
+		return "." + name
+	}
+	return "[" + luaStr(name) + "]"
+}
+
+func luaLit(lit *session.ExprLit) string {
+	switch it := lit.Val.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return str.FromBool(it)
+	case int64:
+		return str.FromI64(it, 10)
+	case uint64:
+		if it > math.MaxInt64 {
+			return "0x" + str.FromU64(it, 16)
+		}
+		return str.FromU64(it, 10)
+	case float64:
+		if src := lit.Toks[0].Src; (len(lit.Toks) == 1) && !strings.ContainsAny(src, "_xXpP") {
+			return src
+		}
+		return str.FromFloat(it, -1)
+	case rune:
+		return luaStr(string(it))
+	case string:
+		return luaStr(it)
+	}
+	panic(errors.New(str.GoLike(lit.Val)))
+}
+
+func luaStr(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString("\\n")
+		case '\r':
+			buf.WriteString("\\r")
+		case '\t':
+			buf.WriteString("\\t")
+		default:
+			if (c < 32) || (c == 127) {
+				buf.WriteString(str.Fmt("\\%03d", c))
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,101 @@
+package codegen
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"loon/session"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden `.lua` files in testdata/ from the current output")
+
+// every testdata/foo/ dir holds a foo.ls (mostly lang.md examples) and its expected Lua output in foo.lua, which
+// for dirs also holding other .ls files is that of the whole pack, with foo.ls as its main file
+func TestLuaGolden(t *testing.T) {
+	dir_paths, err := filepath.Glob(filepath.Join("testdata", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir_path := range dir_paths {
+		name := filepath.Base(dir_path)
+		t.Run(name, func(t *testing.T) {
+			dir_path, err := filepath.Abs(dir_path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src_file_path, golden_file_path := filepath.Join(dir_path, name+".ls"), filepath.Join(dir_path, name+".lua")
+
+			var src_lua string
+			session.Access(func(sess session.StateAccess, _ session.Intel) {
+				pack := sess.GetSrcPack(dir_path, true)
+				if pack == nil {
+					t.Fatal("no pack at " + dir_path)
+				}
+				for _, src_file := range pack.Files {
+					for _, diag := range sess.AllCurrentSrcFileDiags()[src_file.FilePath] {
+						if diag.Kind == session.DiagKindErr {
+							t.Error(diag.LocStr(src_file.FilePath) + ": " + diag.String())
+						}
+					}
+				}
+				if !t.Failed() {
+					src_lua, _, err = LuaPack(pack, src_file_path, false)
+				}
+			})
+			if t.Failed() {
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if *updateGolden {
+				if err = os.WriteFile(golden_file_path, []byte(src_lua), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			golden, err := os.ReadFile(golden_file_path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(golden) != src_lua {
+				t.Errorf("got:\n%s\nexpected (from %s):\n%s", src_lua, golden_file_path, golden)
+			}
+		})
+	}
+}
+
+func TestLuaSrcMap(t *testing.T) {
+	dir_path, err := filepath.Abs(filepath.Join("testdata", "funcs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src_map *LuaSrcMap
+	session.Access(func(sess session.StateAccess, _ session.Intel) {
+		_, src_map, err = LuaPack(sess.GetSrcPack(dir_path, true), "", false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src_file_path, lua_file_path := filepath.Join(dir_path, "funcs.ls"), "/tmp/some/where/funcs.lua"
+	for lua_line, expected := range map[int]string{
+		2:  "1,16-1,21",  // my_function = function() end
+		5:  "4,17-4,37",  // return print("hello world")
+		6:  "4,17-4,37",  // end
+		9:  "8,3-8,29",   // return print("The value:", value)
+		11: "10,8-10,37", // sum = function(x, y)
+	} {
+		if path, span := src_map.Lookup(lua_line); (path != src_file_path) || (span == nil) || (span.String() != expected) {
+			t.Errorf("Lua line %d: expected %s, got %s %v", lua_line, expected, path, span)
+		}
+	}
+
+	traceback := "lua: " + lua_file_path + ":5: attempt to call a nil value (global 'print')\n\t...e/where/funcs.lua:9: in function 'func_b'\n\t[C]: in ?"
+	expected := "lua: " + src_file_path + ":4,17-4,37: attempt to call a nil value (global 'print')\n\t" + src_file_path + ":8,3-8,29: in function 'func_b'\n\t[C]: in ?"
+	if rewritten := src_map.RewriteTraceback(lua_file_path, traceback); rewritten != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", rewritten, expected)
+	}
+}
@@ -0,0 +1,119 @@
+package codegen
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"loon/session"
+	"loon/util/str"
+)
+
+// LuaSrcMap maps lines of generated Lua code back to the loon source spans they were generated from.
+type LuaSrcMap struct {
+	SrcFilePaths []string
+	Lines        []LuaSrcMapLine // sorted by `LuaLine`
+}
+
+type LuaSrcMapLine struct {
+	LuaLine    int // starts at 1
+	LuaCol     int // starts at 1
+	SrcFileIdx int // into `LuaSrcMap.SrcFilePaths`, or -1 for lines (such as runtime helpers) not from any source
+	Span       session.SrcFileSpan
+}
+
+// matches Lua's `chunkname:line:` locations as found in error messages and tracebacks,
+// where long chunk names are shortened by Lua to a `...`-prefixed suffix
+var luaSrcMapLocRegex = regexp.MustCompile(`(\.\.\.)?([^\s:'"]+):(\d+):`)
+
+// prefixes a line of emitted Lua (after its indentation) during generation, referring to the span of its originating statement
+func luaSrcMapMarker(spanIdx int) string {
+	return "\x00" + strconv.Itoa(spanIdx) + "\x00"
+}
+
+// strips all `luaSrcMapMarker`s from `srcLua`, recording them in the returned `LuaSrcMap`
+func luaSrcMapFrom(srcLua string, srcFilePath string, spans []*session.SrcFileSpan) (string, *LuaSrcMap) {
+	ret := &LuaSrcMap{SrcFilePaths: []string{srcFilePath}}
+	lines := str.Split(srcLua, "\n")
+	for i, line := range lines {
+		idx_start := str.Idx(line, 0)
+		if idx_start < 0 {
+			if i == 0 { // so that `Lookup`s of the helpers prelude won't find the lines of a preceding file
+				ret.Lines = append(ret.Lines, LuaSrcMapLine{LuaLine: 1, LuaCol: 1, SrcFileIdx: -1})
+			}
+			continue
+		}
+		idx_end := idx_start + 1 + str.Idx(line[idx_start+1:], 0)
+		span_idx, err := str.ToInt(line[idx_start+1 : idx_end])
+		if err != nil {
+			panic(err)
+		}
+		lines[i] = line[:idx_start] + line[idx_end+1:]
+		ret.Lines = append(ret.Lines, LuaSrcMapLine{LuaLine: i + 1, LuaCol: idx_start + 1, Span: *spans[span_idx]})
+	}
+	return str.Join(lines, "\n"), ret
+}
+
+// LuaSrcMapLoad reads the `LuaSrcMap` that `LuaSrcMap.Save` wrote for `luaFilePath`.
+func LuaSrcMapLoad(luaFilePath string) (*LuaSrcMap, error) {
+	data, err := os.ReadFile(luaFilePath + ".map")
+	if err != nil {
+		return nil, err
+	}
+	var ret LuaSrcMap
+	if err = json.Unmarshal(data, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Save writes `me` next to `luaFilePath` into a `.lua.map` JSON file.
+func (me *LuaSrcMap) Save(luaFilePath string) error {
+	data, err := json.Marshal(me)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(luaFilePath+".map", data, 0o644)
+}
+
+// appends `it`, whose Lua lines come after the `numLuaLines` lines already mapped by `me`
+func (me *LuaSrcMap) append(it *LuaSrcMap, numLuaLines int) {
+	idx_offset := len(me.SrcFilePaths)
+	me.SrcFilePaths = append(me.SrcFilePaths, it.SrcFilePaths...)
+	for _, line := range it.Lines {
+		line.LuaLine += numLuaLines
+		if line.SrcFileIdx >= 0 {
+			line.SrcFileIdx += idx_offset
+		}
+		me.Lines = append(me.Lines, line)
+	}
+}
+
+// Lookup returns the source location that generated the Lua line `luaLine` or, if that line
+// (such as an `end`) has none, the closest preceding one. The result is empty if there is none.
+func (me *LuaSrcMap) Lookup(luaLine int) (srcFilePath string, span *session.SrcFileSpan) {
+	idx := sort.Search(len(me.Lines), func(i int) bool { return me.Lines[i].LuaLine > luaLine }) - 1
+	if (idx < 0) || (me.Lines[idx].SrcFileIdx < 0) {
+		return "", nil
+	}
+	line := &me.Lines[idx]
+	return me.SrcFilePaths[line.SrcFileIdx], &line.Span
+}
+
+// RewriteTraceback replaces all of `luaFilePath`'s `chunkname:line:` locations
+// in `traceback` (a Lua error message or stack traceback) with their source locations.
+func (me *LuaSrcMap) RewriteTraceback(luaFilePath string, traceback string) string {
+	return luaSrcMapLocRegex.ReplaceAllStringFunc(traceback, func(match string) string {
+		groups := luaSrcMapLocRegex.FindStringSubmatch(match)
+		if chunk_name := groups[2]; (chunk_name == luaFilePath) || ((groups[1] != "") && str.Ends(luaFilePath, chunk_name)) {
+			if lua_line, err := str.ToInt(groups[3]); err == nil {
+				if src_file_path, span := me.Lookup(lua_line); span != nil {
+					return span.LocStr(src_file_path) + ":"
+				}
+			}
+		}
+		return match
+	})
+}
@@ -0,0 +1,42 @@
+local my_function, some_args, first_of
+local __loon_omitted_fn_arg__ = nil
+local function __loon_slice__(items, from, num_after)
+  local ret = {}
+  for i = from, #items - num_after do
+    ret[#ret + 1] = items[i]
+  end
+  return ret
+end
+my_function = function(name, height)
+  if name == __loon_omitted_fn_arg__ then
+    name = "something"
+  end
+  if height == __loon_omitted_fn_arg__ then
+    height = 100
+  end
+  print("Hello I am", name)
+  return print("My height is", height)
+end
+my_function()
+my_function("Bob")
+some_args = function(x, y)
+  if x == __loon_omitted_fn_arg__ then
+    x = 100
+  end
+  if y == __loon_omitted_fn_arg__ then
+    y = x + 1000
+  end
+  return print(x + y)
+end
+some_args(1)
+first_of = function(_tmp_0, label)
+  if _tmp_0 == __loon_omitted_fn_arg__ then
+    _tmp_0 = { 1, 2 }
+  end
+  local first = _tmp_0[1]
+  if label == __loon_omitted_fn_arg__ then
+    label = "first"
+  end
+  return print(label, first)
+end
+first_of()
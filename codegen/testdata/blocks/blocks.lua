@@ -0,0 +1,13 @@
+local someRandomBool, three
+someRandomBool = function()
+  return math.random() > 0.5
+end
+do
+  local tmp = 1 + 2
+  if someRandomBool() then
+    three = tmp
+  else
+    three = "three"
+  end
+end
+print(three)
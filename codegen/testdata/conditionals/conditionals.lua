@@ -0,0 +1,19 @@
+local have_coins, obj
+have_coins = false
+if have_coins then
+  print("Got coins")
+else
+  print("No coins")
+end
+print(have_coins and "Got coins" or "No coins")
+obj = { field = 1 }
+if obj then
+  print(obj.field)
+end
+if have_coins then
+  print("rich")
+elseif obj.field > 0 then
+  print("obj")
+else
+  print("neither")
+end
@@ -0,0 +1,15 @@
+local answer, ratio, label, parse
+local function __loon_to__(val, type_name)
+  local num = tonumber(val)
+  if (num == nil) or (type_name == "Float") then
+    return num and (num + 0.0)
+  end
+  return (num % 1 == 0) and math.floor(num) or nil
+end
+answer = __loon_to__("42", "Int")
+ratio = __loon_to__(3, "Float")
+label = tostring(answer) .. "!"
+parse = function(src)
+  return __loon_to__(src, "Int")
+end
+print(parse("12"), __loon_to__("1e3", "Float"), tostring(ratio * 2))
@@ -0,0 +1,10 @@
+local hello, a, b, c, locals
+hello = "world"
+a, b, c = 1, 2, 3
+hello = 123
+print(hello ~= a, b, c)
+locals = function()
+  local kept = math.random()
+  return print("locals")
+end
+locals()
@@ -0,0 +1,58 @@
+local one, two, rest, first, last, zStr, zNums, zBool, fn, sum, obj, alias, x, y, more, entries
+local function __loon_concat__(...)
+  local ret = {}
+  for i = 1, select("#", ...) do
+    for _, item in ipairs((select(i, ...))) do
+      ret[#ret + 1] = item
+    end
+  end
+  return ret
+end
+local function __loon_merge__(...)
+  local ret = {}
+  for i = 1, select("#", ...) do
+    for key, val in pairs((select(i, ...))) do
+      ret[key] = val
+    end
+  end
+  return ret
+end
+local function __loon_slice__(items, from, num_after)
+  local ret = {}
+  for i = from, #items - num_after do
+    ret[#ret + 1] = items[i]
+  end
+  return ret
+end
+local _tmp_0 = { 1, 2.0, "3", "4" }
+one, two, rest = _tmp_0[1], _tmp_0[2], __loon_slice__(_tmp_0, 3, 0)
+local _tmp_1
+do
+  _tmp_1 = { first = "Donald", middle = "F.", last = "Duck" }
+end
+first, last = _tmp_1.first, _tmp_1.last
+local _tmp_2 = { "", 0, 0.0, false }
+zStr, zNums, zBool = _tmp_2[1], __loon_slice__(_tmp_2, 2, 1), _tmp_2[#_tmp_2]
+fn = function(_tmp_3)
+  local a, b = _tmp_3.a, _tmp_3.b
+  return a + b
+end
+sum = fn({ a = 1, b = 2 })
+obj = { one = 1, two = 2, three = 3 }
+obj = __loon_merge__(obj, { two = "2", three = 3.0 })
+obj = __loon_merge__(obj, { two = "2", three = 4.0 })
+alias = obj
+obj = __loon_merge__(obj, { one = 11 })
+print(alias.one, obj.one)
+local _tmp_4 = { 1, 2 }
+x, y = _tmp_4[1], _tmp_4[2]
+local _tmp_5 = { y, x }
+x, y = _tmp_5[1], _tmp_5[2]
+more = __loon_concat__({ 0 }, rest, { 5 })
+entries = { { 1, { name = "one" } }, { 2, { name = "two" } } }
+for _, _tmp_6 in ipairs(entries) do
+  local _tmp_7 = _tmp_6[2]
+  local num = _tmp_6[1]
+  local name = _tmp_7.name
+  print(num, name)
+end
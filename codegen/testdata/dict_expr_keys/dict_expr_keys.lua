@@ -0,0 +1,10 @@
+local t, config
+t = {
+  [1 + 2] = "three",
+  ["hello world"] = true
+}
+config = {
+  name = "loon",
+  version = 1,
+  nested = { deep = true }
+}
@@ -0,0 +1,8 @@
+local print_table, hair, height, person
+print_table = function(t)
+  return print(t)
+end
+hair = "golden"
+height = 200
+person = { hair = hair, height = height, shoe_size = 40 }
+print_table({ hair = hair, height = height })
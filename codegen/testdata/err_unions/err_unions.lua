@@ -0,0 +1,67 @@
+local parse_num, doubled, fallback, positive, negative, picked, sign
+parse_num = function(src)
+  if src == "" then
+    return nil, "empty input"
+  end
+  return tonumber(src), nil
+end
+doubled = function(src)
+  local _tmp_0, _tmp_1 = parse_num(src)
+  if _tmp_1 ~= nil then return nil, _tmp_1 end
+  local num = _tmp_0
+  return num * 2, nil
+end
+local _tmp_2, _tmp_3 = doubled("21")
+if _tmp_3 ~= nil then
+  local err = _tmp_3
+  _tmp_2 = "Error: " .. err
+end
+print(_tmp_2)
+local _tmp_4, _tmp_5 = doubled("")
+if _tmp_5 ~= nil then
+  local err = _tmp_5
+  print("Error: " .. err)
+end
+local _tmp_6, _tmp_7 = parse_num("nope")
+if _tmp_7 ~= nil then
+  _tmp_6 = 0
+end
+fallback = _tmp_6
+positive = function(flag)
+  local _tmp_8 = flag
+  if _tmp_8 then
+    local _tmp_9, _tmp_10 = parse_num("1")
+    if _tmp_10 ~= nil then return nil, _tmp_10 end
+    _tmp_8 = _tmp_9 > 0
+  end
+  return _tmp_8, nil
+end
+negative = function(flag)
+  local _tmp_11 = flag
+  if not _tmp_11 then
+    local _tmp_12, _tmp_13 = parse_num("-1")
+    if _tmp_13 ~= nil then return nil, _tmp_13 end
+    _tmp_11 = _tmp_12 < 0
+  end
+  return _tmp_11, nil
+end
+picked = function(flag)
+  if flag then
+    return parse_num("1")
+  else
+    return parse_num("2")
+  end
+end
+sign = function(num)
+  if num > 0 then
+    return print("positive"), nil
+  else
+    local _tmp_14, _tmp_15 = parse_num("0")
+    if _tmp_15 ~= nil then return nil, _tmp_15 end
+    if num < _tmp_14 then
+      return print("negative"), nil
+    else
+      return print("zero"), nil
+    end
+  end
+end
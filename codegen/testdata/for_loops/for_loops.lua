@@ -0,0 +1,60 @@
+local some_dict, some_arr, my_numbers, indices, keys, lengths
+local function __loon_iter__(items)
+  if (#items == 0) and (next(items) ~= nil) then
+    return pairs(items)
+  end
+  local i = 0
+  return function()
+    i = i + 1
+    if i <= #items then
+      return i - 1, items[i]
+    end
+  end
+end
+local function __loon_range__(from, to, step)
+  local ret = {}
+  for i = from, to, step do
+    ret[#ret + 1] = i
+  end
+  return ret
+end
+some_dict = { one = 1, two = 2 }
+some_arr = { "a", "b", "c" }
+for key, value in pairs(some_dict) do
+  print(key, value)
+end
+for _tmp_0, item in ipairs(some_arr) do
+  local i = _tmp_0 - 1
+  print(i, item)
+end
+for _, item in ipairs(some_arr) do
+  print(item)
+end
+for n = 10, 20 do
+  print(n)
+end
+for n = 1, 15, 2 do
+  print(n)
+end
+for i = 0, 3 - 1 do
+  local n = i
+  print(i, n)
+end
+for n = 1, 6 do
+  print(n)
+end
+my_numbers = __loon_range__(1, 6, 1)
+indices = function(arr)
+  for i, x in __loon_iter__(arr) do
+  end
+end
+keys = function(dict)
+  for k, v in __loon_iter__(dict) do
+  end
+end
+lengths = function(strs)
+  for _, s in ipairs(strs) do
+    s:len()
+  end
+end
+print(indices({ 7, 8 }), keys({ a = 1 }), lengths({ "x" }))
@@ -0,0 +1,41 @@
+local offset, greeting, Pet, pet, main, helper, isEven, isOdd
+local function __loon_struct__(...)
+  local ret, embeds = {}, { ... }
+  ret.__index = ret
+  return setmetatable(ret, { __index = function(_, key)
+    for _, embed in ipairs(embeds) do
+      local val = embed[key]
+      if val ~= nil then
+        return val
+      end
+    end
+  end })
+end
+offset = 22
+greeting = function(n)
+  return "hello " .. tostring(n) .. " from " .. pet.name
+end
+Pet = __loon_struct__()
+pet = setmetatable({ name = "Rex" }, Pet)
+main = function()
+  return print(greeting(helper(20)))
+end
+helper = function(n)
+  return n + offset
+end
+isEven = function(n)
+  if n == 0 then
+    return true
+  else
+    return isOdd(n - 1)
+  end
+end
+isOdd = function(n)
+  if n == 0 then
+    return false
+  else
+    return isEven(n - 1)
+  end
+end
+main()
+print(isEven(10), pet.name)
@@ -0,0 +1,30 @@
+local my_function, func_a, func_b, sum, sum2, sum3, mystery, a, b, pair, c, d
+my_function = function() end
+my_function()
+func_a = function()
+  return print("hello world")
+end
+func_b = function()
+  local value = 100
+  return print("The value:", value)
+end
+sum = function(x, y)
+  return print("sum", x + y)
+end
+sum(10, 20)
+print(sum(10, 20))
+sum2 = function(x, y)
+  return x + y
+end
+print("The sum is ", sum2(10, 20))
+sum3 = function(x, y)
+  return x + y
+end
+mystery = function(x, y)
+  return { x + y, x - y }
+end
+local _tmp_0 = mystery(10, 20)
+a, b = _tmp_0[1], _tmp_0[2]
+pair = mystery(1, 2)
+c, d = pair[1], pair[2]
+print(c, d)
@@ -0,0 +1,8 @@
+local name, count
+print("I am " .. tostring(math.random() * 100) .. "% sure.")
+name = "World"
+print("Hello, " .. name .. "!")
+count = 3
+print(name .. " has\n  " .. tostring(count + 1) .. " items, " .. ("nested " .. tostring(count)))
+print("a " .. ("b " .. tostring(count)) .. " c")
+print((count > 2 and "many" or "few") .. "}")
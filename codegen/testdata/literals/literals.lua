@@ -0,0 +1,8 @@
+local some_string, escaped, raw, rune, nums, ops, nothing
+some_string = "Here is a string\n  that has a line break in it."
+escaped = "tab:\t quote:\" backslash:\\"
+raw = "no \\escapes here"
+rune = "ö"
+nums = { 123, 31, 1.5e3, 0.25 }
+ops = not (1 ~= 2) and (3 >= 4 or 2 ^ 3 ^ 2 == 512)
+nothing = nil
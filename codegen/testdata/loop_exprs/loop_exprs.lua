@@ -0,0 +1,100 @@
+local doubled_evens, my_numbers, odds, j, countdown, scaled, three, four
+local function __loon_iter__(items)
+  if (#items == 0) and (next(items) ~= nil) then
+    return pairs(items)
+  end
+  local i = 0
+  return function()
+    i = i + 1
+    if i <= #items then
+      return i - 1, items[i]
+    end
+  end
+end
+local function __loon_range__(from, to, step)
+  local ret = {}
+  for i = from, to, step do
+    ret[#ret + 1] = i
+  end
+  return ret
+end
+do
+  local _tmp_0 = {}
+  local _tmp_1 = 1
+  for i = 1, 20 do
+    if i % 2 == 0 then
+      _tmp_0[_tmp_1] = i * 2
+    else
+      _tmp_0[_tmp_1] = i
+    end
+    _tmp_1 = _tmp_1 + 1
+  end
+  doubled_evens = _tmp_0
+end
+my_numbers = __loon_range__(1, 6, 1)
+for _, n in ipairs(my_numbers) do
+  if n % 2 == 1 then
+    print(n)
+  else
+    goto _continue_2
+  end
+  ::_continue_2::
+end
+do
+  local _tmp_3 = {}
+  local _tmp_4 = 1
+  for _, n in ipairs(my_numbers) do
+    if n % 2 == 1 then
+      _tmp_3[_tmp_4] = n
+    else
+      goto _continue_5
+    end
+    _tmp_4 = _tmp_4 + 1
+    ::_continue_5::
+  end
+  odds = _tmp_3
+end
+j = 3
+do
+  local _tmp_6 = {}
+  local _tmp_7 = 1
+  while j > 0 do
+    j = j - 1
+    _tmp_6[_tmp_7] = tostring(j)
+    _tmp_7 = _tmp_7 + 1
+  end
+  countdown = _tmp_6
+end
+scaled = function(arr)
+  local _tmp_8
+  do
+    local _tmp_9 = {}
+    local _tmp_10 = 1
+    for _, x in __loon_iter__(arr) do
+      _tmp_9[_tmp_10] = x * 2.5
+      _tmp_10 = _tmp_10 + 1
+    end
+    _tmp_8 = _tmp_9
+  end
+  return _tmp_8
+end
+print(#scaled(odds), #countdown)
+do
+  local tmp = 1 + 2
+  if tmp > 2 then
+    three = "big"
+    goto _block_11
+  end
+  three = tmp
+  ::_block_11::
+end
+print(three)
+do
+  if three == "big" then
+    four = 4
+    goto _block_12
+  end
+  four = 0
+  ::_block_12::
+end
+print(four)
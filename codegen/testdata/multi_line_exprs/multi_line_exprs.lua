@@ -0,0 +1,11 @@
+local my_func, cool_func, total
+my_func = function(a, b, c, d, e, f)
+  return a
+end
+cool_func = function(a, b, c, d, e, f, g, h)
+  return h
+end
+my_func(5, 4, 3, 8, 9, 10)
+cool_func(1, 2, 3, 4, 5, 6, 7, 8)
+total = 1 + 2 * 3
+print(total, total - 1)
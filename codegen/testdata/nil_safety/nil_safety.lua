@@ -0,0 +1,42 @@
+local find_user, user, boss_name, shout, loud
+find_user = function(id)
+  if id > 0 then
+    return { name = "Ann", boss = { name = "Bo" } }
+  end
+end
+user = find_user(1)
+print(user and user.name)
+local _tmp_0 = user and user.name
+if _tmp_0 ~= nil then
+  print(_tmp_0)
+end
+local _tmp_1 = find_user(2)
+local _tmp_2 = _tmp_1 and _tmp_1.boss
+boss_name = _tmp_2 and _tmp_2.name
+shout = function(s)
+  return s .. "!"
+end
+local _tmp_3
+if boss_name ~= nil then
+  _tmp_3 = shout(boss_name)
+else
+  _tmp_3 = nil
+end
+loud = _tmp_3
+print(loud)
+local _tmp_4
+local _tmp_5
+local _tmp_6 = find_user(0)
+if _tmp_6 ~= nil then
+  _tmp_5 = (function(__a0__)
+    return __a0__.name
+  end)(_tmp_6)
+else
+  _tmp_5 = nil
+end
+if _tmp_5 ~= nil then
+  _tmp_4 = shout(_tmp_5)
+else
+  _tmp_4 = nil
+end
+print(_tmp_4)
@@ -0,0 +1,67 @@
+local inc, my_numbers, odds, twice
+local function __loon_filter__(items, pred)
+  local ret = {}
+  for _, item in ipairs(items) do
+    if pred(item) then
+      ret[#ret + 1] = item
+    end
+  end
+  return ret
+end
+local function __loon_range__(from, to, step)
+  local ret = {}
+  for i = from, to, step do
+    ret[#ret + 1] = i
+  end
+  return ret
+end
+inc = function(__a0__)
+  return __a0__ + 1
+end
+print(inc(41))
+print((function(__a0__, __a1__)
+  return (__a0__ .. " ") .. string.upper(__a1__)
+end)("Donald", "Duck"))
+my_numbers = __loon_range__(1, 6, 1)
+odds = __loon_filter__(my_numbers, function(__a0__)
+  return __a0__ % 2 == 1
+end)
+for _, n in ipairs(odds) do
+  print(n)
+end
+twice = function(fn)
+  return function(x)
+    return fn(fn(x))
+  end
+end
+print(twice(function(__a0__)
+  return __a0__ * 3
+end)(2))
+for _, __a0__ in ipairs(my_numbers) do
+  if __a0__ % 2 == 1 then
+    local n = __a0__
+    print(n)
+  end
+end
+local _tmp_0 = 0
+for _, __a0__ in ipairs(my_numbers) do
+  if __a0__ % 2 == 1 then
+    local n = __a0__
+    local i = _tmp_0
+    _tmp_0 = _tmp_0 + 1
+    print(i, n)
+  end
+end
+for _, __a0__ in ipairs(my_numbers) do
+  if __a0__ % 2 == 1 then
+    print(__a0__)
+  end
+end
+local _tmp_1 = 0
+for _, n in ipairs(my_numbers) do
+  if n > 3 then
+    local i = _tmp_1
+    _tmp_1 = _tmp_1 + 1
+    print(i, n)
+  end
+end
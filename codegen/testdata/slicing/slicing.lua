@@ -0,0 +1,39 @@
+local items, name, middle, head, tail, evens, short, rest, every_other, from
+local function __loon_sub__(items, from, to, step)
+  local ret, is_str = {}, type(items) == "string"
+  for i = from, to or #items, step do
+    ret[#ret + 1] = is_str and items:sub(i, i) or items[i]
+  end
+  return is_str and table.concat(ret) or ret
+end
+items = { "a", "b", "c", "d", "e" }
+name = "Daniel"
+middle = __loon_sub__(items, 2, 3, 1)
+head = __loon_sub__(items, 1, 2, 1)
+tail = __loon_sub__(items, 3, nil, 1)
+evens = __loon_sub__(items, 1, 5, 2)
+short = string.sub(name, 1, 3)
+rest = string.sub(name, 4)
+every_other = __loon_sub__(name, 1, 6, 2)
+for _tmp_0 = 2, 3 do
+  local item = items[_tmp_0]
+  print(item)
+end
+for _tmp_1 = 3, #items do
+  local i = _tmp_1 - 3
+  local item = items[_tmp_1]
+  print(i, item)
+end
+for _tmp_2 = 1, 5, 2 do
+  local i = (_tmp_2 - 1) // 2
+  local item = items[_tmp_2]
+  print(i, item)
+end
+from = 1
+local _tmp_3 = from + 1
+for _tmp_4 = _tmp_3, #items do
+  local i = _tmp_4 - _tmp_3
+  local item = items[_tmp_4]
+  print(i, item)
+end
+print(__loon_sub__({ 1, 2, 3, 4 }, 1, 2, 1)[2])
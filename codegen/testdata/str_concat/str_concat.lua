@@ -0,0 +1,16 @@
+local join, twice, sum, greet, s
+join = function(a, b)
+  return a .. b
+end
+twice = function(e)
+  return e[1] .. e[1]
+end
+sum = function(a, b)
+  return a + b
+end
+greet = function(names)
+  return "hi " .. names[1]
+end
+s = join("a", "b")
+s = s .. twice({ "x" })
+print(s, sum(1, 2.5), greet({ "y" }))
@@ -0,0 +1,69 @@
+local Person, me, Animal, Pet, Cat, Dog, myCat, myDog, dogS
+local function __loon_merge__(...)
+  local ret = {}
+  for i = 1, select("#", ...) do
+    for key, val in pairs((select(i, ...))) do
+      ret[key] = val
+    end
+  end
+  return ret
+end
+local function __loon_method__(self, name)
+  return function(...)
+    return self[name](self, ...)
+  end
+end
+local function __loon_struct__(...)
+  local ret, embeds = {}, { ... }
+  ret.__index = ret
+  return setmetatable(ret, { __index = function(_, key)
+    for _, embed in ipairs(embeds) do
+      local val = embed[key]
+      if val ~= nil then
+        return val
+      end
+    end
+  end })
+end
+Person = __loon_struct__()
+Person.aStaticField = "Namespaced const"
+Person.aStaticMethod = function()
+  return print("Call made to Person.aStaticMethod()")
+end
+Person.anInstMethod = function(self)
+  return print("I am " .. self.firstName .. " " .. self.lastName .. ".")
+end
+Person.another = function(self)
+  return self:anInstMethod()
+end
+me = setmetatable({ age = 123, firstName = "Donald", lastName = "Duck" }, Person)
+Person.aStaticMethod()
+me:anInstMethod()
+print("Person " .. me.firstName .. " " .. me.lastName .. " is " .. tostring(me.age) .. " years old.")
+Animal = __loon_struct__()
+Animal.isWinged = function(self)
+  return self.numLegs < 4
+end
+Animal.str = function(self)
+  return tostring(self.numLegs) .. "-legged" .. (self.domesticated and ", domesticated" or "")
+end
+Pet = __loon_struct__(Animal)
+Pet.str = function(self)
+  return "Pet named \"" .. self.name .. "\":\n    - needs walking: " .. (self.needsWalking and "yes" or "no") .. "\n    - " .. Animal.str(self)
+end
+Cat = __loon_struct__(Pet)
+Dog = __loon_struct__(Pet)
+myCat = setmetatable({ domesticated = true, needsWalking = false, numLegs = 4, name = "Felix" }, Cat)
+myDog = setmetatable({ domesticated = true, needsWalking = true, numLegs = 4, name = "Rufus" }, Dog)
+print(myCat:str())
+dogS = __loon_method__(myDog, "str")
+print(dogS())
+Cat.isLikelyChallenging = function(self)
+  return self.lovesKeyboards
+end
+Dog.isLikelyChallenging = function(self)
+  return self.chasesMailMen
+end
+print(myCat:isLikelyChallenging(), myDog:isWinged())
+myCat = setmetatable(__loon_merge__(myCat, { lovesKeyboards = true }), getmetatable(myCat))
+print(myCat:isLikelyChallenging(), ("Felix"):lower(), myCat.name:len())
@@ -0,0 +1,64 @@
+local name, three, num, point, flag
+local function __loon_is__(val, type_name)
+  local lua_type = type(val)
+  if type_name == "Bool" then
+    return lua_type == "boolean"
+  elseif type_name == "Str" then
+    return lua_type == "string"
+  end
+  return math.type(val) == ((type_name == "Int") and "integer" or "float")
+end
+local function __loon_slice__(items, from, num_after)
+  local ret = {}
+  for i = from, #items - num_after do
+    ret[#ret + 1] = items[i]
+  end
+  return ret
+end
+name = "Dan"
+local _ = name
+if name == "Robert" then
+  print("You are Robert")
+elseif name == "Dan" or name == "Daniel" then
+  print("Your name...")
+  print("...it's Dan!")
+elseif name == "Bob" or name == "Rob" then
+  print("Another Robert")
+elseif _:len() > 3 and string.sub(_, 1, 3):lower() == "dan" then
+  print("You danish?")
+else
+  local _other = name
+  print("Unhandled name '" .. _other .. "'")
+end
+three = math.random() < 0.5 and 3 or "three"
+local _ = three
+if __loon_is__(_, "Int") then
+  num = three * 2
+elseif __loon_is__(_, "Str") then
+  num = 0
+end
+print(num)
+point = { math.random(3), 2 }
+local _tmp_0
+if type(point) == "table" and #point == 2 and point[1] == 1 then
+  local _y = point[2]
+  _tmp_0 = _y
+elseif type(point) == "table" and #point == 2 and point[2] == 2 then
+  local _x = point[1]
+  _tmp_0 = _x
+elseif type(point) == "table" and #point >= 1 then
+  local _first = point[1]
+  local _rest = __loon_slice__(point, 2, 0)
+  _tmp_0 = _first
+else
+  _tmp_0 = 0
+end
+print(_tmp_0)
+flag = math.random() < 0.5
+local _tmp_1
+if flag == true then
+  _tmp_1 = "yes"
+elseif flag == false then
+  _tmp_1 = "no"
+end
+print(_tmp_1)
@@ -0,0 +1,5 @@
+local some_array, some_tuple_of_4, some_dict_aka_map
+some_array = { 1, 2.0, 3.4, 5 }
+some_tuple_of_4 = { 123, 4.56, "seven", { 8, 9.0, "10" } }
+some_dict_aka_map = { one = 1, two = 2.0, ["the third"] = "3", [true] = "4" }
+print(some_array[1], some_tuple_of_4[3], some_dict_aka_map.one, some_dict_aka_map["the third"])
@@ -0,0 +1,31 @@
+local some_random_bool, three, maybe
+local function __loon_is__(val, type_name)
+  local lua_type = type(val)
+  if type_name == "Bool" then
+    return lua_type == "boolean"
+  elseif type_name == "Str" then
+    return lua_type == "string"
+  end
+  return math.type(val) == ((type_name == "Int") and "integer" or "float")
+end
+some_random_bool = function()
+  return math.random() < 0.5
+end
+do
+  local tmp = 1 + 2
+  if some_random_bool() then
+    three = tmp
+  else
+    three = "three"
+  end
+end
+print(__loon_is__(three, "Int") and "3" or three)
+maybe = some_random_bool() and 2.5 or nil
+if __loon_is__(maybe, "Float") then
+  print(maybe * 2)
+end
+if maybe ~= nil then
+  print(maybe)
+else
+  print("nil")
+end
@@ -0,0 +1,12 @@
+local x, s, b, p
+x = 0
+x = x + 10
+s = "hello "
+s = s .. "world"
+b = false
+b = b and (true or false)
+p = 50
+p = p & 5
+p = p | 3
+p = p >> 3
+p = p << 3
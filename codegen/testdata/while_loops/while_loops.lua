@@ -0,0 +1,11 @@
+local i, j
+i = 10
+while i > 0 do
+  print(i)
+  i = i - 1
+end
+j = 10
+while j > 0 do
+  print(j)
+  j = j - 1
+end
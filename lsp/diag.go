@@ -14,6 +14,11 @@ func init() {
 		session.Access(func(sess session.StateAccess, _ session.Intel) {
 			all_diags := sess.AllCurrentSrcFileDiags()
 			for file_path, diags := range all_diags {
+				if _, is_open_notebook := notebooks[file_path]; is_open_notebook {
+					if src_file := sess.SrcFile(file_path); (src_file != nil) && (src_file.Notebook != nil) && notebookPublishDiags(file_path, src_file.Notebook, diags) {
+						continue
+					}
+				}
 				Server.Notify_textDocument_publishDiagnostics(lsp.PublishDiagnosticsParams{
 					Uri:         lspUriFromFsPath(file_path),
 					Diagnostics: sl.To(diags, diagToLspDiag),
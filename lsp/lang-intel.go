@@ -8,8 +8,6 @@ import (
 	"loon/util/str"
 )
 
-const temporarilyListAllIcons = false
-
 func init() {
 	Server.Lang.DocumentSymbolsMultiTreeLabel = "Loon"
 	Server.Lang.TriggerChars.Completion = []string{".", "/"}
@@ -22,18 +20,6 @@ func init() {
 				ret = sl.To(intel.Decls(nil, src_file, false, ""), toLspDocumentSymbol)
 			}
 		})
-		if temporarilyListAllIcons {
-			ret = sl.To([]lsp.SymbolKind{lsp.SymbolKindArray, lsp.SymbolKindBoolean, lsp.SymbolKindClass, lsp.SymbolKindConstant, lsp.SymbolKindConstructor, lsp.SymbolKindEnum, lsp.SymbolKindEnumMember, lsp.SymbolKindEvent, lsp.SymbolKindField, lsp.SymbolKindFile, lsp.SymbolKindFunction, lsp.SymbolKindInterface, lsp.SymbolKindKey, lsp.SymbolKindMethod, lsp.SymbolKindModule, lsp.SymbolKindNamespace, lsp.SymbolKindNull, lsp.SymbolKindNumber, lsp.SymbolKindObject, lsp.SymbolKindOperator, lsp.SymbolKindPackage, lsp.SymbolKindProperty, lsp.SymbolKindString, lsp.SymbolKindStruct, lsp.SymbolKindTypeParameter, lsp.SymbolKindVariable},
-				func(it lsp.SymbolKind) lsp.DocumentSymbol {
-					return lsp.DocumentSymbol{
-						Name:           it.String(),
-						Detail:         str.Fmt("**TODO:** documentSymbols for `%v`", src_file_path),
-						Kind:           it,
-						Range:          lsp.Range{Start: lsp.Position{Line: 2, Character: 1}, End: lsp.Position{Line: 2, Character: 8}},
-						SelectionRange: lsp.Range{Start: lsp.Position{Line: 2, Character: 3}, End: lsp.Position{Line: 2, Character: 6}},
-					}
-				})
-		}
 		return
 	}
 
@@ -61,16 +47,24 @@ func init() {
 	}
 
 	Server.On_textDocument_references = func(params *lsp.ReferenceParams) ([]lsp.Location, error) {
-		return intelLookup(session.IntelLookupKindRefs, &params.TextDocumentPositionParams), nil
+		refs := intelLookup(session.IntelLookupKindRefs, &params.TextDocumentPositionParams)
+		if !params.Context.IncludeDeclaration {
+			decls := intelLookup(session.IntelLookupKindDecls, &params.TextDocumentPositionParams)
+			refs = sl.Where(refs, func(it lsp.Location) bool { return !sl.Has(decls, it) })
+		}
+		return refs, nil
 	}
 
 	Server.On_textDocument_documentHighlight = func(params *lsp.DocumentHighlightParams) (ret []lsp.DocumentHighlight, _ error) {
-		src_file_path := lspUriToFsPath(params.TextDocument.Uri)
 		session.Access(func(sess session.StateAccess, intel session.Intel) {
-			if src_file := sess.SrcFile(src_file_path); src_file != nil {
-				for _, locs := range intel.Lookup(session.IntelLookupKindRefs, src_file, lspPosToPos(&params.Position), true) {
+			if src_file, pos := notebookSrcFilePos(sess, params.TextDocument.Uri, &params.Position); src_file != nil {
+				for _, locs := range intel.Lookup(session.IntelLookupKindRefs, src_file, pos, true) {
 					for i, span := range locs.Spans {
-						it := lsp.DocumentHighlight{Range: lspRangeFromSpan(span), Kind: lsp.DocumentHighlightKindText}
+						uri, rng := notebookLspLoc(src_file, span)
+						if uri != params.TextDocument.Uri { // in another cell of the same notebook
+							continue
+						}
+						it := lsp.DocumentHighlight{Range: rng, Kind: lsp.DocumentHighlightKindText}
 						if (len(locs.IsGet) == len(locs.Spans)) && (locs.IsGet[i]) {
 							it.Kind = lsp.DocumentHighlightKindRead
 						} else if (len(locs.IsSet) == len(locs.Spans)) && (locs.IsSet[i]) {
@@ -84,55 +78,20 @@ func init() {
 		return
 	}
 
-	Server.On_textDocument_completion = func(params *lsp.CompletionParams) ([]lsp.CompletionItem, error) {
-		src_file_path := lspUriToFsPath(params.TextDocument.Uri)
-		return sl.To([]lsp.CompletionItemKind{
-			lsp.CompletionItemKindClass,
-			lsp.CompletionItemKindColor,
-			lsp.CompletionItemKindConstant,
-			lsp.CompletionItemKindConstructor,
-			lsp.CompletionItemKindEnum,
-			lsp.CompletionItemKindEnumMember,
-			lsp.CompletionItemKindEvent,
-			lsp.CompletionItemKindField,
-			lsp.CompletionItemKindFile,
-			lsp.CompletionItemKindFolder,
-			lsp.CompletionItemKindFunction,
-			lsp.CompletionItemKindInterface,
-			lsp.CompletionItemKindKeyword,
-			lsp.CompletionItemKindMethod,
-			lsp.CompletionItemKindModule,
-			lsp.CompletionItemKindOperator,
-			lsp.CompletionItemKindProperty,
-			lsp.CompletionItemKindReference,
-			lsp.CompletionItemKindSnippet,
-			lsp.CompletionItemKindStruct,
-			lsp.CompletionItemKindText,
-			lsp.CompletionItemKindTypeParameter,
-			lsp.CompletionItemKindUnit,
-			lsp.CompletionItemKindValue,
-			lsp.CompletionItemKindVariable,
-		}, func(it lsp.CompletionItemKind) lsp.CompletionItem {
-			return lsp.CompletionItem{
-				Label: it.String(),
-				Kind:  it,
-				Documentation: &lsp.MarkupContent{Kind: lsp.MarkupKindMarkdown,
-					Value: str.Fmt("**TODO** _%s_ for `%s` @ %d,%d", it.String(), src_file_path, params.Position.Line, params.Position.Character)},
-				Detail: "Detail",
-				LabelDetails: &lsp.CompletionItemLabelDetails{
-					Detail:      " · LD_Detail " + it.String(),
-					Description: "LD_Description " + it.String(),
-				},
+	Server.On_textDocument_completion = func(params *lsp.CompletionParams) (ret []lsp.CompletionItem, _ error) {
+		session.Access(func(sess session.StateAccess, intel session.Intel) {
+			if src_file, pos := notebookSrcFilePos(sess, params.TextDocument.Uri, &params.Position); src_file != nil {
+				ret = sl.To(intel.Completions(src_file, pos), toLspCompletionItem)
 			}
-		}), nil
+		})
+		return
 	}
 
 	Server.On_textDocument_hover = func(params *lsp.HoverParams) (ret *lsp.Hover, _ error) {
-		src_file_path := lspUriToFsPath(params.TextDocument.Uri)
 		session.Access(func(sess session.StateAccess, intel session.Intel) {
-			if src_file := sess.SrcFile(src_file_path); src_file != nil {
-				if info := intel.Info(src_file, lspPosToPos(&params.Position)); info != nil {
-					items := info.Items.Where(session.IntelItemKindDescription)
+			if src_file, pos := notebookSrcFilePos(sess, params.TextDocument.Uri, &params.Position); src_file != nil {
+				if info := intel.Info(src_file, pos); info != nil {
+					items := append(info.Items.Where(session.IntelItemKindDescription), info.Items.Where(session.IntelItemKindExpansion)...)
 					for i, item := range items {
 						if item.CodeLang != "" {
 							items[i].Value = "\n \n```" + item.CodeLang + "\n" + item.Value + "\n```"
@@ -141,12 +100,21 @@ func init() {
 						}
 					}
 					strs := sl.Where(sl.To(items, func(it session.IntelItem) string { return it.Value }), func(s string) bool { return s != "" })
+					if num_bytes, num_runes := info.Items.First(session.IntelItemKindStrBytesLen), info.Items.First(session.IntelItemKindStrUtf8RunesLen); (num_bytes != nil) && (num_runes != nil) {
+						strs = append(strs, "`"+num_bytes.Value+"` bytes · `"+num_runes.Value+"` UTF-8 runes")
+					}
+					if nums := sl.Where(info.Items, func(it session.IntelItem) bool {
+						return (it.Kind == session.IntelItemKindNumDec) || (it.Kind == session.IntelItemKindNumHex) || (it.Kind == session.IntelItemKindNumOct)
+					}); len(nums) > 0 {
+						strs = append(strs, str.Join(sl.To(nums, func(it session.IntelItem) string { return "`" + it.Value + "`" }), " · "))
+					}
 					if text := str.Join(sl.To(strs, str.Trim), "\n\n\n___\n\n\n"); text != "" {
 						ret = &lsp.Hover{
 							Contents: lsp.MarkupContent{Value: text, Kind: lsp.MarkupKindMarkdown},
 						}
 						if info.SpanFull != nil {
-							ret.Range = util.Ptr(lspRangeFromSpan(info.SpanFull))
+							_, rng := notebookLspLoc(src_file, info.SpanFull)
+							ret.Range = &rng
 						}
 					}
 				}
@@ -156,29 +124,26 @@ func init() {
 	}
 
 	Server.On_textDocument_prepareRename = func(params *lsp.PrepareRenameParams) (ret *lsp.Range, _ error) {
-		src_file_path := lspUriToFsPath(params.TextDocument.Uri)
 		session.Access(func(sess session.StateAccess, intel session.Intel) {
-			if src_file := sess.SrcFile(src_file_path); src_file != nil {
-				if span := intel.CanRename(src_file, lspPosToPos(&params.Position)); span != nil {
-					ret = util.Ptr(lspRangeFromSpan(span))
+			if src_file, pos := notebookSrcFilePos(sess, params.TextDocument.Uri, &params.Position); src_file != nil {
+				if span := intel.CanRename(src_file, pos); span != nil {
+					_, rng := notebookLspLoc(src_file, span)
+					ret = &rng
 				}
 			}
 		})
 		return
 	}
 
-	Server.On_textDocument_rename = func(params *lsp.RenameParams) (ret *lsp.WorkspaceEdit, _ error) {
-		src_file_path := lspUriToFsPath(params.TextDocument.Uri)
+	Server.On_textDocument_rename = func(params *lsp.RenameParams) (ret *lsp.WorkspaceEdit, err error) {
 		session.Access(func(sess session.StateAccess, intel session.Intel) {
-			if src_file := sess.SrcFile(src_file_path); src_file != nil {
-				if refs := intel.Lookup(session.IntelLookupKindRefs, src_file, lspPosToPos(&params.Position), false); len(refs) > 0 {
+			if src_file, pos := notebookSrcFilePos(sess, params.TextDocument.Uri, &params.Position); src_file != nil {
+				var edits []*session.IntelEdit
+				if edits, err = intel.Rename(src_file, pos, params.NewName); (err == nil) && (len(edits) > 0) {
 					ret = &lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{}}
-					for _, locs := range refs {
-						if len(locs.Spans) > 0 {
-							ret.Changes[lspUriFromFsPath(locs.File.FilePath)] = sl.To(locs.Spans, func(span *session.SrcFileSpan) lsp.TextEdit {
-								return lsp.TextEdit{Range: lspRangeFromSpan(span), NewText: params.NewName}
-							})
-						}
+					for _, edit := range edits {
+						uri, rng := notebookLspLoc(edit.File, edit.Span)
+						ret.Changes[uri] = append(ret.Changes[uri], lsp.TextEdit{Range: rng, NewText: edit.NewText})
 					}
 				}
 			}
@@ -228,10 +193,9 @@ func init() {
 }
 
 func intelLookup(kind session.IntelLookupKind, params *lsp.TextDocumentPositionParams) (ret []lsp.Location) {
-	src_file_path := lspUriToFsPath(params.TextDocument.Uri)
 	session.Access(func(sess session.StateAccess, intel session.Intel) {
-		if src_file := sess.SrcFile(src_file_path); src_file != nil {
-			for _, locs := range intel.Lookup(kind, src_file, lspPosToPos(&params.Position), false) {
+		if src_file, pos := notebookSrcFilePos(sess, params.TextDocument.Uri, &params.Position); src_file != nil {
+			for _, locs := range intel.Lookup(kind, src_file, pos, false) {
 				ret = append(ret, toLspLocations(locs)...)
 			}
 		}
@@ -242,14 +206,15 @@ func intelLookup(kind session.IntelLookupKind, params *lsp.TextDocumentPositionP
 func toLspLocations(from ...*session.SrcFileLocs) (ret []lsp.Location) {
 	for _, loc := range from {
 		for _, span := range loc.Spans {
-			ret = append(ret, lsp.Location{Range: lspRangeFromSpan(span), Uri: lspUriFromFsPath(loc.File.FilePath)})
+			uri, rng := notebookLspLoc(loc.File, span)
+			ret = append(ret, lsp.Location{Range: rng, Uri: uri})
 		}
 	}
 	return
 }
 
 func toLspDocumentSymbol(info *session.IntelInfo) (sym lsp.DocumentSymbol) {
-	sym.Kind, sym.Name = lsp.SymbolKindVariable, info.Items.Name().Value
+	sym.Kind, sym.Name = toLspSymbolKind(info), info.Items.Name().Value
 	if descr := info.Items.First(session.IntelItemKindDescription); descr != nil {
 		sym.Detail = descr.Value
 	}
@@ -257,18 +222,12 @@ func toLspDocumentSymbol(info *session.IntelInfo) (sym lsp.DocumentSymbol) {
 		sym.SelectionRange = lspRangeFromSpan(info.SpanIdent)
 		sym.Range = lspRangeFromSpan(info.SpanFull)
 	}
-	for _, item := range info.Items.Where(session.IntelItemKindKind) {
-		switch item.Value {
-		case string(session.IntelDeclKindFunc):
-			sym.Kind = lsp.SymbolKindFunction
-		}
-	}
 	sym.Children = sl.To(info.Sub, toLspDocumentSymbol)
 	return
 }
 
 func toLspWorkspaceSymbol(info *session.IntelInfo) (sym lsp.WorkspaceSymbol) {
-	sym.Kind, sym.Name = lsp.SymbolKindVariable, info.Items.Name().Value
+	sym.Kind, sym.Name = toLspSymbolKind(info), info.Items.Name().Value
 	if pack_dir_path := info.Items.First(session.IntelItemKindSrcPackDirPath); pack_dir_path != nil {
 		sym.ContainerName = pack_dir_path.Value
 	}
@@ -278,11 +237,56 @@ func toLspWorkspaceSymbol(info *session.IntelInfo) (sym lsp.WorkspaceSymbol) {
 			Range: lspRangeFromSpan(info.SpanIdent),
 		}
 	}
-	for _, item := range info.Items.Where(session.IntelItemKindKind) {
-		switch item.Value {
-		case string(session.IntelDeclKindFunc):
-			sym.Kind = lsp.SymbolKindFunction
+	return
+}
+
+func toLspCompletionItem(info *session.IntelInfo) (ret lsp.CompletionItem) {
+	ret.Label, ret.Kind = info.Items.Name().Value, lsp.CompletionItemKindVariable
+	if descr := info.Items.First(session.IntelItemKindDescription); descr != nil {
+		ret.Detail = descr.Value
+	}
+	if snippet := info.Items.First(session.IntelItemKindSnippet); snippet != nil {
+		ret.InsertText, ret.InsertTextFormat = snippet.Value, lsp.InsertTextFormatSnippet
+	}
+	if kind := info.Items.First(session.IntelItemKindKind); kind != nil {
+		switch session.IntelDeclKind(kind.Value) {
+		case session.IntelDeclKindFunc:
+			ret.Kind = lsp.CompletionItemKindFunction
+		case session.IntelDeclKindType:
+			ret.Kind = lsp.CompletionItemKindClass
+		case session.IntelDeclKindStruct:
+			ret.Kind = lsp.CompletionItemKindStruct
+		case session.IntelDeclKindInterface:
+			ret.Kind = lsp.CompletionItemKindInterface
+		case session.IntelDeclKindMethod:
+			ret.Kind = lsp.CompletionItemKindMethod
+		case session.IntelDeclKindField:
+			ret.Kind = lsp.CompletionItemKindField
+		case session.IntelDeclKindKeyword:
+			ret.Kind = lsp.CompletionItemKindKeyword
+		case session.IntelDeclKindSnippet:
+			ret.Kind = lsp.CompletionItemKindSnippet
 		}
 	}
 	return
 }
+
+func toLspSymbolKind(info *session.IntelInfo) lsp.SymbolKind {
+	if kind := info.Items.First(session.IntelItemKindKind); kind != nil {
+		switch session.IntelDeclKind(kind.Value) {
+		case session.IntelDeclKindFunc:
+			return lsp.SymbolKindFunction
+		case session.IntelDeclKindType:
+			return lsp.SymbolKindClass
+		case session.IntelDeclKindStruct:
+			return lsp.SymbolKindStruct
+		case session.IntelDeclKindInterface:
+			return lsp.SymbolKindInterface
+		case session.IntelDeclKindMethod:
+			return lsp.SymbolKindMethod
+		case session.IntelDeclKindField:
+			return lsp.SymbolKindField
+		}
+	}
+	return lsp.SymbolKindVariable
+}
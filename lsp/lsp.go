@@ -4,6 +4,7 @@ import (
 	"os"
 	"time"
 
+	"loon/codegen"
 	lsp "loon/lsp/sdk"
 	"loon/session"
 	"loon/util"
@@ -35,6 +36,7 @@ func Main() {
 }
 
 func init() {
+	session.IntelExpansion = codegen.LuaExpansion
 	session.OnDbgMsg = func(should bool, msg string, args ...any) {
 		if should {
 			if len(args) > 0 {
@@ -0,0 +1,163 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+
+	lsp "loon/lsp/sdk"
+	"loon/session"
+	"loon/util/sl"
+)
+
+// all currently-open notebooks' cells (including markup cells), by notebook source file path.
+// only ever accessed from inside `session.Access`.
+var notebooks = map[string][]*notebookCell{}
+
+type notebookCell struct {
+	uri    string
+	src    string
+	isCode bool
+}
+
+func init() {
+	Server.Lang.NotebookSelector = []lsp.NotebookDocumentSyncSelector{{
+		Notebook: lsp.NotebookDocumentFilter{Pattern: "**/*.lsrepl"},
+		Cells:    []lsp.NotebookCellLanguage{{Language: "loon"}},
+	}}
+
+	Server.On_notebookDocument_didOpen = func(params *lsp.DidOpenNotebookDocumentParams) (any, error) {
+		if src_file_path := lspUriToFsPath(params.NotebookDocument.Uri); session.IsSrcFilePath(src_file_path) {
+			session.Access(func(sess session.StateAccess, _ session.Intel) {
+				notebooks[src_file_path] = sl.To(params.NotebookDocument.Cells, func(it lsp.NotebookCell) *notebookCell {
+					return notebookCellFrom(it, params.CellTextDocuments)
+				})
+				sess.OnSrcFileEdit(src_file_path, notebookSrc(notebooks[src_file_path]))
+			})
+		}
+		return nil, nil
+	}
+
+	Server.On_notebookDocument_didChange = func(params *lsp.DidChangeNotebookDocumentParams) (ret any, err error) {
+		src_file_path := lspUriToFsPath(params.NotebookDocument.Uri)
+		if (!session.IsSrcFilePath(src_file_path)) || (params.Change.Cells == nil) {
+			return nil, nil
+		}
+		session.Access(func(sess session.StateAccess, _ session.Intel) {
+			cells := notebooks[src_file_path]
+			if cells == nil {
+				err = errors.New("'notebookDocument/didChange' notification for a notebook not opened: " + params.NotebookDocument.Uri)
+				return
+			}
+			if structure := params.Change.Cells.Structure; structure != nil {
+				array := &structure.Array
+				if (array.Start < 0) || (array.DeleteCount < 0) || ((array.Start + array.DeleteCount) > len(cells)) {
+					err = errors.New("'notebookDocument/didChange' notification with out-of-bounds cells change")
+					return
+				}
+				for _, cell := range cells[array.Start : array.Start+array.DeleteCount] {
+					if cell.isCode && !sl.Any(array.Cells, func(it lsp.NotebookCell) bool { return it.Document == cell.uri }) {
+						// the cell document is gone, and so should be any of its diags
+						Server.Notify_textDocument_publishDiagnostics(lsp.PublishDiagnosticsParams{Uri: cell.uri, Diagnostics: []lsp.Diagnostic{}})
+					}
+				}
+				cells = append(cells[:array.Start:array.Start], append(sl.To(array.Cells, func(it lsp.NotebookCell) *notebookCell {
+					return notebookCellFrom(it, structure.DidOpen)
+				}), cells[array.Start+array.DeleteCount:]...)...)
+			}
+			for _, text_content := range params.Change.Cells.TextContent {
+				if cell := sl.FirstWhere(cells, func(it *notebookCell) bool { return it.uri == text_content.Document.Uri }); cell != nil {
+					for _, change := range text_content.Changes {
+						if change.Range != nil {
+							err = errors.New("'notebookDocument/didChange' notifications based on `TextDocumentSyncKind.Incremental` not supported")
+							return
+						}
+						cell.src = change.Text
+					}
+				}
+			}
+			notebooks[src_file_path] = cells
+			sess.OnSrcFileEdit(src_file_path, notebookSrc(cells))
+		})
+		return nil, err
+	}
+
+	Server.On_notebookDocument_didClose = func(params *lsp.DidCloseNotebookDocumentParams) (any, error) {
+		if src_file_path := lspUriToFsPath(params.NotebookDocument.Uri); session.IsSrcFilePath(src_file_path) {
+			session.Access(func(sess session.StateAccess, _ session.Intel) {
+				for _, cell := range notebooks[src_file_path] {
+					if cell.isCode { // the cell documents are gone, and so should be any of their diags
+						Server.Notify_textDocument_publishDiagnostics(lsp.PublishDiagnosticsParams{Uri: cell.uri, Diagnostics: []lsp.Diagnostic{}})
+					}
+				}
+				delete(notebooks, src_file_path)
+				sess.OnSrcFileEvents(nil, false, src_file_path)
+			})
+		}
+		return nil, nil
+	}
+}
+
+func notebookCellFrom(cell lsp.NotebookCell, cellTextDocs []lsp.TextDocumentItem) *notebookCell {
+	ret := notebookCell{uri: cell.Document, isCode: (cell.Kind == lsp.NotebookCellKindCode)}
+	if idx := sl.IdxWhere(cellTextDocs, func(it lsp.TextDocumentItem) bool { return it.Uri == cell.Document }); idx >= 0 {
+		ret.src = cellTextDocs[idx].Text
+	}
+	return &ret
+}
+
+// returns the `.lsrepl` JSON file content for the code `cells`, in the format understood by `session.SrcNotebook`
+func notebookSrc(cells []*notebookCell) string {
+	json_bytes, err := json.Marshal(sl.To(sl.Where(cells, func(it *notebookCell) bool { return it.isCode }),
+		func(it *notebookCell) *session.SrcNotebookCell { return &session.SrcNotebookCell{Src: it.src} }))
+	if err != nil {
+		panic(err)
+	}
+	return string(json_bytes)
+}
+
+// the `SrcFile` and position denoted by `lspUri` and `lspPos`: if `lspUri` is that of a code cell of an open notebook,
+// those of the notebook, with `lspPos` (relative to the cell) made relative to the whole notebook
+func notebookSrcFilePos(sess session.StateAccess, lspUri string, lspPos *lsp.Position) (*session.SrcFile, session.SrcFilePos) {
+	for src_file_path, cells := range notebooks {
+		if cell_idx := sl.IdxWhere(sl.Where(cells, func(it *notebookCell) bool { return it.isCode }), func(it *notebookCell) bool {
+			return it.uri == lspUri
+		}); cell_idx >= 0 {
+			if src_file := sess.SrcFile(src_file_path); (src_file != nil) && (src_file.Notebook != nil) {
+				return src_file, src_file.Notebook.FilePos(cell_idx, lspPosToPos(lspPos))
+			}
+		}
+	}
+	return sess.SrcFile(lspUriToFsPath(lspUri)), lspPosToPos(lspPos)
+}
+
+// the LSP URI and range of `span` in `srcFile`: if an open notebook, those of the code cell containing `span`
+func notebookLspLoc(srcFile *session.SrcFile, span *session.SrcFileSpan) (string, lsp.Range) {
+	if cells := sl.Where(notebooks[srcFile.FilePath], func(it *notebookCell) bool { return it.isCode }); (srcFile.Notebook != nil) &&
+		(len(cells) > 0) && (len(cells) == len(srcFile.Notebook.Cells)) {
+		cell_idx, cell_span := srcFile.Notebook.CellSpan(span)
+		return cells[cell_idx].uri, lspRangeFromSpan(&cell_span)
+	}
+	return lspUriFromFsPath(srcFile.FilePath), lspRangeFromSpan(span)
+}
+
+// publishes `diags` of the open notebook at `srcFilePath` not to it but to its code cells (as LSP clients expect)
+func notebookPublishDiags(srcFilePath string, notebook *session.SrcNotebook, diags session.Diags) bool {
+	cells := sl.Where(notebooks[srcFilePath], func(it *notebookCell) bool { return it.isCode })
+	if (len(cells) == 0) || (len(cells) != len(notebook.Cells)) {
+		return false
+	}
+	cells_diags := make([][]lsp.Diagnostic, len(cells))
+	for _, diag := range diags {
+		cell_idx, cell_span := notebook.CellSpan(&diag.Span)
+		cell_diag := *diag
+		cell_diag.Span = cell_span
+		cells_diags[cell_idx] = append(cells_diags[cell_idx], diagToLspDiag(&cell_diag))
+	}
+	for i, cell := range cells {
+		Server.Notify_textDocument_publishDiagnostics(lsp.PublishDiagnosticsParams{
+			Uri:         cell.uri,
+			Diagnostics: append([]lsp.Diagnostic{}, cells_diags[i]...),
+		})
+	}
+	return true
+}
@@ -39,6 +39,7 @@ type Server struct {
 		}
 		Commands                      []string
 		DocumentSymbolsMultiTreeLabel string
+		NotebookSelector              []NotebookDocumentSyncSelector
 	}
 
 	On_initialized                         func(params *InitializedParams) (any, error)
@@ -48,6 +49,9 @@ type Server struct {
 	On_textDocument_didChange              func(params *DidChangeTextDocumentParams) (any, error)
 	On_textDocument_didClose               func(params *DidCloseTextDocumentParams) (any, error)
 	On_textDocument_didSave                func(params *DidSaveTextDocumentParams) (any, error)
+	On_notebookDocument_didOpen            func(params *DidOpenNotebookDocumentParams) (any, error)
+	On_notebookDocument_didChange          func(params *DidChangeNotebookDocumentParams) (any, error)
+	On_notebookDocument_didClose           func(params *DidCloseNotebookDocumentParams) (any, error)
 	On_workspace_didChangeWatchedFiles     func(params *DidChangeWatchedFilesParams) (any, error)
 	On_workspace_didChangeWorkspaceFolders func(params *DidChangeWorkspaceFoldersParams) (any, error)
 	On_textDocument_implementation         func(params *ImplementationParams) ([]Location, error)
@@ -166,6 +170,12 @@ func (me *Server) handleIncoming(raw map[string]any) *jsonRpcError {
 		serverHandleIncoming(me, me.On_textDocument_didClose, msg_method, msg_id, raw["params"])
 	case "textDocument/didSave":
 		serverHandleIncoming(me, me.On_textDocument_didSave, msg_method, msg_id, raw["params"])
+	case "notebookDocument/didOpen":
+		serverHandleIncoming(me, me.On_notebookDocument_didOpen, msg_method, msg_id, raw["params"])
+	case "notebookDocument/didChange":
+		serverHandleIncoming(me, me.On_notebookDocument_didChange, msg_method, msg_id, raw["params"])
+	case "notebookDocument/didClose":
+		serverHandleIncoming(me, me.On_notebookDocument_didClose, msg_method, msg_id, raw["params"])
 	case "workspace/didChangeWatchedFiles":
 		serverHandleIncoming(me, me.On_workspace_didChangeWatchedFiles, msg_method, msg_id, raw["params"])
 	case "textDocument/implementation":
@@ -225,6 +235,9 @@ func (me *Server) handleIncoming(raw map[string]any) *jsonRpcError {
 					Save:      util.If(me.On_textDocument_didSave != nil, &SaveOptions{IncludeText: true}, nil),
 				}
 			}
+			if (me.On_notebookDocument_didOpen != nil) || (me.On_notebookDocument_didChange != nil) {
+				caps.NotebookDocumentSync = &NotebookDocumentSyncOptions{NotebookSelector: me.Lang.NotebookSelector}
+			}
 			if me.On_textDocument_completion != nil {
 				caps.CompletionProvider = &CompletionOptions{TriggerCharacters: me.Lang.TriggerChars.Completion}
 			}
@@ -84,6 +84,69 @@ type DidChangeTextDocumentParams struct {
 	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
 }
 
+type NotebookDocument struct {
+	Uri          string         `json:"uri"`
+	NotebookType string         `json:"notebookType"`
+	Version      int            `json:"version"`
+	Cells        []NotebookCell `json:"cells"`
+}
+
+type NotebookCell struct {
+	Kind     NotebookCellKind `json:"kind"`
+	Document string           `json:"document"` // the URI of the cell's text document
+}
+
+type NotebookCellKind int
+
+const (
+	NotebookCellKindMarkup NotebookCellKind = 1
+	NotebookCellKindCode   NotebookCellKind = 2
+)
+
+type NotebookDocumentIdentifier struct {
+	Uri string `json:"uri"`
+}
+
+type VersionedNotebookDocumentIdentifier struct {
+	NotebookDocumentIdentifier
+	Version int `json:"version"`
+}
+
+type DidOpenNotebookDocumentParams struct {
+	NotebookDocument  NotebookDocument   `json:"notebookDocument"`
+	CellTextDocuments []TextDocumentItem `json:"cellTextDocuments"`
+}
+
+type DidChangeNotebookDocumentParams struct {
+	NotebookDocument VersionedNotebookDocumentIdentifier `json:"notebookDocument"`
+	Change           NotebookDocumentChangeEvent         `json:"change"`
+}
+
+type DidCloseNotebookDocumentParams struct {
+	NotebookDocument  NotebookDocumentIdentifier `json:"notebookDocument"`
+	CellTextDocuments []TextDocumentIdentifier   `json:"cellTextDocuments"`
+}
+
+type NotebookDocumentChangeEvent struct {
+	Cells *struct {
+		Structure *struct {
+			Array    NotebookCellArrayChange  `json:"array"`
+			DidOpen  []TextDocumentItem       `json:"didOpen,omitempty"`
+			DidClose []TextDocumentIdentifier `json:"didClose,omitempty"`
+		} `json:"structure,omitempty"`
+		TextContent []struct {
+			Document VersionedTextDocumentIdentifier  `json:"document"`
+			Changes  []TextDocumentContentChangeEvent `json:"changes"`
+		} `json:"textContent,omitempty"`
+	} `json:"cells,omitempty"`
+}
+
+type NotebookCellArrayChange struct {
+	Start       int            `json:"start"`
+	DeleteCount int            `json:"deleteCount"`
+	Cells       []NotebookCell `json:"cells,omitempty"`
+}
+
 type DocumentSymbolParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 }
@@ -110,6 +173,11 @@ type ImplementationParams struct {
 
 type ReferenceParams struct {
 	TextDocumentPositionParams
+	Context ReferenceContext `json:"context"`
+}
+
+type ReferenceContext struct {
+	IncludeDeclaration bool `json:"includeDeclaration"`
 }
 
 type DocumentHighlightParams struct {
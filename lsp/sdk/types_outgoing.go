@@ -196,14 +196,23 @@ type CompletionItemLabelDetails struct {
 }
 
 type CompletionItem struct {
-	Label         string                      `json:"label"`
-	LabelDetails  *CompletionItemLabelDetails `json:"labelDetails,omitempty"`
-	Kind          CompletionItemKind          `json:"kind,omitempty"`
-	Tags          []CompletionItemTag         `json:"tags,omitempty"`
-	Detail        string                      `json:"detail,omitempty"`
-	Documentation *MarkupContent              `json:"documentation,omitempty"`
+	Label            string                      `json:"label"`
+	LabelDetails     *CompletionItemLabelDetails `json:"labelDetails,omitempty"`
+	Kind             CompletionItemKind          `json:"kind,omitempty"`
+	Tags             []CompletionItemTag         `json:"tags,omitempty"`
+	Detail           string                      `json:"detail,omitempty"`
+	Documentation    *MarkupContent              `json:"documentation,omitempty"`
+	InsertText       string                      `json:"insertText,omitempty"`
+	InsertTextFormat InsertTextFormat            `json:"insertTextFormat,omitempty"`
 }
 
+type InsertTextFormat uint
+
+const (
+	InsertTextFormatPlainText InsertTextFormat = 1
+	InsertTextFormatSnippet   InsertTextFormat = 2
+)
+
 type CompletionItemTag uint
 
 const (
@@ -468,24 +477,25 @@ type InitializeResult struct {
 }
 
 type ServerCapabilities struct {
-	TextDocumentSync                *TextDocumentSyncOptions `json:"textDocumentSync,omitempty"`
-	CompletionProvider              *CompletionOptions       `json:"completionProvider,omitempty"`
-	HoverProvider                   bool                     `json:"hoverProvider,omitempty"`
-	SignatureHelpProvider           *SignatureHelpOptions    `json:"signatureHelpProvider,omitempty"`
-	DeclarationProvider             bool                     `json:"declarationProvider,omitempty"`
-	DefinitionProvider              bool                     `json:"definitionProvider,omitempty"`
-	TypeDefinitionProvider          bool                     `json:"typeDefinitionProvider,omitempty"`
-	ImplementationProvider          bool                     `json:"implementationProvider,omitempty"`
-	ReferencesProvider              bool                     `json:"referencesProvider,omitempty"`
-	DocumentHighlightProvider       bool                     `json:"documentHighlightProvider,omitempty"`
-	DocumentSymbolProvider          *DocumentSymbolOptions   `json:"documentSymbolProvider,omitempty"`
-	CodeActionProvider              bool                     `json:"codeActionProvider,omitempty"`
-	WorkspaceSymbolProvider         bool                     `json:"workspaceSymbolProvider,omitempty"`
-	DocumentFormattingProvider      bool                     `json:"documentFormattingProvider,omitempty"`
-	DocumentRangeFormattingProvider bool                     `json:"documentRangeFormattingProvider,omitempty"`
-	RenameProvider                  *RenameOptions           `json:"renameProvider,omitempty"`
-	SelectionRangeProvider          bool                     `json:"selectionRangeProvider,omitempty"`
-	ExecuteCommandProvider          *ExecuteCommandOptions   `json:"executeCommandProvider,omitempty"`
+	TextDocumentSync                *TextDocumentSyncOptions     `json:"textDocumentSync,omitempty"`
+	NotebookDocumentSync            *NotebookDocumentSyncOptions `json:"notebookDocumentSync,omitempty"`
+	CompletionProvider              *CompletionOptions           `json:"completionProvider,omitempty"`
+	HoverProvider                   bool                         `json:"hoverProvider,omitempty"`
+	SignatureHelpProvider           *SignatureHelpOptions        `json:"signatureHelpProvider,omitempty"`
+	DeclarationProvider             bool                         `json:"declarationProvider,omitempty"`
+	DefinitionProvider              bool                         `json:"definitionProvider,omitempty"`
+	TypeDefinitionProvider          bool                         `json:"typeDefinitionProvider,omitempty"`
+	ImplementationProvider          bool                         `json:"implementationProvider,omitempty"`
+	ReferencesProvider              bool                         `json:"referencesProvider,omitempty"`
+	DocumentHighlightProvider       bool                         `json:"documentHighlightProvider,omitempty"`
+	DocumentSymbolProvider          *DocumentSymbolOptions       `json:"documentSymbolProvider,omitempty"`
+	CodeActionProvider              bool                         `json:"codeActionProvider,omitempty"`
+	WorkspaceSymbolProvider         bool                         `json:"workspaceSymbolProvider,omitempty"`
+	DocumentFormattingProvider      bool                         `json:"documentFormattingProvider,omitempty"`
+	DocumentRangeFormattingProvider bool                         `json:"documentRangeFormattingProvider,omitempty"`
+	RenameProvider                  *RenameOptions               `json:"renameProvider,omitempty"`
+	SelectionRangeProvider          bool                         `json:"selectionRangeProvider,omitempty"`
+	ExecuteCommandProvider          *ExecuteCommandOptions       `json:"executeCommandProvider,omitempty"`
 	Workspace                       struct {
 		WorkspaceFolders WorkspaceFoldersServerCapabilities `json:"workspaceFolders,omitempty"`
 	} `json:"workspace"`
@@ -522,6 +532,25 @@ type TextDocumentSyncOptions struct {
 	Save      *SaveOptions         `json:"save,omitempty"`
 }
 
+type NotebookDocumentSyncOptions struct {
+	NotebookSelector []NotebookDocumentSyncSelector `json:"notebookSelector"`
+}
+
+type NotebookDocumentSyncSelector struct {
+	Notebook NotebookDocumentFilter `json:"notebook"`
+	Cells    []NotebookCellLanguage `json:"cells,omitempty"`
+}
+
+type NotebookDocumentFilter struct {
+	NotebookType string `json:"notebookType,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	Pattern      string `json:"pattern,omitempty"`
+}
+
+type NotebookCellLanguage struct {
+	Language string `json:"language"`
+}
+
 type SaveOptions struct {
 	IncludeText bool `json:"includeText,omitempty"`
 }
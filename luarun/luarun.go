@@ -0,0 +1,95 @@
+package luarun
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+
+	"loon/util/str"
+)
+
+// Interpreters lists the Lua interpreter binaries looked up in `$PATH`, in order, when none is configured. Only
+// Lua 5.3 and later (so not LuaJIT) run the generated code, which uses `goto` (for `~>` and `<~`), `//`, the bitwise
+// operators and `math.type`.
+var Interpreters = []string{"lua5.4", "lua", "lua5.3"}
+
+// Interpreter returns the Lua interpreter binary to use: `explicit` if non-empty,
+// else `$LOON_LUA` if set, else the first of `Interpreters` found in `$PATH`.
+func Interpreter(explicit string) (string, error) {
+	if explicit == "" {
+		explicit = os.Getenv("LOON_LUA")
+	}
+	if explicit != "" {
+		return exec.LookPath(explicit)
+	}
+	for _, name := range Interpreters {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("no Lua interpreter found in $PATH (tried: " + str.Join(Interpreters, ", ") + "), specify one via $LOON_LUA: it must be Lua 5.3 or later, not LuaJIT or Lua 5.1 or 5.2")
+}
+
+// Run executes the Lua source file at `luaFilePath` via `interpreter`, passing through `args`
+// and all of stdin, stdout and stderr, the latter line-wise through `rewriteStderr` if not `nil`.
+// It returns the interpreter process' exit code.
+func Run(interpreter string, luaFilePath string, rewriteStderr func(string) string, args ...string) (int, error) {
+	cmd := exec.Command(interpreter, append([]string{luaFilePath}, args...)...)
+	cmd.Stdin, cmd.Stdout = os.Stdin, os.Stdout
+	var stderr io.ReadCloser
+	var err error
+	if rewriteStderr == nil {
+		cmd.Stderr = os.Stderr
+	} else if stderr, err = cmd.StderrPipe(); err != nil {
+		return -1, err
+	}
+
+	if err = cmd.Start(); err == nil {
+		if stderr != nil {
+			for lines := bufio.NewScanner(stderr); lines.Scan(); {
+				os.Stderr.WriteString(rewriteStderr(lines.Text()) + "\n")
+			}
+		}
+		err = cmd.Wait()
+	}
+	if exit_err := (*exec.ExitError)(nil); errors.As(err, &exit_err) {
+		return exit_err.ExitCode(), nil
+	} else if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// Proc is a still-running Lua interpreter process, as started by `Start`.
+type Proc struct {
+	cmd    *exec.Cmd
+	Stdin  io.WriteCloser
+	Stdout *bufio.Reader
+}
+
+// Start launches `interpreter` on the Lua source file at `luaFilePath` with `args`, with its
+// stdin and stdout piped to the returned `Proc` and its stderr passed through.
+func Start(interpreter string, luaFilePath string, args ...string) (*Proc, error) {
+	cmd := exec.Command(interpreter, append([]string{luaFilePath}, args...)...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &Proc{cmd: cmd, Stdin: stdin, Stdout: bufio.NewReader(stdout)}, nil
+}
+
+// Close closes the process' stdin and waits for it to exit.
+func (me *Proc) Close() error {
+	_ = me.Stdin.Close()
+	return me.cmd.Wait()
+}
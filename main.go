@@ -14,6 +14,10 @@ func main() {
 	switch cmd_name := os.Args[1]; cmd_name {
 	case "lsp":
 		lsp.Main()
+	case "repl":
+		os.Exit(mainRepl(os.Args[2:]))
+	case "run":
+		os.Exit(mainRun(os.Args[2:]))
 	default:
 		panic("command '" + cmd_name + "' not implemented")
 	}
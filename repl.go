@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"loon/codegen"
+	"loon/luarun"
+	"loon/session"
+	"loon/util"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+// the Lua side of `loon repl`: reads chunks, each being a chunk-name line followed by the chunk's
+// source lines followed by a `sep` line, and evaluates them in order, answering each with its results
+// (tab-separated on one line, if any) or its error (after a "sep!" line), followed by a `sep` line
+const replLuaDriver = `local sep = arg[1]
+local load = loadstring or load
+local function pack(...) return { n = select("#", ...), ... } end
+while true do
+  local name = io.read("*l")
+  if name == nil then break end
+  local lines = {}
+  for line in function() return io.read("*l") end do
+    if line == sep then break end
+    lines[#lines + 1] = line
+  end
+  local chunk, err = load(table.concat(lines, "\n"), "=" .. name)
+  local rets = chunk and pack(xpcall(chunk, debug.traceback)) or { n = 2, false, err }
+  if not rets[1] then
+    io.write(sep, "!\n", tostring(rets[2]), "\n")
+  elseif rets.n > 1 then
+    local strs = {}
+    for i = 2, rets.n do
+      strs[#strs + 1] = tostring(rets[i])
+    end
+    io.write(table.concat(strs, "\t"), "\n")
+  end
+  io.write(sep, "\n")
+  io.flush()
+end
+`
+
+const replSep = "\x1eloon-repl\x1e"
+
+type replSession struct {
+	fauxFilePath   string
+	fauxSrc        string // all inputs accepted so far
+	fauxNumExprs   int    // the number of top-level exprs in `fauxSrc`
+	lua            *luarun.Proc
+	luaDriverPath  string
+	luaSrcMaps     map[string]*codegen.LuaSrcMap // by chunk name
+	luaNumChunks   int
+	hadPackLoadErr bool
+}
+
+// mainRepl implements `loon repl [-lua interpreter] [packDir]`, returning the process exit code.
+// Each input (multi-line while `session.ReplInputIsIncomplete`) is appended to the pack's faux
+// file, and if free of error diags, evaluated in one persistent Lua process as a new chunk.
+func mainRepl(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	lua_interpreter := flags.String("lua", "", "the Lua interpreter binary to evaluate inputs with (default: $LOON_LUA, else the first found of: "+str.Join(luarun.Interpreters, ", ")+")")
+	flags.Usage = func() {
+		os.Stderr.WriteString("usage: loon repl [-lua interpreter] [packDir]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	pack_dir_path, err := filepath.Abs(util.If(flags.NArg() == 0, ".", flags.Arg(0)))
+	if err != nil {
+		return fail(err)
+	} else if !util.FsIsDir(pack_dir_path) {
+		return fail(os.ErrNotExist, pack_dir_path)
+	}
+	interpreter, err := luarun.Interpreter(*lua_interpreter)
+	if err != nil {
+		return fail(err)
+	}
+	sessionHooksForCli()
+
+	repl := replSession{fauxFilePath: session.FauxFilePath(pack_dir_path), luaSrcMaps: map[string]*codegen.LuaSrcMap{},
+		luaDriverPath: filepath.Join(os.TempDir(), "loon", util.ContentHash(pack_dir_path), "repl.lua")}
+	if err = os.MkdirAll(filepath.Dir(repl.luaDriverPath), 0o755); err == nil {
+		err = os.WriteFile(repl.luaDriverPath, []byte(replLuaDriver), 0o644)
+	}
+	if err == nil {
+		repl.lua, err = luarun.Start(interpreter, repl.luaDriverPath, replSep)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	defer repl.lua.Close()
+
+	var src_lua string
+	var src_map *codegen.LuaSrcMap
+	session.Access(func(sess session.StateAccess, _ session.Intel) {
+		if pack := sess.GetSrcPack(pack_dir_path, true); pack != nil {
+			if repl.hadPackLoadErr = printDiags(sess.AllCurrentSrcFileDiags()); !repl.hadPackLoadErr {
+				src_lua, src_map, err = codegen.LuaPack(pack, "", true)
+			}
+		}
+	})
+	if err != nil {
+		return fail(err, pack_dir_path)
+	} else if repl.hadPackLoadErr {
+		os.Stderr.WriteString("loon: the above errors prevent loading " + pack_dir_path + ", its declarations will not be available\n")
+	} else if src_lua != "" {
+		if err = repl.eval("<loonpack>", src_lua, src_map); err != nil {
+			return fail(err)
+		}
+	}
+
+	var input string
+	stdin := bufio.NewScanner(os.Stdin)
+	for os.Stdout.WriteString(util.If(input == "", "> ", ".. ")); stdin.Scan(); os.Stdout.WriteString(util.If(input == "", "> ", ".. ")) {
+		if input += stdin.Text() + "\n"; session.ReplInputIsIncomplete(input) {
+			continue
+		}
+		if str.Trim(input) != "" {
+			if err = repl.input(input); err != nil {
+				return fail(err)
+			}
+		}
+		input = ""
+	}
+	os.Stdout.WriteString("\n")
+	return 0
+}
+
+// input appends `src` to the faux file and, if that causes no error diags, evaluates it.
+// Otherwise, all of `src`'s diags are printed and the faux file reverted to its prior state.
+func (me *replSession) input(src string) (err error) {
+	fauxSrc := me.fauxSrc + src
+	var diags session.Diags
+	var src_lua string
+	var src_map *codegen.LuaSrcMap
+	var num_exprs int
+	session.Access(func(sess session.StateAccess, _ session.Intel) {
+		sess.OnSrcFileEdit(me.fauxFilePath, fauxSrc)
+		// only diags about the new input: those about prior inputs were already shown
+		num_lines_prior := strings.Count(me.fauxSrc, "\n")
+		diags = sl.Where(sess.AllCurrentSrcFileDiags()[me.fauxFilePath], func(it *session.Diag) bool { return it.Span.End.Line > num_lines_prior })
+		if !sl.Any(diags, func(it *session.Diag) bool { return it.Kind == session.DiagKindErr }) {
+			faux_file := sess.SrcFile(me.fauxFilePath)
+			num_exprs = len(faux_file.Trees.Exprs)
+			src_lua, src_map, err = codegen.LuaReplChunk(faux_file, me.fauxNumExprs)
+		}
+		if (src_map == nil) || (err != nil) {
+			sess.OnSrcFileEdit(me.fauxFilePath, me.fauxSrc)
+		}
+	})
+	for _, diag := range diags {
+		replPrintDiag(fauxSrc, diag)
+	}
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		return nil
+	} else if src_map == nil {
+		return nil
+	}
+	me.fauxSrc, me.fauxNumExprs = fauxSrc, num_exprs
+	me.luaNumChunks++
+	return me.eval("<loonfaux#"+str.FromInt(me.luaNumChunks)+">", src_lua, src_map)
+}
+
+// eval has the Lua process run `srcLua` as the chunk `chunkName`, printing its results or error.
+func (me *replSession) eval(chunkName string, srcLua string, srcMap *codegen.LuaSrcMap) error {
+	me.luaSrcMaps[chunkName] = srcMap
+	if _, err := me.lua.Stdin.Write([]byte(chunkName + "\n" + srcLua + "\n" + replSep + "\n")); err != nil {
+		return err
+	}
+	var is_err bool
+	for {
+		line, err := me.lua.Stdout.ReadString('\n')
+		if err != nil {
+			return errors.New("the Lua process exited unexpectedly")
+		}
+		switch line = str.TrimSuff(line, "\n"); {
+		case line == replSep:
+			return nil
+		case line == replSep+"!":
+			is_err = true
+		case is_err:
+			if !str.Has(line, me.luaDriverPath) && !str.Has(line, "[C]: in function 'xpcall'") {
+				for chunk_name, src_map := range me.luaSrcMaps {
+					line = src_map.RewriteTraceback(chunk_name, line)
+				}
+				os.Stderr.WriteString(line + "\n")
+			}
+		default:
+			os.Stdout.WriteString(line + "\n")
+		}
+	}
+}
+
+// replPrintDiag prints the first source line of `diag` with a caret marker underneath its span, then `diag` itself.
+func replPrintDiag(src string, diag *session.Diag) {
+	lines := str.Split(src, "\n")
+	if (diag.Span.Start.Line < 1) || (diag.Span.Start.Line > len(lines)) {
+		os.Stderr.WriteString(diag.String() + "\n")
+		return
+	}
+	line := lines[diag.Span.Start.Line-1]
+	num_carets := util.If(diag.Span.End.Line == diag.Span.Start.Line, diag.Span.End.Char-diag.Span.Start.Char, utf8.RuneCountInString(line)-(diag.Span.Start.Char-1))
+	os.Stderr.WriteString("  " + line + "\n  " + str.Repeat(" ", diag.Span.Start.Char-1) + str.Repeat("^", util.Max(1, num_carets)) + " " + diag.String() + "\n")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"loon/codegen"
+	"loon/luarun"
+	"loon/session"
+	"loon/util"
+	"loon/util/kv"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+// mainRun implements `loon run [-lua interpreter] <dir-or-file.ls> [args...]`, returning the process exit code.
+func mainRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	lua_interpreter := flags.String("lua", "", "the Lua 5.3+ interpreter binary to run the generated code with (default: $LOON_LUA, else the first found of: "+str.Join(luarun.Interpreters, ", ")+")")
+	flags.Usage = func() {
+		os.Stderr.WriteString("usage: loon run [-lua interpreter] <dir-or-file.ls> [args...]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	pack_dir_path, main_src_file_path := path, ""
+	if session.IsSrcFilePath(path) {
+		pack_dir_path, main_src_file_path = filepath.Dir(path), path
+	} else if !util.FsIsDir(path) {
+		return fail(os.ErrNotExist, path)
+	}
+
+	interpreter, err := luarun.Interpreter(*lua_interpreter)
+	if err != nil {
+		return fail(err)
+	}
+	sessionHooksForCli()
+
+	var src_lua string
+	var src_map *codegen.LuaSrcMap
+	var have_errs bool
+	session.Access(func(sess session.StateAccess, _ session.Intel) {
+		pack := sess.GetSrcPack(pack_dir_path, true)
+		if pack == nil {
+			err = os.ErrNotExist
+			return
+		}
+		have_errs = printDiags(sess.AllCurrentSrcFileDiags())
+		if !have_errs {
+			src_lua, src_map, err = codegen.LuaPack(pack, main_src_file_path, false)
+		}
+	})
+	if err != nil {
+		return fail(err, pack_dir_path)
+	} else if have_errs {
+		return 1
+	}
+
+	out_file_path := filepath.Join(os.TempDir(), "loon", util.ContentHash(pack_dir_path),
+		util.If(main_src_file_path == "", filepath.Base(pack_dir_path)+".lua", util.FsPathSwapExt(filepath.Base(main_src_file_path), ".ls", ".lua")))
+	if err = os.MkdirAll(filepath.Dir(out_file_path), 0o755); err == nil {
+		if err = os.WriteFile(out_file_path, []byte(src_lua), 0o644); err == nil {
+			err = src_map.Save(out_file_path)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	exit_code, err := luarun.Run(interpreter, out_file_path, func(stderrLine string) string {
+		return src_map.RewriteTraceback(out_file_path, stderrLine)
+	}, flags.Args()[1:]...)
+	if err != nil {
+		return fail(err)
+	}
+	return exit_code
+}
+
+// the `lsp` package's `init`s set up `session` hooks meant for an LSP client: not wanted here
+func sessionHooksForCli() {
+	session.OnDiagsChanged = func() {}
+	session.OnDbgMsg = func(bool, string, ...any) {}
+	session.OnLogMsg = func(bool, string, ...any) {}
+}
+
+// printDiags writes all `diags` to stderr, returning whether any of them are errors.
+func printDiags(diags map[string]session.Diags) (haveErrs bool) {
+	for _, src_file_path := range sl.Sorted(kv.Keys(diags)) {
+		for _, diag := range diags[src_file_path] {
+			haveErrs = haveErrs || (diag.Kind == session.DiagKindErr)
+			os.Stderr.WriteString(diag.LocStr(src_file_path) + ": " + diag.String() + "\n")
+		}
+	}
+	return
+}
+
+func fail(err error, details ...string) int {
+	msg := err.Error()
+	if len(details) > 0 {
+		msg += ": " + str.Join(details, ", ")
+	}
+	os.Stderr.WriteString("loon: " + msg + "\n")
+	return 1
+}
@@ -0,0 +1,514 @@
+package session
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+	"strconv"
+
+	"loon/util"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+// the most items that a range literal (such as `1...100`) is folded into, larger ones staying unfolded
+const constRangeMaxLen = 1 << 16
+
+// folds `expr` (right after its typing by `typeOf`, so after that of its operands) into its compile-time value `Const`,
+// if composed only of literals: an `int64` (or `uint64`, for those beyond `math.MaxInt64`), `float64`, `string` or
+// `bool`, a `[]any` for tuple, arr and range literals, or a `map[any]any` for dict literals. Reports `DivModZero`
+// (also for non-constant dividends), `int64`/`uint64` overflows as `ComputationFailed`, and `NotConvertible`s.
+func (me *typeChecker) fold(expr Expr) {
+	switch it := expr.(type) {
+	case *ExprLit:
+		switch val := it.Val.(type) {
+		case uint64:
+			it.Const = constInt(new(big.Int).SetUint64(val))
+		case rune:
+			it.Const = string(val)
+		default:
+			it.Const = val
+		}
+	case *ExprOpUnary:
+		it.Const = me.foldOpUnary(it, it.Operand.Base().Const)
+	case *ExprOpBinary:
+		it.Const = me.foldOpBinary(it, it.Lhs.Base().Const, it.Rhs.Base().Const)
+	case *ExprTuple:
+		it.Const = constItems(it.Items)
+	case *ExprArr:
+		if len(it.Items) == 1 {
+			if _, is_range := it.Items[0].(*ExprRange); is_range { // `[foo...bar]` is the same as just `foo...bar`
+				it.Const = it.Items[0].Base().Const
+				break
+			}
+		}
+		it.Const = constItems(it.Items)
+	case *ExprRange:
+		it.Const = constRange(it)
+	case *ExprDict:
+		it.Const = constDict(it)
+	case *ExprIndex:
+		it.Const = constIndex(it)
+	case *ExprCond:
+		if cond, is := it.Cond.Base().Const.(bool); is && cond {
+			it.Const = it.Then.Base().Const
+		} else if is && (it.Else != nil) {
+			it.Const = it.Else.Base().Const
+		}
+	case *ExprStrInterp:
+		var buf []byte
+		for _, part := range it.Parts {
+			if s, is := constStr(part.Base().Const); !is {
+				return
+			} else {
+				buf = append(buf, s...)
+			}
+		}
+		it.Const = string(buf)
+	case *ExprCall:
+		if type_name, subj := it.Conversion(); subj != nil {
+			it.Const = me.foldConversion(subj, type_name)
+		}
+	}
+}
+
+func (me *typeChecker) foldOpUnary(it *ExprOpUnary, operand any) any {
+	switch it.Op {
+	case "-":
+		if i, is := constBigInt(operand); is {
+			return me.foldInt(it, i.Neg(i), false)
+		} else if f, is := operand.(float64); is {
+			return -f
+		}
+	case "!":
+		if b, is := operand.(bool); is {
+			return !b
+		}
+	case "~":
+		if i, is := operand.(int64); is {
+			return ^i
+		}
+	case "#":
+		switch operand := operand.(type) {
+		case string:
+			return int64(len(operand))
+		case []any:
+			return int64(len(operand))
+		}
+	}
+	return nil
+}
+
+func (me *typeChecker) foldOpBinary(it *ExprOpBinary, lhs any, rhs any) any {
+	if (lhs == nil) || (rhs == nil) || constIsZeroDivisor(it.Op, rhs) { // the latter reported by `typeOfOpBinary`
+		return nil
+	}
+	switch it.Op {
+	case "==", "!=":
+		if eq, is := constEq(lhs, rhs); is {
+			return eq == (it.Op == "==")
+		}
+		return nil
+	case "&&", "||", "&", "|":
+		b1, is1 := lhs.(bool)
+		b2, is2 := rhs.(bool)
+		if is1 && is2 {
+			return util.If((it.Op == "&&") || (it.Op == "&"), b1 && b2, b1 || b2)
+		}
+	case "<", ">", "<=", ">=":
+		if cmp, is := constCmp(lhs, rhs); is {
+			switch it.Op {
+			case "<":
+				return cmp < 0
+			case ">":
+				return cmp > 0
+			case "<=":
+				return cmp <= 0
+			}
+			return cmp >= 0
+		}
+		return nil
+	case "+":
+		if items1, is1 := lhs.([]any); is1 {
+			if items2, is2 := rhs.([]any); is2 {
+				return append(append(make([]any, 0, len(items1)+len(items2)), items1...), items2...)
+			}
+			return nil
+		}
+		_, is_str1 := lhs.(string)
+		_, is_str2 := rhs.(string)
+		if is_str1 || is_str2 {
+			s1, is1 := constStr(lhs)
+			s2, is2 := constStr(rhs)
+			if is1 && is2 {
+				return s1 + s2
+			}
+			return nil
+		}
+	}
+
+	i1, is_int1 := constBigInt(lhs)
+	i2, is_int2 := constBigInt(rhs)
+	if is_int1 && is_int2 {
+		_, is_unsigned1 := lhs.(uint64)
+		_, is_unsigned2 := rhs.(uint64)
+		unsigned := is_unsigned1 || is_unsigned2
+		switch it.Op {
+		case "+":
+			return me.foldInt(it, i1.Add(i1, i2), unsigned)
+		case "-":
+			return me.foldInt(it, i1.Sub(i1, i2), unsigned)
+		case "*":
+			return me.foldInt(it, i1.Mul(i1, i2), unsigned)
+		case "//", "%": // floored as in Lua, not truncated as in Go
+			quo, rem := new(big.Int).QuoRem(i1, i2, new(big.Int))
+			if (rem.Sign() != 0) && (rem.Sign() != i2.Sign()) {
+				quo, rem = quo.Sub(quo, big.NewInt(1)), rem.Add(rem, i2)
+			}
+			return me.foldInt(it, util.If(it.Op == "//", quo, rem), unsigned)
+		case "&", "|", "~", "<<", ">>":
+			return constBits(it.Op, constBits64(lhs), constBits64(rhs))
+		}
+	}
+	f1, is_num1 := constFloat(lhs)
+	f2, is_num2 := constFloat(rhs)
+	if is_num1 && is_num2 {
+		switch it.Op {
+		case "+":
+			return f1 + f2
+		case "-":
+			return f1 - f2
+		case "*":
+			return f1 * f2
+		case "/":
+			return f1 / f2
+		case "//":
+			return math.Floor(f1 / f2)
+		case "%":
+			return f1 - (math.Floor(f1/f2) * f2)
+		case "^":
+			return math.Pow(f1, f2)
+		}
+	}
+	return nil
+}
+
+// `i` as an `int64` (or, if `unsigned` due to a `uint64` operand, a `uint64`), else nil after reporting the overflow at `expr`
+func (me *typeChecker) foldInt(expr Expr, i *big.Int, unsigned bool) any {
+	if i.IsInt64() || (unsigned && i.IsUint64()) {
+		return constInt(i)
+	}
+	me.diag(typeCheckerNode{file: me.file, expr: expr}, ErrCodeComputationFailed, "integer overflow: `"+
+		expr.Base().Toks.src(me.file.Src.Text)+"` is "+i.String()+", beyond "+util.If(unsigned, "", "signed ")+"64 bits")
+	return nil
+}
+
+// the constant `subj` converted to `typeName` per `ExprCall.Conversion`, else nil after reporting a `NotConvertible`
+func (me *typeChecker) foldConversion(subj Expr, typeName string) any {
+	val := subj.Base().Const
+	if val == nil {
+		return nil
+	}
+	var ret any
+	switch typeName {
+	case "Str": // all values are, if only at run time for arrs, tuples, dicts and non-finite floats
+		if s, is := constStr(val); is {
+			return s
+		}
+		return nil
+	case "Float":
+		if s, is := val.(string); is {
+			val = constParse(str.Trim(s))
+		}
+		if f, is := constFloat(val); is {
+			ret = f
+		}
+	case "Int":
+		if s, is := val.(string); is {
+			val = constParse(str.Trim(s))
+		}
+		if f, is := val.(float64); is && (f == math.Trunc(f)) && (f >= math.MinInt64) && (f < math.MaxInt64) {
+			ret = int64(f)
+		} else if _, is := constBigInt(val); is {
+			ret = val
+		}
+	}
+	if ret == nil {
+		me.diag(typeCheckerNode{file: me.file, expr: subj}, ErrCodeNotConvertible, subj.Base().Toks.src(me.file.Src.Text), typeName)
+	}
+	return ret
+}
+
+// `s` parsed as by Lua's `tonumber`: into an `int64` (or `uint64`) if an integer literal, else a `float64`, else nil
+func constParse(s string) any {
+	if i, ok := new(big.Int).SetString(s, 0); ok {
+		return constInt(i)
+	} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return nil
+}
+
+func constInt(i *big.Int) any {
+	if i.IsInt64() {
+		return i.Int64()
+	} else if i.IsUint64() {
+		return i.Uint64()
+	}
+	return nil
+}
+
+func constBigInt(val any) (*big.Int, bool) {
+	switch val := val.(type) {
+	case int64:
+		return big.NewInt(val), true
+	case uint64:
+		return new(big.Int).SetUint64(val), true
+	}
+	return nil, false
+}
+
+func constFloat(val any) (float64, bool) {
+	switch val := val.(type) {
+	case int64:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case float64:
+		return val, true
+	}
+	return 0, false
+}
+
+// whether `op` is `/`, `//` or `%` and the constant `rhs` is zero
+func constIsZeroDivisor(op string, rhs any) bool {
+	f, is := constFloat(rhs)
+	return is && (f == 0) && ((op == "/") || (op == "//") || (op == "%"))
+}
+
+// the 64 bits of the constant integer `val`, as Lua's bitwise operators operate on
+func constBits64(val any) uint64 {
+	if i, is := val.(int64); is {
+		return uint64(i)
+	}
+	return val.(uint64)
+}
+
+func constBits(op string, bits1 uint64, bits2 uint64) int64 {
+	switch op {
+	case "&":
+		return int64(bits1 & bits2)
+	case "|":
+		return int64(bits1 | bits2)
+	case "~":
+		return int64(bits1 ^ bits2)
+	}
+	if shift := int64(bits2); (shift <= -64) || (shift >= 64) {
+		return 0
+	} else if (shift < 0) != (op == ">>") { // a negative shift shifts the other way, as in Lua
+		return int64(bits1 >> util.If(shift < 0, -shift, shift))
+	} else {
+		return int64(bits1 << util.If(shift < 0, -shift, shift))
+	}
+}
+
+// the constant `val` as Lua's `tostring` would have it, for strs and numbers (and bools)
+func constStr(val any) (string, bool) {
+	switch val := val.(type) {
+	case string:
+		return val, true
+	case bool:
+		return str.FromBool(val), true
+	case int64:
+		return str.FromI64(val, 10), true
+	case uint64:
+		return str.FromI64(int64(val), 10), true // wrapped-around, as in Lua
+	case float64:
+		if math.IsInf(val, 0) || math.IsNaN(val) {
+			return "", false
+		}
+		ret := strconv.FormatFloat(val, 'g', 14, 64)
+		if !str.Has(ret, ".") && !str.Has(ret, "e") {
+			ret += ".0"
+		}
+		return ret, true
+	}
+	return "", false
+}
+
+// whether the constants `val1` and `val2` are equal as per Lua's `==`, unless arrs, tuples or dicts (being
+// compared by identity)
+func constEq(val1 any, val2 any) (bool, bool) {
+	if cmp, is := constCmp(val1, val2); is {
+		return cmp == 0, true
+	}
+	switch val1.(type) {
+	case []any, map[any]any:
+		return false, false
+	}
+	switch val2.(type) {
+	case []any, map[any]any:
+		return false, false
+	}
+	return val1 == val2, true
+}
+
+// the comparison of the constants `val1` and `val2` if both numbers or both strs
+func constCmp(val1 any, val2 any) (int, bool) {
+	if s1, is1 := val1.(string); is1 {
+		s2, is2 := val2.(string)
+		return cmp.Compare(s1, s2), is2
+	}
+	i1, is_int1 := constBigInt(val1)
+	i2, is_int2 := constBigInt(val2)
+	if is_int1 && is_int2 {
+		return i1.Cmp(i2), true
+	}
+	f1, is_num1 := constFloat(val1)
+	f2, is_num2 := constFloat(val2)
+	if is_num1 && is_num2 && !(math.IsNaN(f1) || math.IsNaN(f2)) {
+		return cmp.Compare(f1, f2), true
+	}
+	return 0, false
+}
+
+// the constant items of an arr or tuple literal, with those of any constant `...foo` spreads
+func constItems(items Exprs) any {
+	ret := make([]any, 0, len(items))
+	for _, item := range items {
+		if spread, _ := item.(*ExprSpread); spread != nil {
+			spread_items, is := spread.Subj.Base().Const.([]any)
+			if !is {
+				return nil
+			}
+			ret = append(ret, spread_items...)
+		} else if val := item.Base().Const; val == nil {
+			return nil
+		} else {
+			ret = append(ret, val)
+		}
+	}
+	return ret
+}
+
+func constRange(it *ExprRange) any {
+	from, is_from := constOf(it.From).(int64)
+	to, is_to := constOf(it.To).(int64)
+	step, is_step := int64(1), true
+	if it.Step != nil {
+		step, is_step = constOf(it.Step).(int64)
+	}
+	if !(is_from && is_to && is_step) || (step == 0) {
+		return nil
+	}
+	if it.IsExclusive {
+		to -= util.If(step < 0, int64(-1), int64(1))
+	}
+	if num := (to-from)/step + 1; num > constRangeMaxLen {
+		return nil
+	}
+	ret := []any{}
+	for i := from; util.If(step < 0, i >= to, i <= to); i += step {
+		ret = append(ret, i)
+	}
+	return ret
+}
+
+func constDict(it *ExprDict) any {
+	ret := map[any]any{}
+	for _, entry := range it.Entries {
+		if spread, _ := entry.Val.(*ExprSpread); spread != nil {
+			entries, is := spread.Subj.Base().Const.(map[any]any)
+			if !is {
+				return nil
+			}
+			for key, val := range entries {
+				ret[key] = val
+			}
+			continue
+		}
+		key, val := any(entry.Name), constOf(entry.Val)
+		if entry.Key != nil {
+			key = entry.Key.Base().Const
+		}
+		switch key.(type) {
+		case string, bool, int64, uint64, float64:
+		default:
+			return nil
+		}
+		if (val == nil) || ((entry.Key == nil) && (entry.Name == "")) {
+			return nil
+		}
+		ret[key] = val
+	}
+	return ret
+}
+
+// the constant item (or slice) of `it`, with out-of-bounds indices already reported by `typeChecker.checkIndex`
+func constIndex(it *ExprIndex) any {
+	rng, _ := it.Index.(*ExprRange)
+	switch subj := it.Subj.Base().Const.(type) {
+	case map[any]any:
+		if idx := constOf(it.Index); idx != nil {
+			return subj[idx]
+		}
+	case []any:
+		if rng != nil {
+			if idxs := constSliceIdxs(rng, len(subj)); idxs != nil {
+				return sl.To(idxs, func(idx int) any { return subj[idx] }).ToAnys()
+			}
+		} else if idx, is := constOf(it.Index).(int64); is && (idx >= 0) && (idx < int64(len(subj))) {
+			return subj[idx]
+		}
+	case string:
+		if rng != nil {
+			if idxs := constSliceIdxs(rng, len(subj)); idxs != nil {
+				return string(sl.To(idxs, func(idx int) byte { return subj[idx] }))
+			}
+		}
+	}
+	return nil
+}
+
+// the indices into `length` items of slicing them by `rng`, if all its bounds are constants within those of the items
+func constSliceIdxs(rng *ExprRange, length int) []int {
+	from, to, step := int64(0), int64(length), int64(1)
+	var is_from, is_to, is_step bool = true, true, true
+	if rng.From != nil {
+		from, is_from = rng.From.Base().Const.(int64)
+	}
+	if rng.To != nil {
+		to, is_to = rng.To.Base().Const.(int64)
+		to += util.If(rng.IsExclusive, int64(0), int64(1))
+	}
+	if rng.Step != nil {
+		step, is_step = rng.Step.Base().Const.(int64)
+	}
+	if !(is_from && is_to && is_step) || (step <= 0) || (from < 0) || (to > int64(length)) || (from > to) {
+		return nil
+	}
+	ret := []int{}
+	for i := from; i < to; i += step {
+		ret = append(ret, int(i))
+	}
+	return ret
+}
+
+// the `Const` of `expr`, if any
+func constOf(expr Expr) any {
+	if expr == nil {
+		return nil
+	}
+	return expr.Base().Const
+}
+
+// the number of items (or bytes) of the constant arr, tuple or str `val`, else -1
+func constLen(val any) int {
+	switch val := val.(type) {
+	case []any:
+		return len(val)
+	case string:
+		return len(val)
+	}
+	return -1
+}
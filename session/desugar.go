@@ -0,0 +1,185 @@
+package session
+
+import (
+	"loon/util/str"
+)
+
+// only called by `SrcPack.treesRefresh`, right after all `SrcFile.exprsRefresh`s: in all `me.Files`, expands the
+// exprs with `_`-prefixed placeholders (such as `_ + 1` or `_first + " " + _last`) into funcs with one `__a0__`-like
+// param per distinct placeholder name, in order of first appearance: `(__a0__) -> __a0__ + 1`.
+//
+// The boundary (the expr becoming the func body) is the innermost expr slot properly containing (rather than just
+// being) the placeholder. Slots are: statements, call args, indices, arr and tuple items, dict values, the right-hand
+// sides of assignments, param defaults, `<-` and `<~` values, the parts of conds, the subjects of switches and loops,
+// `?!` fallbacks, `?>` callees, and any parensed expr. Operands, member-access subjects, (non-parensed) callees and interpolated
+// string parts are not. So `foo(_ + 1)` is `foo((__a0__) -> __a0__ + 1)`, but `foo(_)` is `(__a0__) -> foo(__a0__)`,
+// and `my_numbers[_ % 2 == 1]` filters by `(__a0__) -> __a0__ % 2 == 1` (see `typeChecker.typeOfIndex`).
+//
+// The func spans its boundary expr, each param the first occurrence of its placeholder, and the renamed placeholders
+// keep their own spans, so that diags and hovers still point at the source as written.
+func (me *SrcPack) desugarRefresh() {
+	for _, src_file := range me.filesWithExprs() {
+		desugar := desugarer{bound: map[string]int{}}
+		desugar.stmts(src_file.Trees.Exprs)
+	}
+}
+
+type desugarer struct {
+	bound map[string]int // the `_foo` names bound (not placeholders) in the `ExprSwitchCase` bodies being desugared
+}
+
+// `_`, or `_foo`, but neither `_Foo` (as in Lua's `_G` and `_ENV`) nor `__foo` (as in the desugared `__a0__`)
+func exprIsPlaceholder(name string) bool {
+	return (name == "_") || ((len(name) > 1) && (name[0] == '_') && (name[1] != '_') && !str.IsUp(name[1:2]))
+}
+
+func (me *desugarer) stmts(stmts Exprs) {
+	for i := range stmts {
+		me.sub(&stmts[i], true)
+	}
+}
+
+// desugars the expr at `ptr`, which is replaced by its func expansion if a boundary (if `isSlot`, or parensed) that
+// properly contains placeholders. Returns the placeholders left for an enclosing boundary
+func (me *desugarer) sub(ptr *Expr, isSlot bool) (free []*ExprIdent) {
+	expr := *ptr
+	if expr == nil {
+		return nil
+	}
+	if free = me.expr(expr); len(free) == 0 {
+		return
+	}
+	if ident, _ := expr.(*ExprIdent); (ident != nil) || !(isSlot || exprIsParensed(expr)) {
+		return
+	}
+	fn := &ExprFunc{ExprBase: ExprBase{Toks: expr.Base().Toks}, Body: Exprs{expr}, IsDesugared: true}
+	params := map[string]*ExprIdent{}
+	for _, ident := range free {
+		param := params[ident.Name]
+		if param == nil {
+			param = &ExprIdent{ExprBase: ExprBase{Toks: ident.Toks}, Name: "__a" + str.FromInt(len(fn.Params)) + "__"}
+			params[ident.Name] = param
+			fn.Params, fn.ParamTypes, fn.ParamDefaults = append(fn.Params, param), append(fn.ParamTypes, nil), append(fn.ParamDefaults, nil)
+		}
+		ident.Name = param.Name
+	}
+	*ptr = fn
+	return nil
+}
+
+func (me *desugarer) expr(expr Expr) (free []*ExprIdent) {
+	sub := func(ptr *Expr, isSlot bool) {
+		free = append(free, me.sub(ptr, isSlot)...)
+	}
+	switch it := expr.(type) {
+	case *ExprIdent:
+		if exprIsPlaceholder(it.Name) && (me.bound[it.Name] == 0) {
+			free = append(free, it)
+		}
+	case *ExprMember:
+		sub(&it.Subj, false)
+	case *ExprIndex:
+		sub(&it.Subj, false)
+		sub(&it.Index, true)
+	case *ExprCall:
+		sub(&it.Callee, false)
+		for i := range it.Args {
+			sub(&it.Args[i], !it.IsUnary) // so that `Int _` type tests stay whole
+		}
+	case *ExprOpBinary:
+		sub(&it.Lhs, false)
+		sub(&it.Rhs, false)
+	case *ExprOpUnary:
+		sub(&it.Operand, false)
+	case *ExprErrUnion:
+		sub(&it.Subj, false)
+		sub(&it.OnErr, true)
+	case *ExprNilSafeCall:
+		sub(&it.Subj, false)
+		sub(&it.Callee, true)
+	case *ExprTuple:
+		for i := range it.Items {
+			sub(&it.Items[i], true)
+		}
+	case *ExprArr:
+		for i := range it.Items {
+			sub(&it.Items[i], true)
+		}
+	case *ExprSpread:
+		sub(&it.Subj, false)
+	case *ExprDict:
+		for _, entry := range it.Entries {
+			sub(&entry.Key, true)
+			sub(&entry.Val, true)
+		}
+	case *ExprRange:
+		sub(&it.From, false)
+		sub(&it.To, false)
+		sub(&it.Step, false)
+	case *ExprStrInterp:
+		for i := range it.Parts {
+			sub(&it.Parts[i], false)
+		}
+	case *ExprLoop:
+		sub(&it.Subj, true)
+		me.stmts(it.Body.Body)
+	case *ExprFunc: // its params (and their types) are not exprs to desugar, but their defaults are
+		for i := range it.ParamDefaults {
+			sub(&it.ParamDefaults[i], true)
+		}
+		me.stmts(it.Body)
+	case *ExprCond:
+		sub(&it.Cond, true)
+		sub(&it.Then, true)
+		sub(&it.Else, true)
+	case *ExprSwitch:
+		sub(&it.Subj, true)
+		for _, case_ := range it.Cases { // the conds are not desugared: their `_`s are the scrutinee or bind parts of it
+			var bound []string
+			for _, cond := range case_.Conds {
+				if kind := ExprSwitchCondKindOf(cond); (kind == ExprSwitchCondCatchAll) || (kind == ExprSwitchCondPattern) {
+					ExprWalk(cond, func(it Expr) bool {
+						if ident, _ := it.(*ExprIdent); (ident != nil) && exprIsPlaceholder(ident.Name) && (ident.Name != "_") {
+							bound = append(bound, ident.Name)
+						}
+						return true
+					})
+				}
+			}
+			for _, name := range bound {
+				me.bound[name]++
+			}
+			sub(&case_.Body, true)
+			for _, name := range bound {
+				me.bound[name]--
+			}
+		}
+	case *ExprBlock:
+		me.stmts(it.Stmts)
+	case *ExprAssign: // not its `Lhs`, being a name, destructuring pattern or assignable
+		sub(&it.Rhs, true)
+	case *ExprReturn:
+		sub(&it.Val, true)
+	}
+	return
+}
+
+// whether `expr` is enclosed in parens (of its own, not as in `(foo) + (bar)`)
+func exprIsParensed(expr Expr) bool {
+	toks := expr.Base().Toks
+	if (len(toks) < 2) || (toks[0].Src != "(") || (toks[len(toks)-1].Src != ")") {
+		return false
+	}
+	depth := 0
+	for i, tok := range toks {
+		if tok.Src == "(" {
+			depth++
+		} else if tok.Src == ")" {
+			depth--
+		}
+		if (depth == 0) && (i < len(toks)-1) {
+			return false
+		}
+	}
+	return true
+}
@@ -48,12 +48,17 @@ const (
 	ErrCodeNotComparable         DiagCode = "NotComparable"
 	ErrCodeNotConvertible        DiagCode = "NotConvertible"
 	ErrCodeDuplTopDecl           DiagCode = "DuplTopDecl"
+	ErrCodeShadowing             DiagCode = "Shadowing"
 	ErrCodeTypeMismatch          DiagCode = "TypeMismatch"
 	ErrCodeTypeInfinite          DiagCode = "TypeInfinite"
 	ErrCodeComputationFailed     DiagCode = "ComputationFailed"
 	ErrCodeNotTypifiable         DiagCode = "Untypifiable"
 	ErrCodeOrFuncsParamsMismatch DiagCode = "OrFuncsParamsCountMismatch"
 	ErrCodeDivModZero            DiagCode = "NumDivModZero"
+	ErrCodeNotInMethod           DiagCode = "NotInMethodContext"
+	ErrCodeNotImplementing       DiagCode = "NotImplementing"
+	ErrCodeErrIgnored            DiagCode = "ErrorIgnored"
+	ErrCodeMisplaced             DiagCode = "Misplaced"
 
 	// semantic (warnings / infos / hints)
 	HintCodeUnused DiagCode = "Unused"
@@ -88,12 +93,17 @@ var (
 		ErrCodeNotComparable:         "operands `%s` and `%s` cannot be compared in %s terms",
 		ErrCodeNotConvertible:        "cannot convert `%s` to %s",
 		ErrCodeDuplTopDecl:           "top-level declaration `%s` already defined",
+		ErrCodeShadowing:             "`%s` is already declared in this or an enclosing scope, and shadowing is disallowed",
 		ErrCodeTypeMismatch:          "expected %s instead of %s",
 		ErrCodeTypeInfinite:          "infinite type detected: `%s`",
 		ErrCodeComputationFailed:     "%v",
 		ErrCodeNotTypifiable:         "expression untypifiable",
 		ErrCodeOrFuncsParamsMismatch: "union of funcs with different parameter counts (%d vs. %d) not callable",
 		ErrCodeDivModZero:            "(potential) division by zero",
+		ErrCodeNotInMethod:           "`%s` is valid only in method contexts",
+		ErrCodeNotImplementing:       "`%s` does not implement `%s`: %s",
+		ErrCodeErrIgnored:            "the error that `%s` may fail with is neither handled by `?!` nor, being outside of any func, propagated",
+		ErrCodeMisplaced:             "`%s` is valid only inside %s",
 
 		HintCodeUnused: "code unreachable or without effects (and will be discarded by code generation)",
 	}
@@ -149,6 +159,7 @@ func (me *SrcFile) allDiags() (ret Diags) {
 			ret.Add(node.errParsing)
 		}
 	})
+	ret.Add(me.diags.TreesDiags...)
 	return
 }
 
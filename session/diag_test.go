@@ -0,0 +1,144 @@
+package session
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiagsScopes(t *testing.T) {
+	diagsTest(t, []diagsTestCase{
+		{"print(foo)\n", []string{"NotDefined@1,7-1,10"}},
+		{"print(x)\nx := 1\n", nil}, // top-level decls are usable before their declaration
+		{"f := () ->\n  print(b)\n  b := 1\n  print(b)\nprint(f)\n", []string{"NotDefined@2,9-2,10"}}, // but locals are not
+		{"x := 1\nx := 2\nprint(x)\n", []string{"DuplTopDecl@2,1-2,2 rel@1,1-1,2"}},
+		{"f := (a) ->\n  b := 1\n  b := 2\n  print(a, b)\nprint(f)\n", []string{"Shadowing@3,3-3,4 rel@2,3-2,4"}},
+		{"f := (a) ->\n  a := 2\n  print(a)\nprint(f)\n", []string{"Shadowing@2,3-2,4 rel@1,7-1,8"}},
+		{"f := (a) ->\n  [a, b] := [1, 2]\n  print(a, b)\nprint(f)\n", []string{"Shadowing@2,4-2,5 rel@1,7-1,8"}},
+		{"f := ({a}) ->\n  a := 2\n  print(a)\nprint(f)\n", []string{"Shadowing@2,3-2,4 rel@1,8-1,9"}}, // also of destructured params
+		{"f := () ->\n  b := 1\n  print(b)\ng := () ->\n  b := 2\n  print(b)\nprint(f, g)\n", nil},     // sibling scopes
+		{"_x := 1\n", []string{"Reserved@1,1-1,3"}},
+		{"x := 1\nx = 2\n_y = 3\n", []string{"Reserved@3,1-3,3"}},
+		{"x := 1\nx\n", []string{"Unused@2,1-2,2"}},
+		{"f := () ->\n  <- 1\n  print(2)\n  print(3)\nprint(f)\n", []string{"Unused@3,3-4,11"}},
+		// unused locals, unless with effects
+		{"f := () ->\n  x := 1\n  g := () -> 2\n  print(3)\nprint(f)\n", []string{"Unused@2,3-2,9", "Unused@3,3-3,15"}},
+		{"f := () ->\n  x := math.random()\n  print(3)\nprint(f)\n", nil},
+		{"f := () ->\n  x := 1\n  print(x)\nprint(f)\n", nil},
+		{"f := () ->\n  x := 1\n  x = 2\nprint(f)\n", nil},
+		{"f := () ->\n  g := () -> g()\n  print(3)\nprint(f)\n", nil}, // referring to itself
+		{"f := () ->\n  [a, b] := [1, 2]\n  print(a)\nprint(f)\n", nil},
+		{"f := (a) -> 1\nprint(f)\n", nil}, // params need not be used
+		{"x := 1\n", nil},                  // top-level decls may be used by other files
+	})
+}
+
+func TestDiagsStructs(t *testing.T) {
+	const pet = "Pet :=\n  name: Str\n  greet: () -> print(.name)\n"
+	diagsTest(t, []diagsTestCase{
+		{pet + "pet := Pet { name: \"Rex\" }\npet.greet()\nprint(pet.name)\n", nil},
+		{pet + "pet := Pet { name: \"Rex\", nme: \"x\" }\nprint(pet.nam)\n", []string{"NoSuchField@4,27-4,35", "NoSuchField@5,7-5,14"}},
+		{pet + "print(Pet.greet)\n", []string{"NoSuchField@4,7-4,16"}}, // an instance method, not a static one
+		{pet + "greetAll := () -> greet()\nprint(greetAll)\n", []string{"NotDefined@4,19-4,24"}},
+		{"print(.name)\n", []string{"NotInMethodContext@1,7-1,8"}},
+		{"f := () -> print(.name)\nprint(f)\nf()\n", []string{"NotInMethodContext@3,1-3,4"}}, // fine in standalone funcs, but not in their calls
+		// out-of-line methods, and members promoted from embeds
+		{"Cat :=\n  name: Str\nCat.meow := () -> print(.name)\ncat := Cat { name: \"Tom\" }\ncat.meow()\ncat.bark()\n", []string{"NoSuchField@6,1-6,9"}},
+		{"Animal :=\n  legs: Int\nCat :=\n  _: Animal\n  name: Str\ncat := Cat { name: \"Tom\", legs: 4 }\nprint(cat.legs, cat.wings)\n", []string{"NoSuchField@7,17-7,26"}},
+	})
+}
+
+func TestDiagsInterfaces(t *testing.T) {
+	const greeter = "Greeter :=\n  greet: (Str) -> Str\nwelcome := (g: Greeter) -> print(g.greet(\"you\"))\n"
+	diagsTest(t, []diagsTestCase{
+		{greeter + "Dog :=\n  x: Str\n  greet: (n: Str) -> n + .x\nwelcome(Dog { x: \"!\" })\n", nil},
+		{greeter + "Dog :=\n  x: Int\n  greet: (n: Int) -> n + .x\nwelcome(Dog { x: 1 })\n",
+			[]string{"NotImplementing@7,9-7,21 rel@2,3-2,22 rel@6,3-6,28"}},
+		{greeter + "Dog :=\n  x: Str\nDog.greet := (n: Str) -> n + .x\nwelcome(Dog { x: \"!\" })\n", nil}, // out-of-line methods implement too
+		{greeter + "welcome(Greeter { greet: (n) -> n })\n", nil},                                         // as do filled func-fields
+		// a func-field not using the `.` instance is static, so no implementation of an instance method
+		{greeter + "Dog :=\n  x: Int\n  greet: (n: Str) -> \"woof\"\nwelcome(Dog { x: 1 })\n",
+			[]string{"NotImplementing@7,9-7,21 rel@2,3-2,22"}},
+	})
+}
+
+func TestDiagsSwitches(t *testing.T) {
+	const three = "three := math.random() < 0.5 ? 3 : \"three\"\n"
+	diagsTest(t, []diagsTestCase{
+		{"name := \"Dan\"\nname ?..\n  \"Rob\":\n    print(1)\n  \"Rob\":\n    print(2)\n", []string{"DictDuplKey@5,3-5,8"}},
+		// also among multi-key cases
+		{"name := \"Dan\"\nname ?..\n  \"Bob\", \"Rob\":\n    print(1)\n  \"Rob\":\n    print(2)\n", []string{"DictDuplKey@5,3-5,8"}},
+		{"name := \"Dan\"\nname ?..\n  \"Rob\":\n    print(1)\n", nil}, // statements need no fallback case
+		{"name := \"Dan\"\nx := name ?..\n  \"Rob\": 1\n  \"Dan\": 2\nprint(x)\n", []string{"ElseCaseMissing@2,6-2,14"}},
+		{"name := \"Dan\"\nx := name ?..\n  \"Rob\": 1\n  _: 2\nprint(x)\n", nil},
+		// exhaustiveness over union-typed scrutinees
+		{three + "num := three ?..\n  Int _: 1\n  Str _: 2\nprint(num)\n", nil},
+		{three + "num := three ?..\n  Int _: 1\nprint(num)\n", []string{"ElseCaseMissing@2,8-2,17"}},
+		{three + "num := three ?..\n  Int _: 1\n  _: 2\nprint(num)\n", nil},
+		{"flag := math.random() < 0.5\nprint(flag ?.. { true: \"yes\", false: \"no\" })\n", nil},
+		{"flag := math.random() < 0.5\nprint(flag ?.. { true: \"yes\" })\n", []string{"ElseCaseMissing@2,7-2,31"}},
+	})
+}
+
+func TestDiagsRanges(t *testing.T) {
+	diagsTest(t, []diagsTestCase{
+		{"r := 5..2\nprint(r)\n", []string{"RangeNegative@1,6-1,10"}},
+		{"r := 2..5\nprint(r, 1...15\\2)\n", nil},
+		{"r := 3..3\nprint(r, 3...3)\n", nil}, // empty or of one item, but not negative
+		{"print(10...1)\n", []string{"RangeNegative@1,7-1,13"}},
+		{"print([\"a\", \"b\"][5])\n", []string{"IndexOutOfBounds@1,18-1,19"}},
+		{"print([\"a\", \"b\"][-1])\n", []string{"IndexOutOfBounds@1,18-1,20"}},
+		{"print([\"a\", \"b\"][1..4])\n", []string{"IndexOutOfBounds@1,21-1,22"}},
+		{"print(\"abc\"[1..9], \"abc\"[..3], \"abc\"[1..])\n", []string{"IndexOutOfBounds@1,16-1,17"}},
+	})
+}
+
+func TestDiagsConsts(t *testing.T) {
+	diagsTest(t, []diagsTestCase{
+		{"x := 1 / 0\nprint(x)\n", []string{"NumDivModZero@1,10-1,11"}},
+		{"x := 7 % (2 - 2)\nprint(x)\n", []string{"NumDivModZero@1,10-1,17"}},
+		{"z := 0\nprint(z / 0, 0 / z)\n", []string{"NumDivModZero@2,11-2,12"}}, // for non-constant dividends, too
+		{"x := 9223372036854775807 + 1\nprint(x)\n", []string{"ComputationFailed@1,6-1,29"}},
+		{"x := 18446744073709551615 * 2\nprint(x)\n", []string{"ComputationFailed@1,6-1,30"}},
+		{"x := 18446744073709551615 - 1\nprint(x)\n", nil},
+		{"print(Int(\"42\"), Int(\" 7 \"), Float(\"4\"), Float(1), Str(true), Str([1]))\n", nil},
+		{"print(Int(\"4x\"), Float(\"x\"), Int(1.5))\n", []string{"NotConvertible@1,11-1,15", "NotConvertible@1,24-1,27", "NotConvertible@1,34-1,37"}},
+		{"print(Int(true))\n", []string{"NotConvertible@1,11-1,15"}},
+		{"b := true\nprint(Int(b))\n", []string{"TypeMismatch@2,11-2,12"}}, // not constant, so not foldable
+	})
+}
+
+func TestDiagsFilterLoops(t *testing.T) {
+	const nums = "nums := [1, 2, 3]\n"
+	diagsTest(t, []diagsTestCase{
+		{nums + "nums[_ % 2 == 1] print\n", nil},
+		{nums + "nums[(n) -> n > 1] (i, n) -> print(i, n)\n", nil},
+		{nums + "f := (s: Str) -> print(s)\nnums[_ > 1] f\n", []string{"TypeMismatch@3,13-3,14"}}, // items are `Int`s
+		{nums + "nums[_ > 1] 5\n", []string{"TypeMismatch@2,13-2,14"}},
+		{"n := 5\nn[_ > 1] print\n", []string{"TypeMismatch@2,1-2,2"}}, // only once, not also as the loop's
+	})
+}
+
+type diagsTestCase struct {
+	src      string
+	expected []string // each diag as `Code@span`, followed by a ` rel@span` for each of its `Rel` spans
+}
+
+// checks that each `testCases` src, as a one-file `SrcPack`, has exactly its `expected` diags (in order)
+func diagsTest(t *testing.T, testCases []diagsTestCase) {
+	for _, it := range testCases {
+		file, _ := intelTestFile(t, it.src, -1)
+		var actual []string
+		for _, diag := range file.allDiags() {
+			diag_str := string(diag.Code) + "@" + diag.Span.String()
+			for _, rel := range diag.Rel {
+				for _, span := range rel.Spans {
+					diag_str += " rel@" + span.String()
+				}
+			}
+			actual = append(actual, diag_str)
+		}
+		if !slices.Equal(actual, it.expected) {
+			t.Errorf("%s\nexpected %q\n     got %q", it.src, it.expected, actual)
+		}
+	}
+}
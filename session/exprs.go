@@ -0,0 +1,1143 @@
+package session
+
+import (
+	"loon/session/ty"
+	"loon/util"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+// Expr is any node of the typed expression layer, built (by `SrcFile.exprsRefresh`)
+// on top of a `SrcFile`'s token-tree `AstNodes`.
+type Expr interface {
+	Base() *ExprBase
+}
+type Exprs sl.Of[Expr]
+
+type ExprBase struct {
+	Toks  Toks
+	Type  ty.Type // as inferred by `SrcPack.typesRefresh`, nil for type exprs and unreachable code
+	Const any     // the compile-time value if composed only of literals, as folded by `SrcPack.typesRefresh`, else nil
+}
+
+func (me *ExprBase) Base() *ExprBase { return me }
+
+// foo, bar, @baz
+type ExprIdent struct {
+	ExprBase
+	Name string
+	Decl *Decl // as resolved by `SrcPack.scopesRefresh`, nil for builtins, `_G`-like Lua globals and undefined names
+}
+
+// 123, 1.23, "foo", 'ö', true, nil
+type ExprLit struct {
+	ExprBase
+	Val any // one of: nil | bool | float64 | int64 | uint64 | rune | string
+}
+
+// `.`, the instance in instance methods, as also in `.foo` (the `ExprMember` of it)
+type ExprSelf struct {
+	ExprBase
+}
+
+// foo.bar, or the nil-safe foo?.bar (being `nil` if `foo` is)
+type ExprMember struct {
+	ExprBase
+	Subj      Expr
+	Name      string
+	IsNilSafe bool
+}
+
+// foo[bar]
+type ExprIndex struct {
+	ExprBase
+	Subj  Expr
+	Index Expr
+}
+
+// foo(bar, baz), or if `IsUnary`: the whitespace-separated `foo bar`
+type ExprCall struct {
+	ExprBase
+	Callee  Expr
+	Args    Exprs
+	IsUnary bool
+}
+
+// TypeTest returns the tested type's name and the tested expr if `me` is a type test such as `Int foo`, else "" and `nil`.
+func (me *ExprCall) TypeTest() (typeName string, subj Expr) {
+	if callee, _ := me.Callee.(*ExprIdent); me.IsUnary && (len(me.Args) == 1) && (callee != nil) && (callee.Decl == nil) &&
+		((callee.Name == "Bool") || (callee.Name == "Int") || (callee.Name == "Float") || (callee.Name == "Str")) {
+		return callee.Name, me.Args[0]
+	}
+	return "", nil
+}
+
+// Conversion returns the target type's name and the converted expr if `me` is a conversion call such as `Int("123")`
+// (with parens, unlike type tests), else "" and `nil`. Conversions of strs that don't parse (and of non-integral
+// numbers to `Int`) result in `nil` at run time, or if constant, in a `NotConvertible` error diag.
+func (me *ExprCall) Conversion() (typeName string, subj Expr) {
+	if callee, _ := me.Callee.(*ExprIdent); (!me.IsUnary) && (len(me.Args) == 1) && (callee != nil) && (callee.Decl == nil) &&
+		((callee.Name == "Int") || (callee.Name == "Float") || (callee.Name == "Str")) {
+		return callee.Name, me.Args[0]
+	}
+	return "", nil
+}
+
+// FilterLoop returns the filtering `foo[pred]` and `bar` if `me` is a (desugared) loop such as `my_numbers[_ % 2 == 1] print`,
+// calling `bar` with each item of the arr `foo` that satisfies `pred` (without constructing the filtered arr), else `nil`s.
+func (me *ExprCall) FilterLoop() (filter *ExprIndex, callee Expr) {
+	if index, _ := me.Callee.(*ExprIndex); me.IsUnary && (len(me.Args) == 1) && (index != nil) {
+		if _, is_filter := index.Index.(*ExprFunc); is_filter {
+			return index, me.Args[0]
+		}
+	}
+	return nil, nil
+}
+
+// foo + bar
+type ExprOpBinary struct {
+	ExprBase
+	Op  string
+	Lhs Expr
+	Rhs Expr
+}
+
+// foo ?! bar: in type exprs, the error union type (as in `Expr ?! ParseError`), else the handling of the error (if any)
+// that `Subj` results in, by either calling the handler func `OnErr` with it (as in `foo ?! (err) -> bar`), or falling back
+// to the value `OnErr` (as in `foo ?! bar`). Without any such handling, errors propagate to the caller of the enclosing func.
+type ExprErrUnion struct {
+	ExprBase
+	Subj  Expr
+	OnErr Expr
+}
+
+// foo ?> bar: the call `bar(foo)` if `foo` is not `nil`, else `nil`
+type ExprNilSafeCall struct {
+	ExprBase
+	Subj   Expr
+	Callee Expr
+}
+
+// -foo, !bar, or the failing with an error `?! foo`
+type ExprOpUnary struct {
+	ExprBase
+	Op      string
+	Operand Expr
+}
+
+// (foo, bar)
+type ExprTuple struct {
+	ExprBase
+	Items Exprs
+}
+
+// [foo, bar]
+type ExprArr struct {
+	ExprBase
+	Items Exprs
+}
+
+// {foo: bar, "baz": 123, 1 + 2: 3, foo}, or the indent-based form with one `foo: bar` pair per line
+type ExprDict struct {
+	ExprBase
+	Entries []*ExprDictEntry
+}
+
+type ExprDictEntry struct {
+	ExprBase
+	Name    string // if the key is a plain identifier, in which case `Key` is nil
+	Key     Expr   // nil if `Name` is set or if the entry is positional (eg. `{ Int, Str }` tuple types)
+	Val     Expr   // for the `{ foo }` and `{ foo: }` shorthands, the `ExprIdent` of `Name`
+	Default Expr   // for struct type fields with a default value, as in `foo: Int = 123`, else nil
+}
+
+// ...foo, in arr, tuple and dict literals and in destructuring patterns (as in `[one, ...rest] := foo`)
+type ExprSpread struct {
+	ExprBase
+	Subj Expr
+}
+
+// foo...bar (inclusive), foo..bar (exclusive), with optional `\step`. As slicing indices, also the
+// open-ended ..bar (with `From` nil) and foo.. (with `To` nil), as in `items[..3]` and `items[1..]`
+type ExprRange struct {
+	ExprBase
+	From        Expr
+	To          Expr
+	Step        Expr // can be nil
+	IsExclusive bool
+}
+
+// "foo ${bar} baz"
+type ExprStrInterp struct {
+	ExprBase
+	Parts Exprs // `ExprLit` strings alternating with the embedded expressions
+}
+
+// (foo, bar) -> baz
+type ExprFunc struct {
+	ExprBase
+	Params        Exprs
+	ParamTypes    Exprs // for each of `Params`, its type expr if annotated (as in `(p: Parser) -> ...`), else nil
+	ParamDefaults Exprs // for each of `Params`, its default value if any (as in `(x = 100) -> ...`), else nil
+	Body          Exprs
+	IsDesugared   bool // if expanded from a `_ + 1`-like placeholder expr (see `SrcPack.desugarRefresh`)
+}
+
+// foo ? bar : baz, or the line-based form `?| foo` with an optional subsequent `|?` line
+type ExprCond struct {
+	ExprBase
+	Cond Expr
+	Then Expr
+	Else Expr // can be nil
+}
+
+// foo ?.. with its cases in dict form (either braces-and-commas or indent-based): the `Body` of the first of `Cases`
+// matching the scrutinee `Subj`, which is evaluated only once
+type ExprSwitch struct {
+	ExprBase
+	Subj  Expr
+	Cases []*ExprSwitchCase
+}
+
+// a case of an `ExprSwitch`, matching if any of its `Conds` does (as for `"Bob", "Rob": ...`, or for a case without
+// a body, which falls through to the next one): a value (compared via `==`), a guard with `_` placeholders for the
+// scrutinee (as in `_.len() > 3`), an arr, dict or tuple literal destructuring the scrutinee (with `_`-prefixed names
+// binding the parts they match, and others being compared via `==`), or a catch-all `_` or `_foo` (binding the scrutinee)
+type ExprSwitchCase struct {
+	ExprBase
+	Conds Exprs
+	Body  Expr
+}
+
+// ExprSwitchCondKind classifies the `Conds` of `ExprSwitchCase`s.
+type ExprSwitchCondKind int
+
+const (
+	ExprSwitchCondValue    ExprSwitchCondKind = iota // compared via `==`, as in `"Robert"`
+	ExprSwitchCondGuard                              // with `_` placeholders for the scrutinee, as in `_.len() > 3`
+	ExprSwitchCondPattern                            // an arr, dict or tuple literal, as in `(0, _y)`
+	ExprSwitchCondCatchAll                           // `_` or `_foo`
+)
+
+func ExprSwitchCondKindOf(cond Expr) ExprSwitchCondKind {
+	switch it := cond.(type) {
+	case *ExprIdent:
+		if str.Begins(it.Name, "_") {
+			return ExprSwitchCondCatchAll
+		}
+	case *ExprArr, *ExprDict, *ExprTuple:
+		return ExprSwitchCondPattern
+	}
+	is_guard := false
+	ExprWalk(cond, func(it Expr) bool {
+		ident, _ := it.(*ExprIdent)
+		is_guard = is_guard || ((ident != nil) && (ident.Name == "_"))
+		return !is_guard
+	})
+	return util.If(is_guard, ExprSwitchCondGuard, ExprSwitchCondValue)
+}
+
+// the for-style `iterable (key, val) -> body` or the while-style `cond -> body`
+type ExprLoop struct {
+	ExprBase
+	Subj Expr // the iterable or, if `IsWhile`, the condition
+	Body *ExprFunc
+}
+
+func (me *ExprLoop) IsWhile() bool { return len(me.Body.Params) == 0 }
+
+// indented lines
+type ExprBlock struct {
+	ExprBase
+	Stmts Exprs
+}
+
+// foo := bar, foo = bar, foo += bar etc., with `Lhs` being a destructuring pattern (such as `[foo, ...bar]`,
+// `(foo, bar)` or `{foo, _, bar}`) for declarations and plain assignments, and `foo .= { bar: baz }` being the field
+// update `foo = { ...foo, bar: baz }`
+type ExprAssign struct {
+	ExprBase
+	Op  string
+	Lhs Expr
+	Rhs Expr
+}
+
+// <- foo, or (if `OfBlock`) <~ foo
+type ExprReturn struct {
+	ExprBase
+	Val     Expr // can be nil
+	OfBlock bool // for `<~`, which returns `Val` from the enclosing block expr, rather than from the enclosing func
+}
+
+// ~>, skipping the rest of the current loop iteration (and, for loop exprs, its result)
+type ExprContinue struct {
+	ExprBase
+}
+
+const (
+	exprOpDecl   = ":="
+	exprOpAssign = "="
+	exprOpArrow  = "->"
+	exprOpReturn = "<-"
+	exprOpResult = "<~"
+	exprOpNext   = "~>"
+	exprOpCondQ  = "?"
+	exprOpCondIf = "?|"
+	exprOpCondEl = "|?"
+	exprOpErr    = "?!"
+	exprOpNilDot = "?."
+	exprOpNilFn  = "?>"
+	exprOpSwitch = "?.."
+	exprOpRange  = "..."
+	exprOpRangeX = ".."
+	exprOpSpread = "..."
+	exprOpUpdate = ".="
+	exprOpStep   = "\\"
+)
+
+// the update assignments: `foo += bar` is `foo = foo + bar` etc.
+var exprOpsAssign = []string{"+=", "-=", "*=", "/=", "//=", "%=", "^=", "&=", "|=", "~=", ">>=", "<<="}
+
+// binding powers for binary operators, higher binds tighter, same as Lua's
+var exprOpsBinary = map[string]int{
+	"||": 3, "&&": 4,
+	"==": 5, "!=": 5, "<": 5, ">": 5, "<=": 5, ">=": 5,
+	"|": 6, "~": 7, "&": 8, "<<": 9, ">>": 9,
+	"+": 11, "-": 11,
+	"*": 12, "/": 12, "//": 12, "%": 12,
+	"^": 14,
+}
+
+const (
+	exprPrecLowest = 0
+	exprPrecCond   = 1
+	exprPrecErr    = 1 // same as `exprPrecCond`, as both mostly enclose all the others
+	exprPrecUnary  = 2 // the whitespace-separated "unary callee" application `foo bar`
+	exprPrecRange  = 10
+	exprPrecPrefix = 13
+)
+
+var exprOpsPrefix = []string{"-", "!", "#", "~"}
+
+// only called by `SrcPack.treesRefresh`
+func (me *SrcFile) exprsRefresh() {
+	var diags Diags
+	me.Trees.Exprs = me.exprsFromLines(me.Src.Ast, &diags)
+	me.diags.TreesDiags = diags
+}
+
+func (me *SrcFile) exprsFromLines(lines AstNodes, diags *Diags) (ret Exprs) {
+	for _, line := range lines {
+		if line.Kind == AstNodeKindComment {
+			continue
+		}
+		header, children := line.lineParts()
+		if len(header) == 0 {
+			if len(children) > 0 {
+				ret = append(ret, me.exprBlock(children, diags))
+			}
+			continue
+		}
+
+		if header[0].ident() == exprOpCondEl {
+			var cond *ExprCond
+			if len(ret) > 0 {
+				cond, _ = ret[len(ret)-1].(*ExprCond)
+			}
+			if cond == nil {
+				diags.Add(header[0].newDiagErr(false, ErrCodeExpectedFoo, "a preceding `"+exprOpCondIf+"` line"))
+				continue
+			}
+			for cond.Else != nil {
+				if cond, _ = cond.Else.(*ExprCond); cond == nil {
+					break
+				}
+			}
+			if cond == nil {
+				diags.Add(header[0].newDiagErr(false, ErrCodeExpectedFoo, "no more than one unconditional `"+exprOpCondEl+"` line"))
+				continue
+			}
+			if len(header) == 1 {
+				cond.Else = me.exprBlock(children, diags)
+			} else {
+				cond.Else = &ExprCond{ExprBase: ExprBase{Toks: line.Toks}, Cond: me.exprFrom(header[1:], nil, diags), Then: me.exprBlock(children, diags)}
+			}
+			continue
+		}
+
+		stmt, unused_children := me.exprStmt(line, header, children, diags)
+		ret = append(ret, stmt)
+		if len(unused_children) > 0 {
+			ret = append(ret, me.exprBlock(unused_children, diags))
+		}
+	}
+	return
+}
+
+func (me *SrcFile) exprStmt(line *AstNode, header AstNodes, children AstNodes, diags *Diags) (Expr, AstNodes) {
+	switch header[0].ident() {
+	case exprOpCondIf:
+		if len(header) == 1 {
+			diags.Add(header[0].newDiagErr(true, ErrCodeExpectedFoo, "condition"))
+		}
+		return &ExprCond{ExprBase: ExprBase{Toks: line.Toks},
+			Cond: me.exprFrom(header[1:], nil, diags), Then: me.exprBlock(children, diags)}, nil
+	}
+
+	for i, node := range header {
+		if op := node.ident(); (i > 0) && node.IsIdentOpish() && ((op == exprOpDecl) || (op == exprOpAssign) || (op == exprOpUpdate) || sl.Has(exprOpsAssign, op)) {
+			ret := &ExprAssign{ExprBase: ExprBase{Toks: line.Toks}, Op: op, Lhs: me.exprFrom(header[:i], nil, diags)}
+			if _, is_member := ret.Lhs.(*ExprMember); (op == exprOpDecl) && !is_member {
+				if bad := ExprPatternErr(ret.Lhs); bad != nil {
+					diags.Add(bad.Base().Toks.newDiagErr(false, ErrCodeExpectedFoo, "name or destructuring pattern"))
+				}
+			}
+			if rhs := header[i+1:]; len(rhs) > 0 {
+				p := exprParser{srcFile: me, diags: diags, nodes: rhs, children: children}
+				ret.Rhs = p.parseAll()
+				return ret, p.children
+			} else if len(children) == 0 {
+				diags.Add(node.newDiagErr(true, ErrCodeExpectedFoo, "expression to the right of `"+op+"`"))
+			} else {
+				ret.Rhs = me.exprBlock(children, diags)
+			}
+			return ret, nil
+		}
+	}
+
+	p := exprParser{srcFile: me, diags: diags, nodes: header, children: children}
+	return p.parseAll(), p.children
+}
+
+// indented lines: usually an `ExprBlock`, unless all are `foo: bar` lines making up an indent-based `ExprDict`
+func (me *SrcFile) exprBlock(lines AstNodes, diags *Diags) Expr {
+	if lines.arePairLines() {
+		return me.exprDictFromLines(lines, diags)
+	}
+	ret := &ExprBlock{Stmts: me.exprsFromLines(lines, diags)}
+	if len(lines) > 0 {
+		ret.Toks = lines.toks(me)
+	}
+	return ret
+}
+
+func (me *SrcFile) exprDictFromLines(lines AstNodes, diags *Diags) *ExprDict {
+	ret := &ExprDict{ExprBase: ExprBase{Toks: lines.toks(me)}}
+	for _, line := range lines {
+		header, children := line.lineParts()
+		idx := line.pairSepIdx()
+		entry := me.exprDictEntry(header[:idx], diags)
+		entry.Toks = line.Toks
+		if val := header[idx+1:]; len(val) > 0 {
+			me.exprDictEntryVal(entry, val, children, diags)
+		} else if len(children) > 0 {
+			entry.Val = me.exprBlock(children, diags)
+		} else if entry.Name != "" {
+			entry.Val = &ExprIdent{ExprBase: ExprBase{Toks: header[0].Toks}, Name: entry.Name}
+		} else {
+			diags.Add(header[idx].newDiagErr(true, ErrCodeExpectedFoo, "expression to the right of `:`"))
+		}
+		ret.Entries = append(ret.Entries, entry)
+	}
+	return ret
+}
+
+func (me *SrcFile) exprDictEntry(key AstNodes, diags *Diags) *ExprDictEntry {
+	if name := key[0].ident(); (len(key) == 1) && (key[0].Kind == AstNodeKindIdent) && !(key[0].IsIdentOpish() || (name == "true") || (name == "false") || (name == "nil")) {
+		return &ExprDictEntry{Name: name}
+	}
+	return &ExprDictEntry{Key: me.exprFrom(key, nil, diags)}
+}
+
+// sets `entry.Val` from `nodes`, and its `Default` if these are of the `Int = 123` form
+func (me *SrcFile) exprDictEntryVal(entry *ExprDictEntry, nodes AstNodes, children AstNodes, diags *Diags) {
+	for i, node := range nodes {
+		if (i > 0) && node.IsIdentOpish() && (node.ident() == exprOpAssign) {
+			entry.Val = me.exprFrom(nodes[:i], nil, diags)
+			if entry.Default = me.exprFrom(nodes[i+1:], children, diags); entry.Default == nil {
+				diags.Add(node.newDiagErr(true, ErrCodeExpectedFoo, "default value to the right of `"+exprOpAssign+"`"))
+			}
+			return
+		}
+	}
+	entry.Val = me.exprFrom(nodes, children, diags)
+}
+
+func (me *SrcFile) exprFrom(nodes AstNodes, children AstNodes, diags *Diags) Expr {
+	p := exprParser{srcFile: me, diags: diags, nodes: nodes, children: children}
+	return p.parseAll()
+}
+
+func (me AstNodes) arePairLines() bool {
+	return (len(me) > 0) && sl.All(me, func(it *AstNode) bool { return it.pairSepIdx() > 0 })
+}
+
+// for `foo: bar` lines, the index of the `:` in the line's header nodes, else -1
+func (me *AstNode) pairSepIdx() int {
+	header, _ := me.lineParts()
+	for i, node := range header {
+		switch {
+		case node.ident() == exprOpCondQ:
+			return -1
+		case (i > 0) && node.IsIdentSepish() && (node.ident() == ":") && node.isWhitespacelesslyRightAfter(header[i-1]):
+			return i
+		}
+	}
+	return -1
+}
+
+// splits a `AstNodeKindBlockLine` into its own (comment-less) nodes and its indented sub-lines
+func (me *AstNode) lineParts() (header AstNodes, children AstNodes) {
+	if me.Kind != AstNodeKindBlockLine {
+		return AstNodes{me}, nil
+	}
+	for _, node := range me.Nodes {
+		switch node.Kind {
+		case AstNodeKindComment:
+		case AstNodeKindBlockLine:
+			if node.Nodes.has(false, func(it *AstNode) bool { return it.Kind != AstNodeKindComment }) {
+				children = append(children, node)
+			}
+		default:
+			header = append(header, node)
+		}
+	}
+	return
+}
+
+type exprParser struct {
+	srcFile  *SrcFile
+	diags    *Diags
+	nodes    AstNodes
+	idx      int
+	children AstNodes // indented sub-lines, to be consumed by the construct ending the line, if any
+}
+
+func (me *exprParser) cur() *AstNode { return me.peek(0) }
+
+func (me *exprParser) peek(offset int) *AstNode {
+	if idx := me.idx + offset; idx < len(me.nodes) {
+		return me.nodes[idx]
+	}
+	return nil
+}
+
+func (me *exprParser) toks(from int) Toks {
+	return me.nodes[from:util.Max(from+1, me.idx)].toks(me.srcFile)
+}
+
+func (me *exprParser) errAt(node *AstNode, atEnd bool, expected string) {
+	me.diags.Add(node.newDiagErr(atEnd, ErrCodeExpectedFoo, expected))
+}
+
+func (me *exprParser) parseAll() Expr {
+	if len(me.nodes) == 0 {
+		return nil
+	}
+	ret := me.parse(exprPrecLowest)
+	if node := me.cur(); node != nil {
+		me.errAt(node, false, "operator or end of expression")
+	}
+	if (ret != nil) && (len(me.children) > 0) && me.children.arePairLines() {
+		// `Foo` followed by indented `foo: bar` lines is the unary-callee application `Foo { foo: bar }`
+		ret = &ExprCall{ExprBase: ExprBase{Toks: AstNodes{me.nodes[0], me.children.last()}.toks(me.srcFile)},
+			Callee: ret, Args: Exprs{me.srcFile.exprDictFromLines(me.children, me.diags)}, IsUnary: true}
+		me.children = nil
+	} else if (ret != nil) && (len(me.children) == 1) {
+		// as is `Foo` followed by a single indented `{ foo: bar }` line
+		if header, sub_lines := me.children.first().lineParts(); (len(header) == 1) && header[0].IsCurlyBraces() && (len(sub_lines) == 0) {
+			dict := me.parseDict(header[0])
+			dict.Toks = header[0].Toks
+			ret = &ExprCall{ExprBase: ExprBase{Toks: AstNodes{me.nodes[0], me.children.last()}.toks(me.srcFile)},
+				Callee: ret, Args: Exprs{dict}, IsUnary: true}
+			me.children = nil
+		}
+	}
+	return ret
+}
+
+func (me *exprParser) parse(minPrec int) (ret Expr) {
+	idx_start := me.idx
+	if ret = me.parseOperand(); ret == nil {
+		return
+	}
+	for node := me.cur(); node != nil; node = me.cur() {
+		op := node.ident()
+		if prec, is_binary_op := exprOpsBinary[op]; is_binary_op && node.IsIdentOpish() {
+			if prec < minPrec {
+				break
+			}
+			me.idx++
+			rhs := me.parse(util.If(op == "^", prec, prec+1))
+			if rhs == nil {
+				me.errAt(node, true, "operand to the right of `"+op+"`")
+				break
+			}
+			ret = &ExprOpBinary{Op: op, Lhs: ret, Rhs: rhs}
+		} else if ((op == exprOpRange) || (op == exprOpRangeX)) && node.IsIdentOpish() {
+			if exprPrecRange < minPrec {
+				break
+			}
+			me.idx++
+			rng := &ExprRange{From: ret, IsExclusive: (op == exprOpRangeX)}
+			if me.cur() != nil { // else open-ended, as in `items[1..]`
+				if rng.To = me.parse(exprPrecRange + 1); rng.To == nil {
+					me.errAt(node, true, "upper bound to the right of `"+op+"`")
+					break
+				}
+				if step := me.cur(); (step != nil) && (step.ident() == exprOpStep) {
+					me.idx++
+					if rng.Step = me.parse(exprPrecRange + 1); rng.Step == nil {
+						me.errAt(step, true, "step to the right of `"+exprOpStep+"`")
+					}
+				}
+			}
+			ret = rng
+		} else if (op == exprOpErr) && node.IsIdentOpish() {
+			if exprPrecErr < minPrec {
+				break
+			}
+			me.idx++
+			on_err := me.parse(exprPrecErr + 1)
+			if on_err == nil {
+				me.errAt(node, true, "error handler or fallback value to the right of `"+op+"`")
+				break
+			}
+			ret = &ExprErrUnion{Subj: ret, OnErr: on_err}
+		} else if (op == exprOpNilFn) && node.IsIdentOpish() {
+			if exprPrecCond < minPrec {
+				break
+			}
+			me.idx++
+			callee := me.parse(exprPrecUnary + 1) // so that `foo ?> bar ?> baz` is `(foo ?> bar) ?> baz`
+			if callee == nil {
+				me.errAt(node, true, "function to the right of `"+op+"`")
+				break
+			}
+			ret = &ExprNilSafeCall{Subj: ret, Callee: callee}
+		} else if (op == exprOpSwitch) && node.IsIdentOpish() {
+			if exprPrecCond < minPrec {
+				break
+			}
+			me.idx++
+			ret = me.parseSwitch(node, ret)
+		} else if op == exprOpCondQ {
+			if exprPrecCond < minPrec {
+				break
+			}
+			me.idx++
+			cond := &ExprCond{Cond: ret, Then: me.parse(exprPrecUnary)}
+			if cond.Then == nil {
+				me.errAt(node, true, "expression to the right of `"+op+"`")
+				break
+			}
+			if colon := me.cur(); (colon != nil) && (colon.ident() == ":") {
+				me.idx++
+				if cond.Else = me.parse(exprPrecCond); cond.Else == nil {
+					me.errAt(colon, true, "expression to the right of `:`")
+				}
+			}
+			ret = cond
+		} else if me.isOperandStart(node) {
+			if exprPrecUnary < minPrec {
+				break
+			}
+			arg := me.parse(exprPrecUnary + 1)
+			if arg == nil {
+				break
+			}
+			if fn, is_fn := arg.(*ExprFunc); is_fn {
+				ret = &ExprLoop{Subj: ret, Body: fn}
+			} else {
+				ret = &ExprCall{Callee: ret, Args: Exprs{arg}, IsUnary: true}
+			}
+		} else {
+			break
+		}
+		ret.Base().Toks = me.toks(idx_start)
+	}
+	return
+}
+
+func (me *exprParser) isOperandStart(node *AstNode) bool {
+	switch node.Kind {
+	case AstNodeKindLit, AstNodeKindGroup:
+		return true
+	case AstNodeKindIdent:
+		if node.IsIdentOpish() {
+			op := node.ident()
+			return (op == exprOpArrow) || (op == exprOpReturn)
+		}
+		return !node.IsIdentSepish()
+	}
+	return false
+}
+
+func (me *exprParser) parseOperand() (ret Expr) {
+	idx_start, node := me.idx, me.cur()
+	if node == nil {
+		return nil
+	}
+
+	// function literals
+	if next := me.peek(1); (next != nil) && (next.ident() == exprOpArrow) && (node.IsParensCallish() || node.IsParensTuplish()) {
+		me.idx++
+		return me.parseFunc(idx_start, node)
+	} else if node.ident() == exprOpArrow {
+		return me.parseFunc(idx_start, nil)
+	}
+
+	switch node.Kind {
+	case AstNodeKindErr:
+		me.idx++ // errParsing already reported
+		return nil
+	case AstNodeKindLit:
+		me.idx++
+		if len(node.Nodes) > 0 {
+			ret = me.parseStrInterp(node)
+		} else {
+			ret = &ExprLit{Val: node.Lit}
+		}
+	case AstNodeKindIdent:
+		switch op := node.ident(); {
+		case (op == exprOpReturn) || (op == exprOpResult):
+			me.idx++
+			ret = &ExprReturn{Val: me.parse(exprPrecLowest), OfBlock: (op == exprOpResult)}
+		case op == exprOpNext:
+			me.idx++
+			ret = &ExprContinue{}
+		case node.IsIdentOpish() && (op == exprOpErr):
+			me.idx++
+			operand := me.parse(exprPrecErr + 1)
+			if operand == nil {
+				me.errAt(node, true, "error value to the right of `"+op+"`")
+				return nil
+			}
+			ret = &ExprOpUnary{Op: op, Operand: operand}
+		case node.IsIdentOpish() && sl.Has(exprOpsPrefix, op):
+			me.idx++
+			operand := me.parse(exprPrecPrefix)
+			if operand == nil {
+				me.errAt(node, true, "operand to the right of `"+op+"`")
+				return nil
+			}
+			ret = &ExprOpUnary{Op: op, Operand: operand}
+		case node.IsIdentOpish() && (op == exprOpRangeX): // open-ended, as in `items[..3]`
+			me.idx++
+			to := me.parse(exprPrecRange + 1)
+			if to == nil {
+				me.errAt(node, true, "upper bound to the right of `"+op+"`")
+				return nil
+			}
+			ret = &ExprRange{To: to, IsExclusive: true}
+		case node.IsIdentOpish() && (op == exprOpSpread):
+			me.idx++
+			subj := me.parse(exprPrecPrefix)
+			if subj == nil {
+				me.errAt(node, true, "expression to the right of `"+op+"`")
+				return nil
+			}
+			ret = &ExprSpread{Subj: subj}
+		case node.IsIdentOpish() && (op == "."):
+			me.idx++
+			ret = &ExprSelf{}
+			if name := me.cur(); (name != nil) && (name.Kind == AstNodeKindIdent) && !(name.IsIdentOpish() || name.IsIdentSepish()) && name.isWhitespacelesslyRightAfter(node) {
+				ret.Base().Toks = me.toks(idx_start)
+				me.idx++
+				ret = &ExprMember{Subj: ret, Name: name.ident()}
+			}
+		case node.IsIdentOpish() || node.IsIdentSepish():
+			me.errAt(node, false, "expression instead of `"+op+"`")
+			me.idx++
+			return nil
+		case op == "true", op == "false":
+			me.idx++
+			ret = &ExprLit{Val: (op == "true")}
+		case op == "nil":
+			me.idx++
+			ret = &ExprLit{}
+		default:
+			me.idx++
+			ret = &ExprIdent{Name: op}
+		}
+	case AstNodeKindGroup:
+		me.idx++
+		switch {
+		case node.Lit == nil: // huddled or comma-separated item
+			ret = me.sub(node.Nodes, nil)
+		case node.IsParensTuplish():
+			ret = &ExprTuple{Items: me.subEach(node.Nodes)}
+		case node.IsParensCallish():
+			if len(node.Nodes) == 0 {
+				ret = &ExprTuple{}
+			} else {
+				ret = me.sub(node.Nodes, nil)
+			}
+		case node.IsSquareBrackets():
+			ret = &ExprArr{Items: me.subEach(node.Nodes)}
+		case node.IsCurlyBraces():
+			ret = me.parseDict(node)
+		default:
+			me.errAt(node, false, "expression")
+			return nil
+		}
+	default:
+		me.errAt(node, false, "expression")
+		me.idx++
+		return nil
+	}
+	if ret != nil {
+		ret.Base().Toks = me.toks(idx_start)
+		ret = me.parsePostfix(idx_start, ret)
+	}
+	return
+}
+
+// calls, indexing and member access: all whitespace-less
+func (me *exprParser) parsePostfix(idxStart int, subj Expr) Expr {
+	for node := me.cur(); (node != nil) && node.isWhitespacelesslyRightAfter(me.nodes[me.idx-1]); node = me.cur() {
+		switch {
+		case node.IsParensCallish():
+			me.idx++
+			call := &ExprCall{Callee: subj}
+			if len(node.Nodes) > 0 {
+				call.Args = Exprs{me.sub(node.Nodes, nil)}
+			}
+			subj = call
+		case node.IsParensTuplish():
+			me.idx++
+			subj = &ExprCall{Callee: subj, Args: me.subEach(node.Nodes)}
+		case node.IsSquareBrackets():
+			me.idx++
+			index := &ExprIndex{Subj: subj}
+			if len(node.Nodes) != 1 {
+				me.errAt(node, false, "exactly one index expression")
+			} else {
+				index.Index = me.sub(node.Nodes, nil)
+			}
+			subj = index
+		case ((node.ident() == ".") || (node.ident() == exprOpNilDot)) && node.IsIdentOpish():
+			name := me.peek(1)
+			if (name == nil) || (name.Kind != AstNodeKindIdent) || name.IsIdentOpish() || !name.isWhitespacelesslyRightAfter(node) {
+				me.errAt(node, true, "member name right after `"+node.ident()+"`")
+				me.idx++
+				return subj
+			}
+			me.idx += 2
+			subj = &ExprMember{Subj: subj, Name: name.ident(), IsNilSafe: (node.ident() == exprOpNilDot)}
+		default:
+			return subj
+		}
+		subj.Base().Toks = me.toks(idxStart)
+	}
+	return subj
+}
+
+func (me *exprParser) parseFunc(idxStart int, params *AstNode) Expr {
+	arrow := me.cur()
+	me.idx++
+	ret := &ExprFunc{}
+	if params != nil {
+		if params.IsParensTuplish() {
+			for _, node := range params.Nodes {
+				if (node.Kind != AstNodeKindErr) && (node.Kind != AstNodeKindComment) { // errParsing already reported
+					me.parseFuncParam(ret, util.If((node.Kind == AstNodeKindGroup) && (node.Lit == nil), node.Nodes, AstNodes{node}))
+				}
+			}
+		} else if len(params.Nodes) > 0 {
+			me.parseFuncParam(ret, params.Nodes)
+		}
+		for _, param := range ret.Params {
+			if bad := ExprPatternErr(param); bad != nil {
+				me.diags.Add(bad.Base().Toks.newDiagErr(false, ErrCodeExpectedFoo, "parameter name or destructuring pattern"))
+			}
+		}
+	}
+	if me.cur() != nil {
+		ret.Body = Exprs{me.parse(exprPrecLowest)}
+	} else if len(me.children) > 0 {
+		ret.Body = me.srcFile.exprsFromLines(me.children, me.diags)
+		me.children = nil
+	}
+	ret.Toks = me.toks(idxStart)
+	if (len(ret.Body) == 1) && (ret.Body[0] == nil) {
+		me.errAt(arrow, true, "function body")
+		ret.Body = nil
+	}
+	return ret
+}
+
+// appends to `fn` the param in `nodes`, of either the `foo` or the `foo: Type` form, either followed by a `= default`
+func (me *exprParser) parseFuncParam(fn *ExprFunc, nodes AstNodes) {
+	nodes = nodes.withoutComments()
+	var param_type, param_default Expr
+	for i, node := range nodes {
+		if (i > 0) && node.IsIdentOpish() && (node.ident() == exprOpAssign) {
+			if param_default = me.sub(nodes[i+1:], nil); param_default == nil {
+				me.errAt(node, true, "default value to the right of `"+exprOpAssign+"`")
+			}
+			nodes = nodes[:i]
+			break
+		}
+	}
+	if (len(nodes) > 1) && nodes[1].IsIdentSepish() && (nodes[1].ident() == ":") {
+		if param_type = me.sub(nodes[2:], nil); param_type == nil {
+			me.errAt(nodes[1], true, "parameter type to the right of `:`")
+		}
+		nodes = nodes[:1]
+	}
+	fn.Params, fn.ParamTypes = append(fn.Params, me.sub(nodes, nil)), append(fn.ParamTypes, param_type)
+	fn.ParamDefaults = append(fn.ParamDefaults, param_default)
+}
+
+func (me *exprParser) parseDict(node *AstNode) *ExprDict {
+	ret := &ExprDict{}
+	for _, item := range node.Nodes {
+		var entry *ExprDictEntry
+		switch {
+		case (item.Kind == AstNodeKindErr) || (item.Kind == AstNodeKindComment): // errParsing already reported
+			continue
+		case item.IsCurlyPair():
+			entry = me.srcFile.exprDictEntry(item.Nodes[:1], me.diags)
+			me.srcFile.exprDictEntryVal(entry, item.Nodes[1:].withoutComments(), nil, me.diags)
+		default:
+			if entry = me.srcFile.exprDictEntry(AstNodes{item}, me.diags); entry.Name != "" {
+				entry.Val = &ExprIdent{ExprBase: ExprBase{Toks: item.Toks}, Name: entry.Name}
+			} else { // positional, as in tuple types `{ Int, Str }`
+				entry.Val, entry.Key = entry.Key, nil
+			}
+		}
+		entry.Toks = item.Toks
+		ret.Entries = append(ret.Entries, entry)
+	}
+	return ret
+}
+
+// the cases following `foo ?..`: either in the `{ case: body, ... }` right after, or else in the indented `case: body` lines
+func (me *exprParser) parseSwitch(op *AstNode, subj Expr) *ExprSwitch {
+	ret := &ExprSwitch{Subj: subj}
+	var conds Exprs // of the cases without a body so far, which fall through to the next one
+	seen := map[any]bool{}
+	add_case := func(toks Toks, keys AstNodes, body Expr) {
+		for len(keys) > 0 {
+			idx := sl.IdxWhere(keys, func(it *AstNode) bool { return it.IsIdentSepish() && (it.ident() == ",") })
+			if idx < 0 {
+				idx = len(keys)
+			}
+			cond := me.sub(keys[:idx], nil)
+			if cond == nil {
+				me.errAt(keys[util.Min(idx, len(keys)-1)], false, "case before `,`")
+			} else {
+				var key any // for literals and (non-placeholder) names, to report duplicates
+				switch it := cond.(type) {
+				case *ExprLit:
+					key = [2]any{true, it.Val}
+				case *ExprIdent:
+					if !str.Begins(it.Name, "_") {
+						key = [2]any{false, it.Name}
+					}
+				}
+				if (key != nil) && seen[key] {
+					me.diags.Add(cond.Base().Toks.newDiagErr(false, ErrCodeDictDuplKey, cond.Base().Toks.src(me.srcFile.Src.Text)))
+				}
+				seen[key] = true
+				conds = append(conds, cond)
+			}
+			keys = keys[util.Min(idx+1, len(keys)):]
+		}
+		if body != nil {
+			ret.Cases = append(ret.Cases, &ExprSwitchCase{ExprBase: ExprBase{Toks: toks}, Conds: conds, Body: body})
+			conds = nil
+		}
+	}
+	if dict := me.cur(); (dict != nil) && dict.IsCurlyBraces() {
+		me.idx++
+		for _, item := range dict.Nodes {
+			switch {
+			case (item.Kind == AstNodeKindErr) || (item.Kind == AstNodeKindComment): // errParsing already reported
+			case item.IsCurlyPair():
+				add_case(item.Toks, item.Nodes[:1], me.sub(item.Nodes[1:], nil))
+			default:
+				add_case(item.Toks, AstNodes{item}, nil)
+			}
+		}
+	} else if me.children.arePairLines() {
+		for _, line := range me.children {
+			header, children := line.lineParts()
+			idx := line.pairSepIdx()
+			var body Expr
+			if rest := header[idx+1:]; len(rest) > 0 {
+				body = me.srcFile.exprFrom(rest, children, me.diags)
+			} else if len(children) > 0 {
+				body = me.srcFile.exprBlock(children, me.diags)
+			}
+			add_case(line.Toks, header[:idx], body)
+		}
+		me.children = nil
+	} else {
+		me.errAt(op, true, "cases (in dict form) to the right of `"+exprOpSwitch+"`")
+	}
+	if len(conds) > 0 {
+		me.diags.Add(conds[len(conds)-1].Base().Toks.newDiagErr(true, ErrCodeExpectedFoo, "case body after the last case"))
+	}
+	return ret
+}
+
+// the string literal `node` of literal fragments and `${}` exprs, as split by `SrcFile.parseStrInterp`
+func (me *exprParser) parseStrInterp(node *AstNode) Expr {
+	ret := &ExprStrInterp{}
+	for _, part := range node.Nodes {
+		switch part.Kind {
+		case AstNodeKindLit:
+			ret.Parts = append(ret.Parts, &ExprLit{ExprBase: ExprBase{Toks: part.Toks}, Val: part.Lit})
+		case AstNodeKindGroup:
+			if expr := me.sub(part.Nodes, nil); expr != nil {
+				ret.Parts = append(ret.Parts, expr)
+			} else {
+				me.errAt(part, false, "expression inside `${}`")
+			}
+		}
+	}
+	return ret
+}
+
+func (me *exprParser) sub(nodes AstNodes, children AstNodes) Expr {
+	return me.srcFile.exprFrom(nodes.withoutComments(), children, me.diags)
+}
+
+func (me *exprParser) subEach(nodes AstNodes) (ret Exprs) {
+	for _, node := range nodes {
+		if (node.Kind != AstNodeKindErr) && (node.Kind != AstNodeKindComment) { // errParsing already reported
+			ret = append(ret, me.sub(AstNodes{node}, nil))
+		}
+	}
+	return
+}
+
+// ExprPatternErr returns `nil` if `expr` is a valid declaration target: a name, or a destructuring pattern (of
+// names or sub-patterns) such as `[foo, ...bar]`, `(foo, ...bar, baz)` or `{foo, bar: baz}`, else the offending sub-expr.
+func ExprPatternErr(expr Expr) Expr {
+	items := func(items Exprs) Expr {
+		num_spreads := 0
+		for _, item := range items {
+			if spread, _ := item.(*ExprSpread); spread != nil {
+				if num_spreads++; num_spreads > 1 {
+					return spread
+				}
+				if _, is_ident := spread.Subj.(*ExprIdent); !is_ident {
+					return spread.Subj
+				}
+			} else if bad := ExprPatternErr(item); bad != nil {
+				return bad
+			}
+		}
+		return nil
+	}
+	switch it := expr.(type) {
+	case *ExprIdent:
+		return nil
+	case *ExprTuple:
+		return items(it.Items)
+	case *ExprArr:
+		return items(it.Items)
+	case *ExprDict:
+		for _, entry := range it.Entries {
+			if (entry.Name == "") || (entry.Default != nil) {
+				return entry
+			} else if bad := ExprPatternErr(entry.Val); bad != nil {
+				return bad
+			}
+		}
+		return nil
+	}
+	return expr
+}
+
+func exprIsSpread(expr Expr) bool {
+	_, is := expr.(*ExprSpread)
+	return is
+}
+
+func exprIsFunc(expr Expr) bool {
+	_, is := expr.(*ExprFunc)
+	return is
+}
+
+// whether `expr` is a destructuring pattern (rather than a single name or other assignable)
+func exprIsPattern(expr Expr) bool {
+	switch expr.(type) {
+	case *ExprTuple, *ExprArr, *ExprDict:
+		return true
+	}
+	return false
+}
+
+func (me Exprs) Walk(onBefore func(Expr) bool) {
+	for _, expr := range me {
+		ExprWalk(expr, onBefore)
+	}
+}
+
+// ExprWalk calls `onBefore` for `expr` and, unless that returns `false`, recursively for all its sub-expressions.
+func ExprWalk(expr Expr, onBefore func(Expr) bool) {
+	if (expr == nil) || !onBefore(expr) {
+		return
+	}
+	walk := func(exprs ...Expr) {
+		for _, it := range exprs {
+			ExprWalk(it, onBefore)
+		}
+	}
+	switch it := expr.(type) {
+	case *ExprMember:
+		walk(it.Subj)
+	case *ExprIndex:
+		walk(it.Subj, it.Index)
+	case *ExprCall:
+		walk(it.Callee)
+		walk(it.Args...)
+	case *ExprOpBinary:
+		walk(it.Lhs, it.Rhs)
+	case *ExprOpUnary:
+		walk(it.Operand)
+	case *ExprTuple:
+		walk(it.Items...)
+	case *ExprArr:
+		walk(it.Items...)
+	case *ExprSpread:
+		walk(it.Subj)
+	case *ExprDict:
+		for _, entry := range it.Entries {
+			walk(entry.Key, entry.Val, entry.Default)
+		}
+	case *ExprRange:
+		walk(it.From, it.To, it.Step)
+	case *ExprStrInterp:
+		walk(it.Parts...)
+	case *ExprLoop:
+		walk(it.Subj, it.Body)
+	case *ExprFunc:
+		walk(it.Params...)
+		walk(it.ParamTypes...)
+		walk(it.ParamDefaults...)
+		walk(it.Body...)
+	case *ExprErrUnion:
+		walk(it.Subj, it.OnErr)
+	case *ExprNilSafeCall:
+		walk(it.Subj, it.Callee)
+	case *ExprCond:
+		walk(it.Cond, it.Then, it.Else)
+	case *ExprSwitch:
+		walk(it.Subj)
+		for _, case_ := range it.Cases {
+			walk(case_.Conds...)
+			walk(case_.Body)
+		}
+	case *ExprBlock:
+		walk(it.Stmts...)
+	case *ExprAssign:
+		walk(it.Lhs, it.Rhs)
+	case *ExprReturn:
+		walk(it.Val)
+	}
+}
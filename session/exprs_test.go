@@ -0,0 +1,100 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"loon/util"
+)
+
+func TestParseExprPrecedence(t *testing.T) {
+	for _, it := range []struct {
+		src      string
+		expected string
+	}{
+		// precedence of binary ops
+		{"a + b * c", "(+ a (* b c))"},
+		{"a * b + c", "(+ (* a b) c)"},
+		{"a + b * c ^ d", "(+ a (* b (^ c d)))"},
+		{"a || b && c == d", "(|| a (&& b (== c d)))"},
+		{"a == b | c ~ d & e << f", "(== a (| b (~ c (& d (<< e f)))))"},
+		{"a < b + c", "(< a (+ b c))"},
+		// associativity: all left, except `^`
+		{"a - b - c", "(- (- a b) c)"},
+		{"a / b * c", "(* (/ a b) c)"},
+		{"a || b || c", "(|| (|| a b) c)"},
+		{"a ^ b ^ c", "(^ a (^ b c))"},
+		// prefix ops bind tighter than binary ones, but looser than `^`
+		{"-a + b", "(+ (- a) b)"},
+		{"- a ^ b", "(- (^ a b))"},
+		{"-a ^ b", "(^ (- a) b)"}, // whitespace-less `-a` huddles into one operand
+		{"a*b + c*d", "(+ (* a b) (* c d))"},
+		{"!a && b", "(&& (! a) b)"},
+		{"#a * 2", "(* (# a) 2)"},
+		// postfix members, indexing and calls bind tightest
+		{"-a.b(c)[d]", "(- ([] (call (. a b) c) d))"},
+		// ranges: looser than arithmetic, tighter than comparisons
+		{"a + 1 .. b * 2", "(.. (+ a 1) (* b 2))"},
+		{"a .. b == c", "(== (.. a b) c)"},
+		// conditionals: loosest, and right-nested in their else branches
+		{"a || b ? c + d : e", "(? (|| a b) (+ c d) e)"},
+		{"a ? b : c ? d : e", "(? a b (? c d e))"},
+		// unary-callee application: tighter than conditionals, looser than binary ops
+		{"f a + b", "(call f (+ a b))"},
+		{"f a ? b : c", "(? (call f a) b c)"},
+		// nil-safe chains: `?.` as tight as `.`, `?>` left-nested and as loose as conditionals
+		{"a?.b.c", "(. (?. a b) c)"},
+		{"a ?> f ?> g", "(?> (?> a f) g)"},
+		{"a + b ?> f", "(?> (+ a b) f)"},
+		// assignments: rhs parsed whole
+		{"x := a + b * c", "(:= x (+ a (* b c)))"},
+		{"x += a * b", "(+= x (* a b))"},
+	} {
+		file := &SrcFile{FilePath: "/tmp/loon_test/exprs.ls"}
+		file.Src.Text = it.src + "\n"
+		file.Src.Toks, file.diags.LexErrs = tokenize(file.FilePath, file.Src.Text)
+		file.Src.Ast = file.parse()
+		file.exprsRefresh()
+		if diags := file.allDiags(); len(diags) > 0 {
+			t.Errorf("%s: unexpected %s", it.src, diags[0])
+		} else if len(file.Trees.Exprs) != 1 {
+			t.Errorf("%s: expected 1 expr, got %d", it.src, len(file.Trees.Exprs))
+		} else if actual := exprsTestStr(file.Trees.Exprs[0]); actual != it.expected {
+			t.Errorf("%s: expected %s, got %s", it.src, it.expected, actual)
+		}
+	}
+}
+
+// `expr` as a fully parenthesized prefix notation, for the few expr kinds of `TestParseExprPrecedence`
+func exprsTestStr(expr Expr) string {
+	switch it := expr.(type) {
+	case *ExprIdent:
+		return it.Name
+	case *ExprLit:
+		return fmt.Sprint(it.Val)
+	case *ExprOpBinary:
+		return "(" + it.Op + " " + exprsTestStr(it.Lhs) + " " + exprsTestStr(it.Rhs) + ")"
+	case *ExprOpUnary:
+		return "(" + it.Op + " " + exprsTestStr(it.Operand) + ")"
+	case *ExprMember:
+		return "(" + util.If(it.IsNilSafe, "?.", ".") + " " + exprsTestStr(it.Subj) + " " + it.Name + ")"
+	case *ExprNilSafeCall:
+		return "(?> " + exprsTestStr(it.Subj) + " " + exprsTestStr(it.Callee) + ")"
+	case *ExprIndex:
+		return "([] " + exprsTestStr(it.Subj) + " " + exprsTestStr(it.Index) + ")"
+	case *ExprRange:
+		return "(.. " + exprsTestStr(it.From) + " " + exprsTestStr(it.To) + ")"
+	case *ExprCall:
+		ret := []string{"(call", exprsTestStr(it.Callee)}
+		for _, arg := range it.Args {
+			ret = append(ret, exprsTestStr(arg))
+		}
+		return strings.Join(ret, " ") + ")"
+	case *ExprCond:
+		return "(? " + exprsTestStr(it.Cond) + " " + exprsTestStr(it.Then) + " " + exprsTestStr(it.Else) + ")"
+	case *ExprAssign:
+		return "(" + it.Op + " " + exprsTestStr(it.Lhs) + " " + exprsTestStr(it.Rhs) + ")"
+	}
+	return fmt.Sprintf("%T", expr)
+}
@@ -1,7 +1,15 @@
 package session
 
 import (
+	"cmp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"loon/session/ty"
+	"loon/util"
 	"loon/util/sl"
+	"loon/util/str"
 )
 
 type IntelLookupKind int
@@ -31,13 +39,21 @@ const (
 	IntelItemKindNumHex
 	IntelItemKindNumOct
 	IntelItemKindNumDec
+	IntelItemKindSnippet // for `Completions`, the text to insert in LSP snippet syntax
 )
 
 type IntelDeclKind string
 
 const (
-	IntelDeclKindFunc IntelDeclKind = "func"
-	IntelDeclKindVar  IntelDeclKind = "var"
+	IntelDeclKindFunc      IntelDeclKind = "func"
+	IntelDeclKindVar       IntelDeclKind = "var"
+	IntelDeclKindType      IntelDeclKind = "type" // other than struct types, as in `Numbers := [Int | Float]`
+	IntelDeclKindStruct    IntelDeclKind = "struct"
+	IntelDeclKindInterface IntelDeclKind = "interface" // see `Struct.IsInterface`
+	IntelDeclKindMethod    IntelDeclKind = "method"
+	IntelDeclKindField     IntelDeclKind = "field"   // including embeddings, as in `_: Animal`
+	IntelDeclKindKeyword   IntelDeclKind = "keyword" // only for `Completions`: keyword-like operators such as `?..`
+	IntelDeclKindSnippet   IntelDeclKind = "snippet" // only for `Completions`, see `IntelItemKindSnippet`
 )
 
 type Intel interface {
@@ -46,6 +62,7 @@ type Intel interface {
 	Completions(file *SrcFile, pos SrcFilePos) (ret []*IntelInfo)
 	Info(file *SrcFile, pos SrcFilePos) *IntelInfo
 	CanRename(file *SrcFile, pos SrcFilePos) *SrcFileSpan
+	Rename(file *SrcFile, pos SrcFilePos, newName string) ([]*IntelEdit, error)
 }
 
 type intel struct{}
@@ -57,6 +74,13 @@ type IntelItem struct {
 }
 type IntelItems sl.Of[IntelItem]
 
+// IntelEdit replaces `Span` in `File` by `NewText`, as per `Intel.Rename`
+type IntelEdit struct {
+	File    *SrcFile
+	Span    *SrcFileSpan
+	NewText string
+}
+
 type IntelInfo struct {
 	Items     IntelItems
 	Sub       []*IntelInfo
@@ -64,91 +88,1072 @@ type IntelInfo struct {
 	SpanFull  *SrcFileSpan
 }
 
-// temporary fake impl
+// Decls lists the `:=` declarations of `file` (if any, else of all the files of `pack`, if any, else of all packs), with their
+// nested ones (those in func bodies, and the members of struct types) as `Sub`s unless `topLevelOnly`. A non-empty
+// `query` keeps only those whose names fuzzily match it (see `str.IsFuzzyMatch`), and those with `Sub`s that do.
 func (me intel) Decls(pack *SrcPack, file *SrcFile, topLevelOnly bool, query string) (ret []*IntelInfo) {
-	if file == nil { // for temporary fake impl
-		file = me.dummyFile()
+	files := []*SrcFile{file}
+	if (file == nil) && (pack != nil) {
+		files = sl.Where(pack.Files, func(it *SrcFile) bool { return !it.IsFauxFile() })
+	} else if file == nil {
+		files = nil
+		for _, pack := range state.AllCurrentSrcPacks() {
+			files = append(files, sl.Where(pack.Files, func(it *SrcFile) bool { return !it.IsFauxFile() })...)
+		}
+	}
+	for _, file := range files {
+		ret = append(ret, me.decls(file, topLevelOnly, query, file.Trees.Exprs...)...)
+	}
+	return
+}
+
+func (me intel) decls(file *SrcFile, topLevelOnly bool, query string, exprs ...Expr) (ret []*IntelInfo) {
+	Exprs(exprs).Walk(func(expr Expr) bool {
+		assign, _ := expr.(*ExprAssign)
+		if (assign == nil) || (assign.Op != exprOpDecl) {
+			return !topLevelOnly
+		}
+		infos := me.declInfos(file, assign)
+		if (len(infos) == 1) && !topLevelOnly {
+			infos[0].Sub = me.declSubs(file, assign, query)
+		}
+		for _, info := range infos {
+			if (query == "") || str.IsFuzzyMatch(info.Items.Name().Value, query) || (len(info.Sub) > 0) {
+				ret = append(ret, info)
+			}
+		}
+		return false
+	})
+	return
+}
+
+// the infos of the names declared by `assign`: one for `foo := ...` and `Foo.bar := ...`, else those of the destructuring pattern
+func (me intel) declInfos(file *SrcFile, assign *ExprAssign) (ret []*IntelInfo) {
+	switch lhs := assign.Lhs.(type) {
+	case *ExprIdent:
+		kind := util.If(exprFuncOf(lhs) != nil, IntelDeclKindFunc, IntelDeclKindVar)
+		if (lhs.Decl != nil) && (lhs.Decl.Struct != nil) {
+			kind = util.If(lhs.Decl.Struct.IsInterface(), IntelDeclKindInterface, IntelDeclKindStruct)
+		} else if str.IsUp(lhs.Name[:1]) {
+			kind = IntelDeclKindType
+		}
+		var t ty.Type
+		if (lhs.Decl != nil) && (lhs.Decl.Type != nil) {
+			t = lhs.Decl.Type.Type
+		}
+		ret = append(ret, me.declInfo(file, lhs.Name, kind, t, lhs, assign))
+	case *ExprMember: // `Foo.bar := ...`, a method or static per `Struct.Member`
+		kind, t := util.If(exprIsFunc(assign.Rhs), IntelDeclKindFunc, IntelDeclKindVar), ty.Type(nil)
+		if subj, _ := lhs.Subj.(*ExprIdent); (subj != nil) && (subj.Decl != nil) && (subj.Decl.Struct != nil) {
+			if member := subj.Decl.Struct.Member(lhs.Name, false); (member != nil) && (member.Expr == assign) {
+				kind, t = IntelDeclKindMethod, member.Type
+			} else if member = subj.Decl.Struct.Member(lhs.Name, true); (member != nil) && (member.Expr == assign) {
+				t = member.Type
+			}
+		}
+		ret = append(ret, me.declInfo(file, lhs.Toks.src(file.Src.Text), kind, t, lhs, assign))
+	default: // destructuring
+		ExprWalk(lhs, func(it Expr) bool {
+			if ident, _ := it.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) {
+				ret = append(ret, me.declInfo(file, ident.Name, IntelDeclKindVar, ident.Type, ident, assign))
+			}
+			return true
+		})
 	}
-	if (pack == nil) && (file != nil) {
-		pack = file.pack
+	return
+}
+
+// the nested decls of `assign`: the members of struct types, else those in its right-hand side (such as in func bodies)
+func (me intel) declSubs(file *SrcFile, assign *ExprAssign, query string) (ret []*IntelInfo) {
+	if ident, _ := assign.Lhs.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Struct != nil) {
+		for _, member := range ident.Decl.Struct.Members {
+			entry, _ := member.Expr.(*ExprDictEntry)
+			if entry == nil { // out-of-line methods are listed as top-level decls of their own
+				continue
+			}
+			info := me.declInfo(file, member.Name, me.memberKind(member), member.Type, entry, entry)
+			info.SpanIdent = util.Ptr(entry.Toks[:1].Span())
+			if info.Sub = me.decls(file, false, query, entry.Val); (query == "") || str.IsFuzzyMatch(member.Name, query) || (len(info.Sub) > 0) {
+				ret = append(ret, info)
+			}
+		}
+		return
 	}
-	ret = append(ret, &IntelInfo{
-		SpanIdent: &SrcFileSpan{Start: SrcFilePos{Line: 1, Char: 4}, End: SrcFilePos{Line: 1, Char: 11}},
-		SpanFull:  &SrcFileSpan{Start: SrcFilePos{Line: 1, Char: 1}, End: SrcFilePos{Line: 4, Char: 123}},
+	return me.decls(file, false, query, assign.Rhs)
+}
+
+func (intel) declInfo(file *SrcFile, name string, kind IntelDeclKind, t ty.Type, ident Expr, full Expr) *IntelInfo {
+	ret := &IntelInfo{
+		SpanIdent: util.Ptr(ident.Base().Toks.Span()),
+		SpanFull:  util.Ptr(full.Base().Toks.Span()),
 		Items: IntelItems{
-			IntelItem{Kind: IntelItemKindName, Value: "FakeSym1"},
-			IntelItem{Kind: IntelItemKindDescription, Value: "Fake symbol 1"},
-			IntelItem{Kind: IntelItemKindKind, Value: string(IntelDeclKindVar)},
-			IntelItem{Kind: IntelItemKindSrcFilePath, Value: file.FilePath},
-			IntelItem{Kind: IntelItemKindSrcPackDirPath, Value: pack.DirPath},
+			{Kind: IntelItemKindName, Value: name},
+			{Kind: IntelItemKindKind, Value: string(kind)},
+			{Kind: IntelItemKindSrcFilePath, Value: file.FilePath},
 		},
+	}
+	if file.pack != nil {
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindSrcPackDirPath, Value: file.pack.DirPath})
+	}
+	if t != nil {
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindDescription, Value: t.String()})
+	}
+	return ret
+}
+
+// Lookup answers `kind` for the name at `pos`: either a `Decl` (via its resolved `ExprIdent`s) or a struct member (via
+// its `.member` accesses and struct-literal keys). As every `:=` declaration is also a definition, `IntelLookupKindDefs`
+// and `IntelLookupKindDecls` are the same. Refs are sought across all files of `file`'s pack unless `inFileOnly`.
+func (me intel) Lookup(kind IntelLookupKind, file *SrcFile, pos SrcFilePos, inFileOnly bool) (ret []*SrcFileLocs) {
+	switch kind {
+	case IntelLookupKindImpls:
+		return me.lookupImpls(file, pos, inFileOnly)
+	case IntelLookupKindTypes:
+		return me.lookupTypes(file, pos, inFileOnly)
+	}
+	var locs intelLocs
+	switch decl, member := me.targetAt(file, pos); {
+	case (decl != nil) && (kind == IntelLookupKindRefs):
+		locs = me.refsOfDecl(file, decl, inFileOnly)
+	case decl != nil:
+		if (decl.Ident != nil) && ((!inFileOnly) || (decl.File == file)) {
+			locs.add(decl.File, decl.Ident.Toks.Span(), true)
+		}
+	case (member != nil) && (kind == IntelLookupKindRefs):
+		locs = me.refsOfMember(file, member, inFileOnly)
+	case member != nil:
+		if span := me.memberSpan(member); (span != nil) && ((!inFileOnly) || (member.File == file)) {
+			locs.add(member.File, *span, true)
+		}
+	}
+	return locs
+}
+
+// all `ExprIdent`s resolving to `decl`, in its file if a local one, else in all files of its pack (or only `file` if `inFileOnly`)
+func (me intel) refsOfDecl(file *SrcFile, decl *Decl, inFileOnly bool) (ret intelLocs) {
+	files := util.If(decl.IsTopLevel(), decl.File.pack.Files, []*SrcFile{decl.File})
+	for _, src_file := range util.If(inFileOnly, []*SrcFile{file}, files) {
+		setters := me.setters(src_file)
+		src_file.Trees.Exprs.Walk(func(expr Expr) bool {
+			if ident, _ := expr.(*ExprIdent); (ident != nil) && (ident.Decl == decl) {
+				ret.add(src_file, ident.Toks.Span(), (ident == decl.Ident) || setters[ident])
+			}
+			return true
+		})
+	}
+	return
+}
+
+// the names of all `.member` accesses and dict-literal keys resolving to `member`, in all files of `file`'s pack (or only `file` if `inFileOnly`)
+func (me intel) refsOfMember(file *SrcFile, member *StructMember, inFileOnly bool) (ret intelLocs) {
+	for _, src_file := range util.If(inFileOnly, []*SrcFile{file}, file.pack.Files) {
+		setters := me.setters(src_file)
+		src_file.Trees.Exprs.Walk(func(expr Expr) bool {
+			switch it := expr.(type) {
+			case *ExprMember:
+				if me.memberOfAccess(src_file.pack, it) == member {
+					ret.add(src_file, it.Toks[len(it.Toks)-1:].Span(), setters[it])
+				}
+			case *ExprDict:
+				for _, entry := range it.Entries {
+					if (entry.Name != "") && (len(entry.Toks) > 0) && (me.memberOfEntry(src_file.pack, it, entry) == member) {
+						ret.add(src_file, entry.Toks[:1].Span(), true)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return
+}
+
+// intelLocs groups spans per file, in order of first occurrence and without duplicates
+type intelLocs []*SrcFileLocs
+
+func (me *intelLocs) add(file *SrcFile, span SrcFileSpan, isSet bool) {
+	locs := sl.FirstWhere(*me, func(it *SrcFileLocs) bool { return it.File == file })
+	if locs == nil {
+		locs = &SrcFileLocs{File: file}
+		*me = append(*me, locs)
+	}
+	if !sl.Any(locs.Spans, func(it *SrcFileSpan) bool { return *it == span }) {
+		locs.Spans, locs.IsSet, locs.IsGet = append(locs.Spans, &span), append(locs.IsSet, isSet), append(locs.IsGet, !isSet)
+	}
+}
+
+// the `Decl` or else the struct member named at `pos`, if any
+func (me intel) targetAt(file *SrcFile, pos SrcFilePos) (*Decl, *StructMember) {
+	expr := me.exprAt(file, pos)
+	if self, _ := expr.(*ExprSelf); self != nil { // pos right between the `.` and the name of `.member`
+		file.Trees.Exprs.Walk(func(it Expr) bool {
+			if member, _ := it.(*ExprMember); (member != nil) && (member.Subj == self) {
+				expr = member
+			}
+			return true
+		})
+	}
+	switch it := expr.(type) {
+	case *ExprIdent:
+		return it.Decl, nil
+	case *ExprMember:
+		if it.Toks[len(it.Toks)-1:].Span().Contains(&pos) {
+			return nil, me.memberOfAccess(file.pack, it)
+		}
+	case *ExprDict:
+		for _, entry := range it.Entries {
+			if (entry.Name != "") && (len(entry.Toks) > 0) && entry.Toks[:1].Span().Contains(&pos) {
+				return nil, me.memberOfEntry(file.pack, it, entry)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// the idents and member accesses being assigned to (or updated) in `file`, other than via destructuring
+func (intel) setters(file *SrcFile) map[Expr]bool {
+	ret := map[Expr]bool{}
+	file.Trees.Exprs.Walk(func(expr Expr) bool {
+		if assign, _ := expr.(*ExprAssign); assign != nil {
+			ret[assign.Lhs] = true
+		}
+		return true
 	})
-	if !topLevelOnly {
-		ret[0].Sub = []*IntelInfo{{
-			SpanIdent: &SrcFileSpan{Start: SrcFilePos{Line: 3, Char: 4}, End: SrcFilePos{Line: 3, Char: 11}},
-			SpanFull:  &SrcFileSpan{Start: SrcFilePos{Line: 3, Char: 4}, End: SrcFilePos{Line: 3, Char: 123}},
-			Items: IntelItems{
-				IntelItem{Kind: IntelItemKindName, Value: "FakeSym2"},
-				IntelItem{Kind: IntelItemKindDescription, Value: "Fake symbol 2"},
-				IntelItem{Kind: IntelItemKindKind, Value: string(IntelDeclKindFunc)},
-				IntelItem{Kind: IntelItemKindSrcFilePath, Value: file.FilePath},
-				IntelItem{Kind: IntelItemKindSrcPackDirPath, Value: pack.DirPath},
-			},
-		}}
+	return ret
+}
+
+// the struct member that `it` accesses: a static one on struct type names (also the out-of-line
+// method being declared, as in `Foo.bar := (.) -> ...`), else an instance one per the subject's type
+func (me intel) memberOfAccess(pack *SrcPack, it *ExprMember) *StructMember {
+	if ident, _ := it.Subj.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Struct != nil) {
+		if member := ident.Decl.Struct.Member(it.Name, true); member != nil {
+			return member
+		}
+		if member := ident.Decl.Struct.Member(it.Name, false); member != nil {
+			if assign, _ := member.Expr.(*ExprAssign); (assign != nil) && (assign.Lhs == it) {
+				return member
+			}
+		}
+		return nil
+	}
+	if subj := me.structOfType(pack, it.Subj.Base().Type); subj != nil {
+		return subj.Member(it.Name, false)
+	}
+	return nil
+}
+
+// the struct member that `entry` of `dict` declares (in a struct type decl) or sets (in a struct literal)
+func (me intel) memberOfEntry(pack *SrcPack, dict *ExprDict, entry *ExprDictEntry) *StructMember {
+	for _, it := range pack.Trees.Structs {
+		if member := sl.FirstWhere(it.Members, func(it *StructMember) bool { return it.Expr == entry }); member != nil {
+			return member
+		}
+	}
+	if subj := me.structOfType(pack, dict.Type); subj != nil {
+		if member := subj.Member(entry.Name, false); (member != nil) && (member.Kind == StructMemberField) {
+			return member
+		}
+	}
+	return nil
+}
+
+// the span of the name of `member` in its declaration
+func (intel) memberSpan(member *StructMember) *SrcFileSpan {
+	switch it := member.Expr.(type) {
+	case *ExprDictEntry:
+		if len(it.Toks) > 0 {
+			return util.Ptr(it.Toks[:1].Span())
+		}
+	case *ExprAssign:
+		if toks := it.Lhs.Base().Toks; len(toks) > 0 {
+			return util.Ptr(toks[len(toks)-1:].Span())
+		}
+	}
+	return nil
+}
+
+// the `Struct` of the (resolved) `t`, also if `t` is a union of it and `nil` (as for the subject of `foo?.bar`)
+func (intel) structOfType(pack *SrcPack, t ty.Type) *Struct {
+	if union, _ := t.(*ty.TypeUnion); union != nil {
+		if non_nils := sl.Where(union.Types, func(it ty.Type) bool { return it != ty.TypeNil{} }); len(non_nils) == 1 {
+			t = non_nils[0]
+		}
+	}
+	if it, _ := t.(*ty.TypeStruct); it != nil {
+		return sl.FirstWhere(pack.Trees.Structs, func(s *Struct) bool { return s.Type == it })
+	}
+	return nil
+}
+
+// the type decls of the structs occurring in the type of the name or expr at `pos`
+func (me intel) lookupTypes(file *SrcFile, pos SrcFilePos, inFileOnly bool) (ret []*SrcFileLocs) {
+	var t ty.Type
+	switch decl, member := me.targetAt(file, pos); {
+	case (decl != nil) && (decl.Struct != nil):
+		t = decl.Struct.Type
+	case member != nil:
+		t = member.Type
+	default:
+		if expr := me.exprAt(file, pos); expr != nil {
+			t = expr.Base().Type
+		}
+	}
+	for _, it := range me.structsIn(file.pack, t, nil) {
+		if (!inFileOnly) || (it.Decl.File == file) {
+			ret = append(ret, it.Decl.relLocs("type "+it.Decl.Name)...)
+		}
 	}
 	return
 }
 
-// temporary fake impl
-func (me intel) Lookup(kind IntelLookupKind, file *SrcFile, pos SrcFilePos, inFileOnly bool) (ret []*SrcFileLocs) {
-	return me.dummyLocs()
+func (me intel) structsIn(pack *SrcPack, t ty.Type, ret []*Struct) []*Struct {
+	switch t := t.(type) {
+	case *ty.TypeStruct:
+		if it := me.structOfType(pack, t); (it != nil) && !sl.Has(ret, it) {
+			ret = append(ret, it)
+		}
+	case *ty.TypeArr:
+		ret = me.structsIn(pack, t.Item, ret)
+	case *ty.TypeDict:
+		ret = me.structsIn(pack, t.Val, me.structsIn(pack, t.Key, ret))
+	case *ty.TypeErrUnion:
+		ret = me.structsIn(pack, t.Err, me.structsIn(pack, t.Val, ret))
+	case *ty.TypeFun:
+		for _, it := range t.Params {
+			ret = me.structsIn(pack, it, ret)
+		}
+		ret = me.structsIn(pack, t.Ret, ret)
+	case *ty.TypeTuple:
+		for _, it := range t.Items {
+			ret = me.structsIn(pack, it, ret)
+		}
+	case *ty.TypeUnion:
+		for _, it := range t.Types {
+			ret = me.structsIn(pack, it, ret)
+		}
+	}
+	return ret
 }
 
-// temporary fake impl
-func (intel) Completions(file *SrcFile, pos SrcFilePos) (ret []*IntelInfo) {
+// for the interface named at `pos` (see `Struct.IsInterface`), the type names of all structs implementing it
+func (me intel) lookupImpls(file *SrcFile, pos SrcFilePos, inFileOnly bool) (ret []*SrcFileLocs) {
+	ident, _ := me.exprAt(file, pos).(*ExprIdent)
+	if (ident == nil) || (ident.Decl == nil) || (ident.Decl.Struct == nil) || !ident.Decl.Struct.IsInterface() {
+		return
+	}
+	for _, it := range file.pack.Trees.Structs {
+		if ((!inFileOnly) || (it.Decl.File == file)) && it.Implements(ident.Decl.Struct) {
+			ret = append(ret, it.Decl.relLocs("implements "+ident.Name)...)
+		}
+	}
 	return
 }
 
-// temporary fake impl
-func (intel) Info(file *SrcFile, pos SrcFilePos) (ret *IntelInfo) {
+// the innermost `Expr` in `file` spanning `pos`, if any. Not pruning the walk at non-spanning exprs,
+// because the `Toks` of some (such as `ExprFunc`s) exclude their indented-block bodies.
+func (intel) exprAt(file *SrcFile, pos SrcFilePos) (ret Expr) {
+	if (file == nil) || (file.pack == nil) {
+		return
+	}
+	file.Trees.Exprs.Walk(func(expr Expr) bool {
+		if toks := expr.Base().Toks; (len(toks) > 0) && toks.Span().Contains(&pos) {
+			ret = expr
+		}
+		return true
+	})
 	return
 }
 
-// temporary fake impl
-func (intel) CanRename(file *SrcFile, pos SrcFilePos) *SrcFileSpan {
-	return &SrcFileSpan{Start: pos, End: SrcFilePos{Line: pos.Line, Char: 4 + pos.Char}}
+// Completions offers, for `pos` (also on not-yet-parseable lines, as the context is taken from the current `Src.Toks`
+// while the `Trees` are those of the last successful refresh): after `foo.`, the (also promoted) members of `foo`'s
+// struct type (or the statics of the struct type `Foo`, or the keys of the dict literal `foo`); after a bare `.`, those
+// of the instance of the enclosing method; at the keys of a struct literal, its fields; else the locals in scope, the
+// pack's top-level decls and the builtins, plus keyword-like operators and (at the start of a line) snippets.
+func (me intel) Completions(file *SrcFile, pos SrcFilePos) (ret []*IntelInfo) {
+	if (file == nil) || (file.pack == nil) {
+		return
+	}
+	toks := sl.Where(file.Src.Toks, func(it *Tok) bool { return (it.Kind != TokKindBegin) && (it.Kind != TokKindEnd) })
+	idx := sl.IdxWhere(toks, func(it *Tok) bool { return !it.Pos.Before(&pos) }) - 1
+	if idx == -2 {
+		idx = len(toks) - 1
+	}
+	var prefix string
+	if idx >= 0 {
+		switch tok, span := toks[idx], toks[idx].span(); {
+		case span.End.Before(&pos):
+		case tok.Kind == TokKindIdentWord:
+			prefix, idx = tok.Src[:min(len(tok.Src), pos.Char-tok.Pos.Char)], idx-1
+		case (tok.Kind == TokKindComment) || (((tok.Kind == TokKindLitStr) || (tok.Kind == TokKindLitRune)) && (span.End != pos)):
+			return
+		}
+	}
+	decls := me.visibleDecls(file, pos)
+	var infos []*IntelInfo
+	switch prev := util.If(idx >= 0, toks[idx], nil); {
+	case (prev != nil) && ((prev.Src == ".") || (prev.Src == exprOpNilDot)):
+		if (idx > 0) && prev.isWhitespacelesslyRightAfter(toks[idx-1]) && toks[idx-1].isSubjEnd() {
+			infos = me.completionsOfSubj(file, pos, toks, idx-1, decls)
+		} else if prev.Src == "." {
+			if it := me.structOfMethodAt(file, pos); it != nil {
+				infos = me.completionsOfMembers(it, false)
+			}
+		}
+	case (prev != nil) && ((prev.Src == "{") || (prev.Src == ",")):
+		if it, given := me.structOfLitAt(toks, idx, decls); it != nil {
+			for _, member := range me.membersOf(it, false, map[*Struct]bool{}) {
+				if (member.Kind == StructMemberField) && !sl.Has(given, member.Name) {
+					given, infos = append(given, member.Name), append(infos, me.completion(member.Name, IntelDeclKindField, member.Type))
+				}
+			}
+		} else {
+			infos = me.completionsOfDecls(decls)
+		}
+	default:
+		infos = me.completionsOfDecls(decls)
+		at_line_start := (prev == nil) || (prev.span().End.Line < pos.Line)
+		if !at_line_start {
+			infos = append(infos, me.completion(exprOpSwitch, IntelDeclKindKeyword, nil), me.completion(exprOpArrow, IntelDeclKindKeyword, nil))
+		}
+		if me.funcAt(file, pos) {
+			infos = append(infos, me.completion(exprOpNext, IntelDeclKindKeyword, nil))
+		}
+		if at_line_start {
+			for _, snippet := range intelSnippets {
+				info := me.completion(snippet[0], IntelDeclKindSnippet, nil)
+				info.Items = append(info.Items, IntelItem{Kind: IntelItemKindSnippet, Value: snippet[1]})
+				infos = append(infos, info)
+			}
+		}
+	}
+	for _, info := range infos {
+		if (prefix == "") || str.IsFuzzyMatch(info.Items.Name().Value, prefix) {
+			ret = append(ret, info)
+		}
+	}
+	return
 }
 
-func (me IntelItems) First(kind IntelItemKind) *IntelItem {
-	for i := range me {
-		if item := &me[i]; item.Kind == kind {
-			return item
+// the `Completions` snippets (in LSP snippet syntax) offered at the start of a line, by name
+var intelSnippets = [][2]string{
+	{"for-loop", "${1:items} (${2:item}) ->\n\t$0"},
+	{"while-loop", "${1:cond} ->\n\t$0"},
+	{"switch", "${1:subj} ?..\n\t${2:case}:\n\t\t$0\n\t_:\n\t\t"},
+	{"struct", "${1:Name} :=\n\t${2:field}: ${3:Int}$0"},
+}
+
+func (intel) completion(name string, kind IntelDeclKind, t ty.Type) *IntelInfo {
+	ret := &IntelInfo{Items: IntelItems{{Kind: IntelItemKindName, Value: name}, {Kind: IntelItemKindKind, Value: string(kind)}}}
+	if t != nil {
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindDescription, Value: t.String()})
+	}
+	return ret
+}
+
+func (me intel) completionsOfDecls(decls []*Decl) (ret []*IntelInfo) {
+	for _, decl := range decls {
+		var t ty.Type
+		if decl.Type != nil {
+			t = decl.Type.Type
+		}
+		ret = append(ret, me.completion(decl.Name, me.declKind(decl), t))
+	}
+	for _, name := range scopeBuiltins {
+		if _, is_prim := typePrims[name]; is_prim {
+			ret = append(ret, me.completion(name, IntelDeclKindType, typePrims[name]))
+		} else {
+			ret = append(ret, me.completion(name, IntelDeclKindVar, nil))
+		}
+	}
+	return
+}
+
+func (intel) declKind(decl *Decl) IntelDeclKind {
+	switch {
+	case decl.Struct != nil:
+		return util.If(decl.Struct.IsInterface(), IntelDeclKindInterface, IntelDeclKindStruct)
+	case str.IsUp(decl.Name[:1]):
+		return IntelDeclKindType
+	case exprFuncOf(decl.Ident) != nil:
+		return IntelDeclKindFunc
+	}
+	return IntelDeclKindVar
+}
+
+// the (also promoted) instance members, or else statics, of `it`
+func (me intel) completionsOfMembers(it *Struct, static bool) (ret []*IntelInfo) {
+	var names []string
+	for _, member := range me.membersOf(it, static, map[*Struct]bool{}) {
+		if !sl.Has(names, member.Name) {
+			names = append(names, member.Name)
+			ret = append(ret, me.completion(member.Name, me.memberKind(member), member.Type))
+		}
+	}
+	return
+}
+
+func (me intel) membersOf(it *Struct, static bool, seen map[*Struct]bool) (ret []*StructMember) {
+	if seen[it] {
+		return
+	}
+	seen[it] = true
+	ret = sl.Where(it.Members, func(member *StructMember) bool { return (member.Kind == StructMemberStatic) == static })
+	for _, member := range it.Members {
+		if (member.Kind == StructMemberEmbed) && (member.Embeds != nil) {
+			ret = append(ret, me.membersOf(member.Embeds, static, seen)...)
+		}
+	}
+	return
+}
+
+func (intel) memberKind(member *StructMember) IntelDeclKind {
+	switch member.Kind {
+	case StructMemberField, StructMemberEmbed:
+		return IntelDeclKindField
+	case StructMemberMethod:
+		return IntelDeclKindMethod
+	}
+	if entry, _ := member.Expr.(*ExprDictEntry); entry != nil {
+		return util.If(exprIsFunc(entry.Val), IntelDeclKindFunc, IntelDeclKindVar)
+	} else if assign, _ := member.Expr.(*ExprAssign); assign != nil {
+		return util.If(exprIsFunc(assign.Rhs), IntelDeclKindFunc, IntelDeclKindVar)
+	}
+	return IntelDeclKindVar
+}
+
+// the members of the subject ending with `toks[idx]` in `foo.`: per its expr if unchanged since the last refresh
+// of the `Trees`, else (if it's a chain of names, as in `foo.bar.`) per the decls and struct members it names
+func (me intel) completionsOfSubj(file *SrcFile, pos SrcFilePos, toks Toks, idx int, decls []*Decl) []*IntelInfo {
+	var static *Struct
+	var decl *Decl
+	var t ty.Type
+	var subj Expr
+	file.Trees.Exprs.Walk(func(expr Expr) bool {
+		if last := expr.Base().Toks; (len(last) > 0) && (last[len(last)-1].Pos == toks[idx].Pos) && (last[len(last)-1].Src == toks[idx].Src) {
+			subj = expr
+		}
+		return true
+	})
+	if ident, _ := subj.(*ExprIdent); ident != nil {
+		decl = ident.Decl
+	} else if subj != nil {
+		t = subj.Base().Type
+	} else { // a chain of names such as `foo.bar.baz`, on a line changed since the last refresh of the `Trees`
+		var names []string
+		for i := idx; (i >= 0) && (toks[i].Kind == TokKindIdentWord); i -= 2 {
+			names = append([]string{toks[i].Src}, names...)
+			if (i < 2) || ((toks[i-1].Src != ".") && (toks[i-1].Src != exprOpNilDot)) || !toks[i].isWhitespacelesslyRightAfter(toks[i-1]) {
+				break
+			} else if !toks[i-1].isWhitespacelesslyRightAfter(toks[i-2]) { // the `.bar.baz` of a method's instance
+				if static = me.structOfMethodAt(file, pos); static == nil {
+					return nil
+				}
+				t, static = static.Type, nil
+				break
+			}
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		if t == nil {
+			if decl = sl.FirstWhere(decls, func(it *Decl) bool { return it.Name == names[0] }); decl == nil {
+				return nil
+			}
+			names = names[1:]
+		}
+		for _, name := range names {
+			var member *StructMember
+			if decl != nil {
+				if decl.Struct != nil {
+					member = decl.Struct.Member(name, true)
+				} else if (decl.Type != nil) && (me.structOfType(file.pack, decl.Type.Type) != nil) {
+					member = me.structOfType(file.pack, decl.Type.Type).Member(name, false)
+				}
+			} else if it := me.structOfType(file.pack, t); it != nil {
+				member = it.Member(name, false)
+			}
+			if member == nil {
+				return nil
+			}
+			decl, t = nil, member.Type
+		}
+	}
+	if decl != nil {
+		if static = decl.Struct; (static == nil) && (decl.Type != nil) {
+			t = decl.Type.Type
+		}
+	}
+	switch it := me.structOfType(file.pack, t); {
+	case static != nil:
+		return me.completionsOfMembers(static, true)
+	case it != nil:
+		return me.completionsOfMembers(it, false)
+	case decl != nil:
+		if assign, _ := decl.Expr.(*ExprAssign); (assign != nil) && (assign.Lhs == decl.Ident) {
+			if dict, _ := assign.Rhs.(*ExprDict); dict != nil {
+				var ret []*IntelInfo
+				for _, entry := range dict.Entries {
+					if (entry.Name != "") && (entry.Val != nil) {
+						ret = append(ret, me.completion(entry.Name, IntelDeclKindField, entry.Val.Base().Type))
+					}
+				}
+				return ret
+			}
 		}
 	}
 	return nil
 }
 
-func (me IntelItems) Where(kind IntelItemKind) IntelItems {
-	return sl.Where(me, func(item IntelItem) bool { return item.Kind == kind })
+// the struct type of the struct literal `Foo { ...` whose keys `toks[idx]` (its `{` or a `,`) is at, with the keys already given
+func (me intel) structOfLitAt(toks Toks, idx int, decls []*Decl) (*Struct, []string) {
+	var given []string
+	for level := 0; idx > 0; idx-- {
+		switch tok := toks[idx]; tok.Src {
+		case ")", "]", "}":
+			level++
+		case "(", "[":
+			level--
+		case ":":
+			if (level == 0) && (toks[idx-1].Kind == TokKindIdentWord) {
+				given = append(given, toks[idx-1].Src)
+			}
+		case "{":
+			if level--; level < 0 {
+				if name := toks[idx-1]; name.Kind == TokKindIdentWord {
+					if decl := sl.FirstWhere(decls, func(it *Decl) bool { return it.Name == name.Src }); decl != nil {
+						return decl.Struct, given
+					}
+				}
+			}
+		}
+		if level < 0 {
+			return nil, nil
+		}
+	}
+	return nil, nil
 }
 
-func (me IntelItems) Name() *IntelItem {
-	return me.First(IntelItemKindName)
+// the struct whose (also out-of-line) instance method `pos` is in
+func (me intel) structOfMethodAt(file *SrcFile, pos SrcFilePos) *Struct {
+	for _, it := range file.pack.Trees.Structs {
+		for _, member := range it.Members {
+			var fn Expr
+			if entry, _ := member.Expr.(*ExprDictEntry); entry != nil {
+				fn = entry.Val
+			} else if assign, _ := member.Expr.(*ExprAssign); assign != nil {
+				fn = assign.Rhs
+			}
+			if (member.Kind == StructMemberMethod) && (member.File == file) && (fn != nil) && me.encloses(file, fn, pos) {
+				return it
+			}
+		}
+	}
+	return nil
+}
+
+// whether `pos` is in any func body, such as of a for-style loop, where `~>` applies
+func (me intel) funcAt(file *SrcFile, pos SrcFilePos) (ret bool) {
+	file.Trees.Exprs.Walk(func(expr Expr) bool {
+		if fn, _ := expr.(*ExprFunc); (fn != nil) && me.encloses(file, fn, pos) {
+			ret = true
+		}
+		return !ret
+	})
+	return
+}
+
+// the decls usable at `pos`: the locals in scope (innermost first), then the pack's top-level ones (by name)
+func (me intel) visibleDecls(file *SrcFile, pos SrcFilePos) (ret []*Decl) {
+	var walk func(owner Expr, exprs ...Expr)
+	walk = func(owner Expr, exprs ...Expr) {
+		for _, expr := range exprs {
+			ExprWalk(expr, func(it Expr) bool {
+				switch it := it.(type) {
+				case *ExprFunc, *ExprBlock, *ExprSwitch:
+					if it != expr {
+						walk(it, it)
+						return false
+					}
+				case *ExprIdent:
+					if decl := it.Decl; (owner != nil) && (decl != nil) && (decl.Ident == it) && (!str.Begins(decl.Name, "_")) &&
+						it.Toks[0].Pos.Before(&pos) && me.encloses(file, owner, pos) {
+						if assign, _ := decl.Expr.(*ExprAssign); (assign == nil) || exprIsFunc(assign.Rhs) || !assign.Toks.Span().Contains(&pos) {
+							ret = append(ret, decl)
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	walk(nil, file.Trees.Exprs...)
+	ret = sl.Reversed(ret)
+	if scope := file.pack.Trees.Scope; scope != nil {
+		var top_level []*Decl
+		for _, decl := range scope.Decls {
+			if !str.Begins(decl.Name, "_") {
+				top_level = append(top_level, decl)
+			}
+		}
+		ret = append(ret, sl.SortedPer(top_level, func(decl1 *Decl, decl2 *Decl) int { return cmp.Compare(decl1.Name, decl2.Name) })...)
+	}
+	if file.HasLexOrParseErrs() { // so the `Trees` are stale or missing: add any top-level `foo :=` not (yet) in them
+		for i, tok := range file.Src.Toks {
+			if (i < len(file.Src.Toks)-1) && (tok.Kind == TokKindIdentWord) && (tok.Pos.Char == 1) && (file.Src.Toks[i+1].Src == ":=") &&
+				(!str.Begins(tok.Src, "_")) && !sl.Any(ret, func(it *Decl) bool { return it.Name == tok.Src }) {
+				ret = append(ret, &Decl{Name: tok.Src, File: file})
+			}
+		}
+	}
+	return
+}
+
+// whether `pos` is in `expr`, or on the lines following it that are indented deeper than its first line (or as deep,
+// if `expr` begins that line), as when typing a new last line of a body not yet covered by the last-refreshed `Trees`
+func (intel) encloses(file *SrcFile, expr Expr, pos SrcFilePos) bool {
+	toks := expr.Base().Toks
+	if len(toks) == 0 {
+		return false
+	}
+	span := toks.Span()
+	if span.Contains(&pos) {
+		return true
+	} else if (!span.Start.Before(&pos)) || (pos.Line == span.Start.Line) {
+		return false
+	}
+	lines := str.Split(file.Src.Text, "\n")
+	indent := func(line string) int { return len(line) - len(strings.TrimLeft(line, " \t")) }
+	if (span.Start.Line > len(lines)) || (pos.Line > len(lines)) {
+		return false
+	}
+	first := lines[span.Start.Line-1]
+	min_indent := indent(first) + util.If(indent(first) == span.Start.Char-1, 0, 1)
+	for line := span.Start.Line + 1; line <= pos.Line; line++ {
+		src := lines[line-1]
+		if line == pos.Line {
+			src = src[:min(len(src), pos.Char-1)]
+		}
+		if (str.Trim(src) != "") && (indent(src) < min_indent) {
+			return false
+		} else if (line == pos.Line) && (str.Trim(src) == "") && (len(src) < min_indent) {
+			return false
+		}
+	}
+	return true
 }
 
-func (intel) dummyFile() *SrcFile {
-	for _, src_file := range state.srcFiles {
-		if !src_file.IsFauxFile() {
-			return src_file
+// IntelExpansion, if set, renders as Lua code what the sugared `expr` of `file` amounts to, for the `IntelItemKindExpansion`
+// of `Info`. Package `lsp` sets it to `codegen.LuaExpansion`, which would be an import cycle for package `session`.
+var IntelExpansion func(file *SrcFile, expr Expr) string
+
+// Info describes the innermost expr at `pos`: its inferred type; for decls and struct members, also their name, kind and
+// preceding `//` comment lines as docs; the lengths or radixes of its compile-time value (see `typeChecker.fold`); and
+// the `Expansion` of the innermost sugared form enclosing it: an update assignment, `.=` or `_`-placeholder func.
+func (me intel) Info(file *SrcFile, pos SrcFilePos) (ret *IntelInfo) {
+	expr := me.exprAt(file, pos)
+	if expr == nil {
+		return
+	}
+	ret = &IntelInfo{SpanFull: util.Ptr(expr.Base().Toks.Span())}
+	var name, docs, descr string
+	t := expr.Base().Type
+	switch decl, member := me.targetAt(file, pos); {
+	case decl != nil:
+		if name = decl.Name; str.Begins(name, "__") { // the param of a `_`-placeholder func, see `SrcPack.desugarRefresh`
+			name = expr.Base().Toks.src(file.Src.Text)
+		}
+		if (t == nil) && (decl.Type != nil) {
+			t = decl.Type.Type
+		}
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindName, Value: name}, IntelItem{Kind: IntelItemKindKind, Value: string(me.declKind(decl))})
+		if decl.Ident != nil {
+			docs = me.docs(decl.File, decl.Ident.Toks[0].Pos.Line)
+		}
+		if decl.Struct != nil {
+			descr, t = me.structDescr(decl.Struct), nil
+		}
+	case member != nil:
+		if _, is_access := expr.(*ExprMember); (!is_access) || (t == nil) {
+			t = member.Type
+		}
+		name = member.Name
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindName, Value: name}, IntelItem{Kind: IntelItemKindKind, Value: string(me.memberKind(member))})
+		if span := me.memberSpan(member); span != nil {
+			docs = me.docs(member.File, span.Start.Line)
+		}
+	}
+	if _, is_stmt := expr.(*ExprAssign); (t != nil) && !is_stmt {
+		descr = util.If(name == "", "", name+": ") + t.String()
+		if _, is_prim := typePrims[t.String()]; is_prim {
+			ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindPrimType, Value: t.String()})
+		}
+	}
+	if descr != "" {
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindDescription, Value: descr, CodeLang: "loon"})
+	}
+	if docs != "" {
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindDescription, Value: docs})
+	}
+
+	switch val := expr.Base().Const.(type) {
+	case string:
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindStrBytesLen, Value: str.FromInt(len(val))},
+			IntelItem{Kind: IntelItemKindStrUtf8RunesLen, Value: str.FromInt(utf8.RuneCountInString(val))})
+	case int64:
+		sign := util.If(val < 0, "-", "")
+		abs := util.If(val < 0, -uint64(val), uint64(val))
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindNumDec, Value: str.FromI64(val, 10)},
+			IntelItem{Kind: IntelItemKindNumHex, Value: sign + "0x" + str.FromU64(abs, 16)},
+			IntelItem{Kind: IntelItemKindNumOct, Value: sign + "0o" + str.FromU64(abs, 8)})
+	case uint64:
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindNumDec, Value: str.FromU64(val, 10)},
+			IntelItem{Kind: IntelItemKindNumHex, Value: "0x" + str.FromU64(val, 16)},
+			IntelItem{Kind: IntelItemKindNumOct, Value: "0o" + str.FromU64(val, 8)})
+	case float64:
+		ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindNumDec, Value: strconv.FormatFloat(val, 'g', -1, 64)})
+	}
+
+	var sugared Expr
+	file.Trees.Exprs.Walk(func(it Expr) bool {
+		if toks := it.Base().Toks; (len(toks) == 0) || !toks.Span().Contains(&pos) {
+			return false
+		}
+		switch it := it.(type) {
+		case *ExprAssign:
+			if sl.Has(exprOpsAssign, it.Op) || (it.Op == exprOpUpdate) {
+				sugared = it
+			}
+		case *ExprFunc:
+			if it.IsDesugared {
+				sugared = it
+			}
+		}
+		return true
+	})
+	if (sugared != nil) && (IntelExpansion != nil) {
+		if src := IntelExpansion(file, sugared); src != "" {
+			ret.Items = append(ret.Items, IntelItem{Kind: IntelItemKindExpansion, Value: src, CodeLang: "lua"})
+		}
+	}
+
+	if len(ret.Items) == 0 {
+		return nil
+	}
+	return
+}
+
+// the members of `it` (other than the out-of-line ones), in the indented dict form of its type decl
+func (intel) structDescr(it *Struct) string {
+	var buf strings.Builder
+	buf.WriteString(it.Decl.Name + " :=")
+	for _, member := range it.Members {
+		if entry, _ := member.Expr.(*ExprDictEntry); entry != nil {
+			buf.WriteString("\n  " + util.If(member.Kind == StructMemberEmbed, "_", member.Name) + ": " +
+				util.If(member.Type != nil, member.Type, ty.Type(ty.TypeVar("?"))).String())
+		}
+	}
+	return buf.String()
+}
+
+// the text of the `//` comments on the lines right above `line` in `file` (other than those trailing code)
+func (intel) docs(file *SrcFile, line int) string {
+	var lines []string
+	toks := sl.Where(file.Src.Toks, func(it *Tok) bool { return (it.Kind != TokKindBegin) && (it.Kind != TokKindEnd) })
+	for i := len(toks) - 1; i >= 0; i-- {
+		if tok := toks[i]; tok.Pos.Line >= line {
+			continue
+		} else if (tok.Kind != TokKindComment) || !str.Begins(tok.Src, "//") || (tok.Pos.Line != line-1-len(lines)) ||
+			((i > 0) && (toks[i-1].span().End.Line == tok.Pos.Line)) {
+			break
+		} else {
+			lines = append([]string{strings.TrimRight(str.TrimPref(str.TrimPref(tok.Src, "//"), " "), " \t\r\n")}, lines...)
+		}
+	}
+	return str.Join(lines, "\n")
+}
+
+// CanRename returns the span of the name at `pos` if it is that of a user-declared `Decl` or of a
+// non-embed struct member, else nil (for literals, keywords, builtins and `_`-prefixed names).
+func (me intel) CanRename(file *SrcFile, pos SrcFilePos) *SrcFileSpan {
+	if me.renameTarget(file, pos) {
+		for _, locs := range me.Lookup(IntelLookupKindRefs, file, pos, true) {
+			if span := sl.FirstWhere(locs.Spans, func(it *SrcFileSpan) bool { return it.Contains(&pos) }); span != nil {
+				return span
+			}
 		}
 	}
 	return nil
 }
 
-func (me intel) dummyLocs() []*SrcFileLocs {
-	file := me.dummyFile()
-	return []*SrcFileLocs{
-		{File: file, Spans: []*SrcFileSpan{{Start: SrcFilePos{Line: 2, Char: 1}, End: SrcFilePos{Line: 2, Char: 8}}}},
-		{File: file, Spans: []*SrcFileSpan{{Start: SrcFilePos{Line: 4, Char: 1}, End: SrcFilePos{Line: 4, Char: 8}}}},
+func (me intel) renameTarget(file *SrcFile, pos SrcFilePos) bool {
+	switch decl, member := me.targetAt(file, pos); {
+	case decl != nil:
+		return (decl.Ident != nil) && !(str.Begins(decl.Name, "_") || IsBuiltinName(decl.Name))
+	case member != nil:
+		return member.Kind != StructMemberEmbed
+	}
+	return false
+}
+
+// Rename returns the edits renaming, across all files of `file`'s pack, the `Decl` or struct member named at `pos`
+// to `newName`, or an error if `CanRename` refuses, if `newName` is not a valid identifier (of the same case,
+// upper for types and lower otherwise), or if it would conflict with or shadow (or be shadowed by) another decl or member.
+func (me intel) Rename(file *SrcFile, pos SrcFilePos, newName string) ([]*IntelEdit, error) {
+	span := me.CanRename(file, pos)
+	if span == nil {
+		return nil, util.Ptr(pos.ToSpan()).newDiagErr(ErrCodeExpectedFoo, "the name of a declaration or struct member")
 	}
+	decl, member := me.targetAt(file, pos)
+	var old_name string
+	if decl != nil {
+		old_name = decl.Name
+	} else {
+		old_name = member.Name
+	}
+	if err := me.renameCheck(span, old_name, newName); err != nil {
+		return nil, err
+	}
+	var locs intelLocs
+	if decl != nil {
+		if err := me.renameConflict(span, decl, newName); err != nil {
+			return nil, err
+		}
+		locs = me.refsOfDecl(file, decl, false)
+		if decl.Struct != nil { // embeds of it are named after it, as in `_: Animal` or `animal: Animal`
+			for _, it := range file.pack.Trees.Structs {
+				for _, embed := range it.Members {
+					if (embed.Kind == StructMemberEmbed) && (embed.Embeds == decl.Struct) && (embed.Name == decl.Name) {
+						locs = append(locs, me.refsOfMember(file, embed, false)...)
+					}
+				}
+			}
+		}
+	} else {
+		if err := me.renameConflictMember(file.pack, span, member, newName); err != nil {
+			return nil, err
+		}
+		locs = me.refsOfMember(file, member, false)
+	}
+	return me.renameEdits(locs, old_name, newName, member != nil), nil
+}
+
+// ensures that `newName` is a non-reserved, non-builtin identifier as `oldName` is, and of the same case
+func (intel) renameCheck(span *SrcFileSpan, oldName string, newName string) error {
+	toks, diags := tokenize("", newName)
+	toks = sl.Where(toks, func(it *Tok) bool { return (it.Kind != TokKindBegin) && (it.Kind != TokKindEnd) })
+	switch {
+	case (len(diags) > 0) || (len(toks) != 1) || (toks[0].Kind != TokKindIdentWord) || (toks[0].Src != newName) ||
+		(newName == "true") || (newName == "false") || (newName == "nil"):
+		return span.newDiagErr(ErrCodeExpectedFoo, "an identifier instead of `"+newName+"`")
+	case str.Begins(newName, "_"):
+		return span.newDiagErr(ErrCodeReserved, newName, "_")
+	case IsBuiltinName(newName):
+		return span.newDiagErr(ErrCodeShadowing, newName)
+	case str.IsUp(oldName[:1]) && !str.IsUp(newName[:1]):
+		return span.newDiagErr(ErrCodeExpectedFoo, "an upper-case first letter for the type name `"+newName+"`")
+	case (!str.IsUp(oldName[:1])) && str.IsUp(newName[:1]):
+		return span.newDiagErr(ErrCodeExpectedFoo, "a lower-case first letter for the non-type name `"+newName+"`")
+	}
+	return nil
+}
+
+// reports a decl named `newName` either visible from that of `decl` or declared in a scope nested in it
+func (intel) renameConflict(span *SrcFileSpan, decl *Decl, newName string) error {
+	if existing := decl.Scope.Lookup(newName); existing != nil {
+		if existing.IsTopLevel() && decl.IsTopLevel() {
+			return span.newDiagErr(ErrCodeDuplTopDecl, newName)
+		}
+		return span.newDiagErr(ErrCodeShadowing, newName)
+	}
+	var err error
+	for _, src_file := range util.If(decl.IsTopLevel(), decl.File.pack.Files, []*SrcFile{decl.File}) {
+		src_file.Trees.Exprs.Walk(func(expr Expr) bool {
+			if ident, _ := expr.(*ExprIdent); (err == nil) && (ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) && (ident.Name == newName) {
+				for scope := ident.Decl.Scope; scope != nil; scope = scope.Parent {
+					if scope == decl.Scope {
+						err = span.newDiagErr(ErrCodeShadowing, newName)
+						break
+					}
+				}
+			}
+			return err == nil
+		})
+	}
+	return err
+}
+
+// reports a member named `newName` in the struct declaring `member`, or in any struct embedding it or embedded by it
+func (intel) renameConflictMember(pack *SrcPack, span *SrcFileSpan, member *StructMember, newName string) error {
+	owner := sl.FirstWhere(pack.Trees.Structs, func(it *Struct) bool { return sl.Has(it.Members, member) })
+	if owner == nil {
+		return nil
+	}
+	for _, it := range pack.Trees.Structs {
+		if (it == owner) || ((it.Type != nil) && (owner.Type != nil) && (it.Type.Embedding(owner.Type) || owner.Type.Embedding(it.Type))) {
+			if (it.Member(newName, false) != nil) || (it.Member(newName, true) != nil) {
+				return span.newDiagErr(ErrCodeDictDuplKey, newName)
+			}
+		}
+	}
+	return nil
+}
+
+// one edit per span of `locs`, except that shorthand dict entries (`{ foo }` and `{ foo: }`) get expanded
+// into `foo: foo` form, so that only the side being renamed (the key if `ofMember`, else the value) changes
+func (intel) renameEdits(locs intelLocs, oldName string, newName string, ofMember bool) (ret []*IntelEdit) {
+	shorthands := map[*Tok]*ExprDictEntry{}
+	for _, it := range locs {
+		if len(it.Spans) > 0 {
+			it.File.Trees.Exprs.Walk(func(expr Expr) bool {
+				if dict, _ := expr.(*ExprDict); dict != nil {
+					for _, entry := range dict.Entries {
+						if val, _ := entry.Val.(*ExprIdent); (entry.Name != "") && (len(entry.Toks) > 0) && (val != nil) && (len(val.Toks) > 0) && (val.Toks[0] == entry.Toks[0]) {
+							shorthands[entry.Toks[0]] = entry
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	done, seen := map[*ExprDictEntry]bool{}, map[*SrcFile]map[SrcFileSpan]bool{}
+	for _, locs := range locs {
+		for _, span := range locs.Spans {
+			tok := sl.FirstWhere(locs.File.Src.Toks, func(it *Tok) bool {
+				return (it.Kind != TokKindBegin) && (it.Kind != TokKindEnd) && (it.Pos == span.Start)
+			})
+			if (tok == nil) || (tok.Src != oldName) || seen[locs.File][*span] { // such as the `_` of embeds like `_: Animal`
+				continue
+			} else if seen[locs.File] == nil {
+				seen[locs.File] = map[SrcFileSpan]bool{}
+			}
+			seen[locs.File][*span] = true
+			if entry := shorthands[tok]; entry != nil {
+				if !done[entry] {
+					done[entry] = true
+					key, val := util.If(ofMember, newName, entry.Name), util.If(ofMember, entry.Name, newName)
+					ret = append(ret, &IntelEdit{File: locs.File, Span: util.Ptr(entry.Toks.Span()), NewText: key + ": " + val})
+				}
+				continue
+			}
+			ret = append(ret, &IntelEdit{File: locs.File, Span: span, NewText: newName})
+		}
+	}
+	return
+}
+
+func (me IntelItems) First(kind IntelItemKind) *IntelItem {
+	for i := range me {
+		if item := &me[i]; item.Kind == kind {
+			return item
+		}
+	}
+	return nil
+}
+
+func (me IntelItems) Where(kind IntelItemKind) IntelItems {
+	return sl.Where(me, func(item IntelItem) bool { return item.Kind == kind })
+}
+
+func (me IntelItems) Name() *IntelItem {
+	return me.First(IntelItemKindName)
 }
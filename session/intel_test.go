@@ -0,0 +1,365 @@
+package session
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"loon/util"
+)
+
+const intelTestSrc = `Pet :=
+  name: Str
+  age: Int
+  greet: (x) ->
+    print(.na‸)
+    ids := [.‸]
+    max(x, .‸)
+    print((pet).‸)
+
+pet := Pet { name: "Rex", age: 3 }
+print(pet.‸)
+`
+
+func TestCompletionsAfterDot(t *testing.T) {
+	for i, expected := range [][]string{
+		{"name"},                 // `print(.na‸)`: of the enclosing method's instance
+		{"age", "greet", "name"}, // `[.‸]`
+		{"age", "greet", "name"}, // `max(x, .‸)`
+		{"age", "greet", "name"}, // `(pet).‸`: of the parenthesized subject
+		{"age", "greet", "name"}, // `pet.‸`
+	} {
+		file, pos := intelTestFile(t, intelTestSrc, i)
+		var actual []string
+		for _, info := range (intel{}).Completions(file, pos) {
+			actual = append(actual, info.Items.Name().Value)
+		}
+		for _, name := range expected {
+			if !slices.Contains(actual, name) {
+				t.Errorf("completion #%d: expected `%s` among %v", i, name, actual)
+			}
+		}
+		if slices.Contains(actual, "pet") {
+			t.Errorf("completion #%d: expected only members, got %v", i, actual)
+		}
+	}
+}
+
+// a one-file `SrcPack` of `src`, plus the position of its `idx`-th `‸` (all of which are removed from `src`)
+func intelTestFile(t *testing.T, src string, idx int) (*SrcFile, SrcFilePos) {
+	var pos SrcFilePos
+	line, char := 1, 1
+	for _, r := range src {
+		switch r {
+		case '‸':
+			if idx--; idx == -1 {
+				pos = SrcFilePos{Line: line, Char: char}
+			}
+		case '\n':
+			line, char = line+1, 1
+		default:
+			char++
+		}
+	}
+	file := &SrcFile{FilePath: filepath.Join(t.TempDir(), "intel.ls")}
+	file.Src.Text = strings.ReplaceAll(src, "‸", "")
+	file.Src.Toks, file.diags.LexErrs = tokenize(file.FilePath, file.Src.Text)
+	file.Src.Ast = file.parse()
+	file.pack = newSrcPack(filepath.Dir(file.FilePath))
+	file.pack.Files = []*SrcFile{file}
+	file.pack.treesRefresh()
+	return file, pos
+}
+
+const intelTestSrcCats = `// an animal
+// with legs
+Anim‸al :=
+  legs: In‸t
+Greeter :=
+  greet: (Str) -> Str
+C‸at :=
+  _: Animal
+  name: Str
+  greet: (n: Str) -> "${n}, I am ${.na‸me}"
+Cat.mew := () -> print(.name)
+tom := Cat { na‸me: "Tom", legs: 4 }
+welcome := (g: Gree‸ter) -> print(g.greet("you"))
+welcome(t‸om)
+count := (items) ->
+  to‸tal := 0
+  items (_, item) -> print(item, total)
+  <- total
+print(count([1, 2]), to‸m.le‸gs, "héllo‸", 25‸5)
+`
+
+func TestIntelDecls(t *testing.T) {
+	file, _ := intelTestFile(t, intelTestSrcCats, -1)
+	for _, it := range []struct {
+		topLevelOnly bool
+		query        string
+		expected     []string // each decl as `name kind spanIdent spanFull`, its `Sub`s indented below it
+	}{
+		{false, "", []string{
+			"Animal struct 3,1-3,7 3,1-4,12",
+			"  legs field 4,3-4,7 4,3-4,12",
+			"Greeter interface 5,1-5,8 5,1-6,22",
+			"  greet field 6,3-6,8 6,3-6,22",
+			"Cat struct 7,1-7,4 7,1-10,43",
+			"  Animal field 8,3-8,4 8,3-8,12",
+			"  name field 9,3-9,7 9,3-9,12",
+			"  greet method 10,3-10,8 10,3-10,43",
+			"Cat.mew method 11,1-11,8 11,1-11,30",
+			"tom var 12,1-12,4 12,1-12,36",
+			"welcome func 13,1-13,8 13,1-13,49",
+			"count func 15,1-15,6 15,1-18,11",
+			"  total var 16,3-16,8 16,3-16,13",
+		}},
+		{true, "", []string{
+			"Animal struct 3,1-3,7 3,1-4,12",
+			"Greeter interface 5,1-5,8 5,1-6,22",
+			"Cat struct 7,1-7,4 7,1-10,43",
+			"Cat.mew method 11,1-11,8 11,1-11,30",
+			"tom var 12,1-12,4 12,1-12,36",
+			"welcome func 13,1-13,8 13,1-13,49",
+			"count func 15,1-15,6 15,1-18,11",
+		}},
+		{false, "grt", []string{ // fuzzily matching, plus the decls with `Sub`s that do
+			"Greeter interface 5,1-5,8 5,1-6,22",
+			"  greet field 6,3-6,8 6,3-6,22",
+			"Cat struct 7,1-7,4 7,1-10,43",
+			"  greet method 10,3-10,8 10,3-10,43",
+		}},
+		{true, "grt", []string{"Greeter interface 5,1-5,8 5,1-6,22"}}, // no `Sub`s to match when top-level only
+		{false, "xyz", nil},
+	} {
+		var actual []string
+		var walk func(string, []*IntelInfo)
+		walk = func(indent string, infos []*IntelInfo) {
+			for _, info := range infos {
+				actual = append(actual, indent+info.Items.Name().Value+" "+intelTestItem(info.Items, IntelItemKindKind)+" "+info.SpanIdent.String()+" "+info.SpanFull.String())
+				walk(indent+"  ", info.Sub)
+			}
+		}
+		walk("", (intel{}).Decls(nil, file, it.topLevelOnly, it.query))
+		if !slices.Equal(actual, it.expected) {
+			t.Errorf("decls (%v, %q):\nexpected %q\n     got %q", it.topLevelOnly, it.query, it.expected, actual)
+		}
+	}
+}
+
+func TestIntelLookup(t *testing.T) {
+	for _, it := range []struct {
+		idx      int
+		kind     IntelLookupKind
+		expected string // spans, each with a `=` suffix if a set (such as the decl or a struct-literal key)
+	}{
+		{0, IntelLookupKindDefs, "3,1-3,7="}, // on the decl itself
+		{2, IntelLookupKindDefs, "7,1-7,4="},
+		{2, IntelLookupKindRefs, "7,1-7,4= 11,1-11,4 12,8-12,11"},
+		{3, IntelLookupKindDefs, "9,3-9,7="}, // `.name` in a method
+		{4, IntelLookupKindRefs, "9,3-9,7= 10,37-10,41 11,25-11,29 12,14-12,18="},
+		{9, IntelLookupKindDefs, "4,3-4,7="}, // promoted from the `_: Animal` embed
+		{9, IntelLookupKindRefs, "4,3-4,7= 12,27-12,31= 19,26-19,30"},
+		{6, IntelLookupKindDecls, "12,1-12,4="},
+		{6, IntelLookupKindRefs, "12,1-12,4= 14,9-14,12 19,22-19,25"},
+		{7, IntelLookupKindRefs, "16,3-16,8= 17,34-17,39 18,6-18,11"}, // a local
+		{8, IntelLookupKindTypes, "7,1-7,4"},
+		{5, IntelLookupKindImpls, "7,1-7,4"},
+		{10, IntelLookupKindDefs, ""},
+		{1, IntelLookupKindDefs, ""}, // a builtin
+	} {
+		file, pos := intelTestFile(t, intelTestSrcCats, it.idx)
+		var actual []string
+		for _, locs := range (intel{}).Lookup(it.kind, file, pos, false) {
+			for i, span := range locs.Spans {
+				actual = append(actual, span.String()+util.If((i < len(locs.IsSet)) && locs.IsSet[i], "=", ""))
+			}
+		}
+		if strings.Join(actual, " ") != it.expected {
+			t.Errorf("lookup %d at #%d: expected %q, got %q", it.kind, it.idx, it.expected, strings.Join(actual, " "))
+		}
+	}
+}
+
+func TestCompletionsInScope(t *testing.T) {
+	const src = `Animal :=
+  legs: Int
+Cat :=
+  _: Animal
+  name: Str
+tom := Cat { name: "Tom", legs: 4 }
+count := (items) ->
+  total := 0
+  items (_, item) -> print(ite‸)
+  <- tot‸
+print(ite‸, tot‸, count(tom))
+‸
+`
+	for i, it := range []struct {
+		expected   []string
+		unexpected []string
+	}{
+		{[]string{"item", "items"}, nil},
+		{[]string{"total"}, []string{"item"}},
+		{nil, []string{"item", "items"}}, // out of their scopes
+		{[]string{"tostring"}, []string{"total"}},
+		{[]string{"Cat", "count", "tom", "print", "for-loop", "switch", "struct"}, []string{"item", "total"}},
+	} {
+		file, pos := intelTestFile(t, src, i)
+		var actual []string
+		for _, info := range (intel{}).Completions(file, pos) {
+			actual = append(actual, info.Items.Name().Value)
+		}
+		for _, name := range it.expected {
+			if !slices.Contains(actual, name) {
+				t.Errorf("completion #%d: expected `%s` among %v", i, name, actual)
+			}
+		}
+		for _, name := range it.unexpected {
+			if slices.Contains(actual, name) {
+				t.Errorf("completion #%d: expected no `%s` among %v", i, name, actual)
+			}
+		}
+	}
+	for src_more, expected := range map[string][]string{
+		"print(tom.‸)\n":                   {"Animal", "legs", "name"}, // including promoted ones
+		"kitty := Cat { name: \"\", ‸ }\n": {"legs"},                   // the fields not yet given
+	} {
+		file, pos := intelTestFile(t, src+src_more, 5)
+		var actual []string
+		for _, info := range (intel{}).Completions(file, pos) {
+			actual = append(actual, info.Items.Name().Value)
+		}
+		if slices.Sort(actual); !slices.Equal(actual, expected) {
+			t.Errorf("completion of %q: expected %v, got %v", src_more, expected, actual)
+		}
+	}
+}
+
+func TestCompletionsOnUnparseableLines(t *testing.T) {
+	const good = "pet := {name: \"x\"}\nprint(pet.name)\n"
+	for _, it := range []struct {
+		src        string
+		lastGood   []string // the expected completions, as refreshed from `good` before `src`
+		noTrees    []string // the expected completions, as never refreshed from anything but `src`
+		unexpected string
+	}{
+		{"pet := {name: \"x\"}\nx := (\nprint(pet.‸)\n", []string{"name"}, nil, "pet"},
+		{"pet := {name: \"x\"}\nprint(pet.na‸\n", []string{"name"}, nil, "pet"},
+		{"pet := {name: \"x\"}\nprint(pet.‸\n", []string{"name"}, nil, "pet"},
+		{"pet := {name: \"x\"}\nprint(pe‸\n", []string{"pet"}, []string{"pet"}, "name"},
+		{"pet := {name: \"x\"}\ndog := [\nprint(do‸)\n", []string{"dog"}, []string{"dog"}, ""}, // not yet in the last-good `Trees`
+		{"pet := {name: \"x\"}\n_dog := [\nprint(do‸)\n", nil, nil, "_dog"},
+		{"pet := {name: \"x\"}\nf := () ->\n  dog := [\nprint(do‸)\n", nil, nil, "dog"}, // not top-level
+	} {
+		file, _ := intelTestFile(t, good, -1)
+		_, pos := intelTestFile(t, it.src, 0)
+		file.Src.Text = strings.ReplaceAll(it.src, "‸", "")
+		file.Src.Toks, file.diags.LexErrs = tokenize(file.FilePath, file.Src.Text)
+		file.Src.Ast = file.parse()
+		if !file.HasLexOrParseErrs() {
+			t.Fatalf("%s: expected lex or parse errs", it.src)
+		}
+		file.pack.treesRefresh()
+		fresh_file, _ := intelTestFile(t, it.src, 0)
+		for i, expected := range [][]string{it.lastGood, it.noTrees} {
+			var actual []string
+			for _, info := range (intel{}).Completions(util.If(i == 0, file, fresh_file), pos) {
+				actual = append(actual, info.Items.Name().Value)
+			}
+			for _, name := range expected {
+				if !slices.Contains(actual, name) {
+					t.Errorf("%s (#%d): expected `%s` among %v", it.src, i, name, actual)
+				}
+			}
+			if (it.unexpected != "") && slices.Contains(actual, it.unexpected) {
+				t.Errorf("%s (#%d): expected no `%s` among %v", it.src, i, it.unexpected, actual)
+			}
+		}
+	}
+}
+
+func TestIntelInfo(t *testing.T) {
+	for _, it := range []struct {
+		idx      int
+		expected string // the `Value`s of all the `Items`
+	}{
+		{0, "Animal | struct | Animal :=\n  legs: Int | an animal\nwith legs"},
+		{2, "Cat | struct | Cat :=\n  _: Animal\n  name: Str\n  greet: (Str) -> Str"},
+		{5, "Greeter | interface | Greeter :=\n  greet: (Str) -> Str"},
+		{3, "name | field | Str | name: Str"},
+		{9, "legs | field | Int | legs: Int"},
+		{6, "tom | var | tom: Cat"},
+		{7, "total | var | Int | total: Int"},
+		{10, "Str | Str | 6 | 5"},
+		{11, "Int | Int | 255 | 0xff | 0o377"},
+	} {
+		file, pos := intelTestFile(t, intelTestSrcCats, it.idx)
+		var actual []string
+		if info := (intel{}).Info(file, pos); info != nil {
+			for _, item := range info.Items {
+				actual = append(actual, item.Value)
+			}
+		}
+		if strings.Join(actual, " | ") != it.expected {
+			t.Errorf("info at #%d: expected %q, got %q", it.idx, it.expected, strings.Join(actual, " | "))
+		}
+	}
+
+	defer func(restore func(*SrcFile, Expr) string) { IntelExpansion = restore }(IntelExpansion)
+	IntelExpansion = func(_ *SrcFile, expr Expr) string { return exprsTestStr(expr) }
+	file, pos := intelTestFile(t, "n := 1\nn += 2‸\n", 0)
+	if info := (intel{}).Info(file, pos); (info == nil) || (intelTestItem(info.Items, IntelItemKindExpansion) != "(+= n 2)") {
+		t.Errorf("info of an update assignment: expected its expansion, got %v", info)
+	}
+}
+
+func TestIntelRename(t *testing.T) {
+	for _, it := range []struct {
+		idx      int
+		newName  string
+		expected string // the edits, else the `DiagCode` of the error
+	}{
+		{4, "title", "9,3-9,7=title 10,37-10,41=title 11,25-11,29=title 12,14-12,18=title"},
+		{6, "jerry", "12,1-12,4=jerry 14,9-14,12=jerry 19,22-19,25=jerry"},
+		{0, "Beast", "3,1-3,7=Beast 8,6-8,12=Beast"},
+		{7, "sum", "16,3-16,8=sum 17,34-17,39=sum 18,6-18,11=sum"},
+		// rejections
+		{1, "Integer", "Unexpected"}, // a built-in type
+		{10, "s", "Unexpected"},      // a literal
+		{6, "Tom", "Unexpected"},     // upper-case only for types
+		{2, "cat", "Unexpected"},     // and types only upper-case
+		{6, "x y", "Unexpected"},     // not an identifier
+		{6, "_tom", "Reserved"},      // `_`-prefixed
+		{6, "print", "Shadowing"},    // a builtin
+		{6, "count", "DuplTopDecl"},  // another top-level decl
+		{7, "items", "Shadowing"},    // the enclosing func's param
+		{6, "item", "Shadowing"},     // a decl in a nested scope
+		{4, "legs", "DictDuplKey"},   // a member promoted from an embed
+		{4, "greet", "DictDuplKey"},  // a member of the same struct
+	} {
+		file, pos := intelTestFile(t, intelTestSrcCats, it.idx)
+		var actual []string
+		edits, err := (intel{}).Rename(file, pos, it.newName)
+		if err != nil {
+			actual = append(actual, string(err.(*Diag).Code))
+		}
+		for _, edit := range edits {
+			actual = append(actual, edit.Span.String()+"="+edit.NewText)
+		}
+		if strings.Join(actual, " ") != it.expected {
+			t.Errorf("rename at #%d to `%s`: expected %q, got %q", it.idx, it.newName, it.expected, strings.Join(actual, " "))
+		}
+	}
+}
+
+// the `Value` of the first of `items` of `kind`
+func intelTestItem(items IntelItems, kind IntelItemKind) string {
+	for _, item := range items {
+		if item.Kind == kind {
+			return item.Value
+		}
+	}
+	return ""
+}
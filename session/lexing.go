@@ -1,6 +1,8 @@
 package session
 
 import (
+	"slices"
+	"strconv"
 	"strings"
 	"text/scanner"
 	"unicode"
@@ -36,7 +38,15 @@ const (
 	TokKindLitFloat   // eg. 12.3 or -3.21
 )
 
-// only called by `EnsureSrcFile`
+// only called by `ensureSrcFiles`
+func (me *SrcFile) tokenize() (Toks, Diags) {
+	if me.Notebook != nil {
+		return me.Notebook.tokenize(me.FilePath)
+	}
+	return tokenize(me.FilePath, me.Src.Text)
+}
+
+// lexes `curFullSrcFileContent` as one chunk, see `SrcFile.tokenize` for whole source files
 func tokenize(srcFilePath string, curFullSrcFileContent string) (ret Toks, errs Diags) {
 	if len(curFullSrcFileContent) == 0 {
 		return
@@ -44,7 +54,9 @@ func tokenize(srcFilePath string, curFullSrcFileContent string) (ret Toks, errs
 
 	var scan scanner.Scanner
 	scan.Init(strings.NewReader(curFullSrcFileContent))
-	scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats | scanner.ScanChars | scanner.ScanStrings | scanner.ScanRawStrings | scanner.ScanComments
+	// no `scanner.ScanStrings` or `scanner.ScanRawStrings`: we scan those ourselves (see `scanStrRest`) to allow
+	// line breaks in them, and string literals of the same quote char inside their `${}`s
+	scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats | scanner.ScanChars | scanner.ScanComments
 	scan.Error = func(_ *scanner.Scanner, msg string) {
 		errs.Add(&Diag{Kind: DiagKindErr, Code: ErrCodeLexingError,
 			Message: errMsg(ErrCodeLexingError, msg), Span: (&SrcFilePos{Line: scan.Line, Char: scan.Column}).ToSpan()})
@@ -68,6 +80,10 @@ func tokenize(srcFilePath string, curFullSrcFileContent string) (ret Toks, errs
 	for lexeme := scan.Scan(); lexeme != scanner.EOF; lexeme = scan.Scan() {
 		tok := &Tok{Pos: SrcFilePos{Line: scan.Line, Char: scan.Column}, byteOffset: scan.Offset}
 		tok.Src = curFullSrcFileContent[tok.byteOffset : tok.byteOffset+len(scan.TokenText())] // to avoid all those string copies we'd have if we just did tok.Src=scan.TokenText()
+		if (lexeme == '"') || (lexeme == '`') {
+			lexeme = scanner.String
+			tok.Src = curFullSrcFileContent[tok.byteOffset:scanStrRest(&scan, tok, curFullSrcFileContent)]
+		}
 		switch lexeme {
 		case scanner.Int:
 			tok.Kind = TokKindLitInt
@@ -77,7 +93,7 @@ func tokenize(srcFilePath string, curFullSrcFileContent string) (ret Toks, errs
 			tok.Kind = TokKindLitRune
 		case scanner.Comment:
 			tok.Kind = TokKindComment
-		case scanner.String, scanner.RawString:
+		case scanner.String:
 			tok.Kind = TokKindLitStr
 		case scanner.Ident:
 			tok.Kind = TokKindIdentWord
@@ -97,7 +113,10 @@ func tokenize(srcFilePath string, curFullSrcFileContent string) (ret Toks, errs
 				ret, errs = append(ret, tok), append(errs, tok.newIndentErr())
 				return
 			}
-		} else if is_new_line := (brac_level <= 0) && (tok.Pos.Line > prev.Pos.Line); is_new_line {
+		} else if is_new_line := (brac_level <= 0) && (tok.Pos.Line > prev.span().End.Line) &&
+			// a line ending in a binary operator continues (rather than begins a block) in more-indented lines,
+			// much like lines inside bracketings (with `brac_level > 0`) do
+			!((tok.Pos.Char > stack[len(stack)-1]) && (prev.Kind == TokKindIdentOpish) && (exprOpsBinary[prev.Src] > 0)); is_new_line {
 			// on newline: indent/dedent/newline handling, taken from https://docs.python.org/3/reference/lexical_analysis.html#indentation
 			stack_top := stack[len(stack)-1]
 			if tok.Pos.Char < stack_top {
@@ -157,6 +176,13 @@ func tokenize(srcFilePath string, curFullSrcFileContent string) (ret Toks, errs
 			ret = append(ret, tok, dot)
 			tok = dot // so that `prev` will be correct
 			// case (prev != nil) && ((tok.Kind == TokKindLitInt) || (tok.Kind == TokKindLitFloat)) && (prev.Src == "-") && tok.isWhitespacelesslyRightAfter(prev):
+		case (prev != nil) && (tok.Kind == TokKindLitFloat) && (tok.Src[0] == '.') && (prev.Kind == TokKindIdentOpish) &&
+			(strings.Trim(prev.Src, ".") == "") && tok.isWhitespacelesslyRightAfter(prev):
+			// dot-leading float toks right after a dot op, as in `1..3` or `10...20`, would otherwise be `1` `.` `.3` or `10` `..` `.20`
+			prev.Src += tok.Src[:1]
+			tok.byteOffset, tok.Pos.Char, tok.Src = tok.byteOffset+1, tok.Pos.Char+1, tok.Src[1:]
+			tok.Kind = util.If(strings.ContainsAny(tok.Src, ".eE"), TokKindLitFloat, TokKindLitInt)
+			ret = append(ret, tok)
 		}
 
 		prev = tok
@@ -168,9 +194,232 @@ func tokenize(srcFilePath string, curFullSrcFileContent string) (ret Toks, errs
 			Pos: SrcFilePos{Line: prev.Pos.Line, Char: prev.Pos.Char + utf8.RuneCountInString(prev.Src)}})
 	}
 
+	// the exprs in the `${}`s of string literals get lexed too, their toks placed right after their string-literal tok
+	for i := 0; i < len(ret); i++ {
+		if tok := ret[i]; (tok.Kind == TokKindLitStr) && str.Has(tok.Src, "${") {
+			toks, toks_errs := tok.strInterpToks(srcFilePath)
+			ret, errs = slices.Insert(ret, i+1, toks...), append(errs, toks_errs...)
+			i += len(toks)
+		}
+	}
+	return
+}
+
+// the byte ranges (in `src`, a terminated string literal) of the exprs inside all its `${}`s, leading
+// whitespace skipped. Is `nil` if there are none, or if any `${` lacks its closing `}`
+func strInterpEmbeds(src string) (ret [][2]int) {
+	if (len(src) < 2) || (strLitEnd(src, 0, true) != len(src)) {
+		return nil
+	}
+	for i := 1; i < len(src)-2; i++ {
+		if (src[0] == '"') && (src[i] == '\\') {
+			i++
+			continue
+		} else if (src[i] != '$') || (src[i+1] != '{') {
+			continue
+		}
+		end, _ := strEmbedEnd(src, i+2, src[0])
+		start := i + 2
+		for (start < end) && ((src[start] == ' ') || (src[start] == '\t') || (src[start] == '\n') || (src[start] == '\r')) {
+			start++
+		}
+		ret, i = append(ret, [2]int{start, end}), end
+	}
+	return
+}
+
+// the byte offset right after the closing quote of the string literal beginning (with "`" or `"`) at `src[start]`,
+// or -1 if it is unterminated. With `embeds`, its `${}`s are scanned brace-depth-aware (see `strEmbedEnd`), so
+// that quote chars and `}`s of string literals nested in them do not end them (nor the string literal) early
+func strLitEnd(src string, start int, embeds bool) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case (quote == '"') && (src[i] == '\\'):
+			i++
+		case src[i] == quote:
+			return i + 1
+		case embeds && (src[i] == '$') && ((i + 1) < len(src)) && (src[i+1] == '{'):
+			if i, _ = strEmbedEnd(src, i+2, quote); i < 0 {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// the byte offset of the `}` closing the `${` right before `src[start]` in a string literal of `quote`, or -1 if
+// there is none. Any string and rune literals in between are skipped. With `escaped`, there are backslashes
+// outside those, as in the `\"`s of `"${foo(\"bar\")}"`, the older way of nesting string literals in `${}`s
+func strEmbedEnd(src string, start int, quote byte) (end int, escaped bool) {
+	var level int
+	for i := start; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if quote == '"' {
+				escaped, i = true, i+1
+			}
+		case '"', '`':
+			if i = strLitEnd(src, i, true) - 1; i < 0 {
+				return -1, escaped
+			}
+		case '\'':
+			for i++; (i < len(src)) && (src[i] != '\''); i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		case '{':
+			level++
+		case '}':
+			if level == 0 {
+				return i, escaped
+			}
+			level--
+		}
+	}
+	return -1, escaped
+}
+
+// lexes the exprs inside the `${}`s of the string-literal `me`, with the toks' (and errs') positions made
+// absolute so that they point into the source as written. The `TokKindBegin`s and `TokKindEnd`s are omitted.
+func (me *Tok) strInterpToks(srcFilePath string) (ret Toks, errs Diags) {
+	for _, embed := range strInterpEmbeds(me.Src) {
+		src, offsets := me.Src[embed[0]:embed[1]], []int(nil)
+		if _, escaped := strEmbedEnd(me.Src, embed[0], me.Src[0]); escaped {
+			src, offsets = strUnescape(src)
+		}
+		pos := func(idx int) (int, SrcFilePos) { // from a byte offset in `src` to that in `me.Src` and its position
+			if offsets != nil {
+				idx = offsets[idx]
+			}
+			return embed[0] + idx, me.posAt(embed[0] + idx)
+		}
+		toks, toks_errs := tokenize(srcFilePath, src)
+		var level int
+		for _, tok := range toks {
+			if (tok.Kind == TokKindBracketing) && (level >= 0) {
+				level += util.If(tok.isBracketingOpening(0), 1, -1)
+			}
+		}
+		for _, err := range toks_errs {
+			_, err.Span.Start = pos(srcByteIdx(src, err.Span.Start))
+			_, err.Span.End = pos(srcByteIdx(src, err.Span.End))
+		}
+		if errs = append(errs, toks_errs...); level != 0 { // the enclosing bracketings must not be thrown off by these toks
+			errs.Add(&Diag{Kind: DiagKindErr, Span: me.span(), Code: ErrCodeBracketingMismatch,
+				Message: errMsg(ErrCodeBracketingMismatch, "brackets inside `${}`")})
+			continue
+		}
+		for _, tok := range toks {
+			if (tok.Kind != TokKindBegin) && (tok.Kind != TokKindEnd) {
+				idx, tok_pos := pos(tok.byteOffset)
+				tok.byteOffset, tok.Pos = me.byteOffset+idx, tok_pos
+				ret = append(ret, tok)
+			}
+		}
+	}
+	return
+}
+
+// `src` with its backslash escapes resolved, and for each byte of that (plus its end) the byte offset in `src`
+// it stems from. If `src` won't unescape, it is returned as-is with `nil` offsets
+func strUnescape(src string) (string, []int) {
+	var buf strings.Builder
+	offsets := make([]int, 0, len(src)+1)
+	for rest := src; len(rest) > 0; {
+		char, multibyte, tail, err := strconv.UnquoteChar(rest, '"')
+		if err != nil {
+			return src, nil
+		}
+		idx, len_before := len(src)-len(rest), buf.Len()
+		if multibyte {
+			_, _ = buf.WriteRune(char)
+		} else {
+			_ = buf.WriteByte(byte(char))
+		}
+		for range buf.Len() - len_before {
+			offsets = append(offsets, idx)
+		}
+		rest = tail
+	}
+	return buf.String(), append(offsets, len(src))
+}
+
+// the byte offset in `src` of the position `pos` relative to `src`, the reverse of `Tok.posAt`
+func srcByteIdx(src string, pos SrcFilePos) int {
+	line, char := 1, 1
+	for i, r := range src {
+		if (line > pos.Line) || ((line == pos.Line) && (char >= pos.Char)) {
+			return i
+		}
+		if r == '\n' {
+			line, char = line+1, 1
+		} else {
+			char++
+		}
+	}
+	return len(src)
+}
+
+// the position of the byte at `idx` in `me.Src`
+func (me *Tok) posAt(idx int) (ret SrcFilePos) {
+	ret = me.Pos
+	for _, r := range me.Src[:idx] {
+		if r == '\n' {
+			ret.Line, ret.Char = ret.Line+1, 1
+		} else {
+			ret.Char++
+		}
+	}
 	return
 }
 
+// consumes the rest of a string literal whose opening quote was just scanned as `tok`, returning the byte
+// offset right after its closing quote (line breaks are allowed). A string literal whose `${}`s won't close ends
+// at its first closing quote, so that a half-typed `${` does not swallow all the source after it
+func scanStrRest(scan *scanner.Scanner, tok *Tok, src string) int {
+	end := strLitEnd(src, tok.byteOffset, true)
+	if end < 0 {
+		end = strLitEnd(src, tok.byteOffset, false)
+	}
+	for (scan.Pos().Offset < util.If(end < 0, len(src), end)) && (scan.Next() != scanner.EOF) {
+	}
+	scan.Line, scan.Column = tok.Pos.Line, tok.Pos.Char // `scan.Next` invalidated these
+	if end < 0 {
+		scan.Error(scan, "literal not terminated")
+	}
+	return scan.Pos().Offset
+}
+
+// ReplInputIsIncomplete reports whether the (possibly multi-line) `src` typed into a REPL so far
+// awaits more lines: while it has an unclosed bracketing or string literal, while its last line ends
+// in an operator expecting more (such as `->` or `:=`), or while an indented block (begun by a `TokKindBegin`
+// deeper than the top level) is still open and not yet ended by an empty line.
+func ReplInputIsIncomplete(src string) bool {
+	toks, _ := tokenize("", src)
+	var brac_level, num_trailing_ends int
+	var last *Tok
+	for _, tok := range toks {
+		switch tok.Kind {
+		case TokKindEnd:
+			num_trailing_ends++
+			continue
+		case TokKindBracketing:
+			brac_level += util.If(tok.isBracketingOpening(0), 1, -1)
+		}
+		if tok.Kind != TokKindBegin {
+			num_trailing_ends = 0
+			if tok.Kind != TokKindComment {
+				last = tok
+			}
+		}
+	}
+	return (last != nil) && ((brac_level > 0) || (last.Kind == TokKindIdentOpish) ||
+		((last.Kind == TokKindLitStr) && (strLitEnd(last.Src, 0, true) != len(last.Src)) && (strLitEnd(last.Src, 0, false) != len(last.Src))) ||
+		((num_trailing_ends > 1) && !str.Ends(src, "\n\n")))
+}
+
 func (me *Tok) bracketingMatch() rune {
 	if len(me.Src) > 0 {
 		switch me.Src[0] {
@@ -223,6 +472,15 @@ func (me *Tok) isBracketingMatch(it *Tok) bool {
 	return (len(me.Src) > 0) && ((me.Src[0] == '(' && it.Src[0] == ')') || (me.Src[0] == '[' && it.Src[0] == ']') || (me.Src[0] == '{' && it.Src[0] == '}'))
 }
 
+// whether `me` can end a subject expr, such as the `foo`, `)` or `"bar"` before the `.` of `foo.baz`, `foo().baz` or `"bar".baz`
+func (me *Tok) isSubjEnd() bool {
+	switch me.Kind {
+	case TokKindIdentWord, TokKindLitInt, TokKindLitFloat, TokKindLitRune, TokKindLitStr:
+		return true
+	}
+	return me.isBracketingClosing(0)
+}
+
 func (me *Tok) isSep() bool {
 	return (len(me.Src) == 1) && ((me.Src[0] == ',') || (me.Src[0] == ':'))
 }
@@ -323,6 +581,39 @@ func (me Toks) split(delimChar byte) (ret []Toks) {
 	return
 }
 
+// splits at those line breaks (outside of any bracketings) that begin a new `key: value` pair
+func (me Toks) splitPairLines() (ret []Toks) {
+	var idx, brac_level int
+	for i, tok := range me {
+		if (i > idx) && (brac_level == 0) && (tok.Pos.Line > me[i-1].span().End.Line) && me[i:].lineHasPairSep() {
+			ret, idx = append(ret, me[idx:i]), i
+		}
+		if tok.isBracketingOpening(0) {
+			brac_level++
+		} else if tok.isBracketingClosing(0) {
+			brac_level--
+		}
+	}
+	return append(ret, me[idx:])
+}
+
+// whether the first line of `me` has a `:` separator outside of any bracketings
+func (me Toks) lineHasPairSep() bool {
+	var brac_level int
+	for i, tok := range me {
+		if (i > 0) && (tok.Pos.Line > me[i-1].span().End.Line) {
+			break
+		} else if tok.isBracketingOpening(0) {
+			brac_level++
+		} else if tok.isBracketingClosing(0) {
+			brac_level--
+		} else if (brac_level == 0) && (tok.Src == ":") {
+			return true
+		}
+	}
+	return false
+}
+
 func (me Toks) src(curFullSrcFileContent string) string {
 	if len(me) == 0 {
 		return ""
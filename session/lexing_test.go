@@ -0,0 +1,94 @@
+package session
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeStrInterp(t *testing.T) {
+	for _, it := range []struct {
+		src      string
+		expected string // each non-`TokKindBegin`/`TokKindEnd` tok as `line:char@byteOffset:src`
+	}{
+		{`"a ${n} b"`, `1:1@0:"a ${n} b" 1:6@5:n`},
+		// same quote char in the `${}`
+		{`"a ${"b ${n}"} c"`, `1:1@0:"a ${"b ${n}"} c" 1:6@5:"b ${n}" 1:11@10:n`},
+		{"`a ${`b ${n}`} c`", "1:1@0:`a ${`b ${n}`} c` 1:6@5:`b ${n}` 1:11@10:n"},
+		// `}`s and quotes inside string and rune literals in the `${}` do not end it
+		{`"${f("}", '"')}"`, `1:1@0:"${f("}", '"')}" 1:4@3:f 1:5@4:( 1:6@5:"}" 1:9@8:, 1:11@10:'"' 1:14@13:)`},
+		{`"${ {a: 1}.a }"`, `1:1@0:"${ {a: 1}.a }" 1:5@4:{ 1:6@5:a 1:7@6:: 1:9@8:1 1:10@9:} 1:11@10:. 1:12@11:a`},
+		// escapes, both before and (the older way of nesting string literals) inside the `${}`
+		{`"\"${n}\" \\${m}"`, `1:1@0:"\"${n}\" \\${m}" 1:6@5:n 1:15@14:m`},
+		{`"${f(\"x\", n)}"`, `1:1@0:"${f(\"x\", n)}" 1:4@3:f 1:5@4:( 1:6@5:"x" 1:11@10:, 1:13@12:n 1:14@13:)`},
+		{`"${f(\"x\")} ${n}"`, `1:1@0:"${f(\"x\")} ${n}" 1:4@3:f 1:5@4:( 1:6@5:"x" 1:11@10:) 1:16@15:n`},
+		// across lines
+		{"\"a\n  ${\n  \"b ${n}\"} c\"", "1:1@0:\"a\n  ${\n  \"b ${n}\"} c\" 3:3@10:\"b ${n}\" 3:8@15:n"},
+		// a half-typed `${` ends its string literal at its first closing quote as before
+		{`"a ${" b`, `1:1@0:"a ${" 1:8@7:b`},
+	} {
+		toks, errs := tokenize("", it.src)
+		if len(errs) > 0 {
+			t.Errorf("%s: unexpected %s", it.src, errs[0].Message)
+			continue
+		}
+		var actual []string
+		for _, tok := range toks {
+			if (tok.Kind != TokKindBegin) && (tok.Kind != TokKindEnd) {
+				actual = append(actual, strconv.Itoa(tok.Pos.Line)+":"+strconv.Itoa(tok.Pos.Char)+"@"+strconv.Itoa(tok.byteOffset)+":"+tok.Src)
+			}
+		}
+		if strings.Join(actual, " ") != it.expected {
+			t.Errorf("%s:\nexpected %s\n     got %s", it.src, it.expected, strings.Join(actual, " "))
+		}
+	}
+}
+
+func TestTokenizeStrInterpErrs(t *testing.T) {
+	for _, it := range []struct {
+		src      string
+		expected string // `line:char` of the err
+	}{
+		{`"a ${"b ${n}"`, "1:13"},
+		{`"${f(\"x\") 1x}"`, "1:14"}, // after the backslashes
+		{"\"a\n  ${f(\\\"x\\\") 1x}\"", "2:15"},
+	} {
+		_, errs := tokenize("", it.src)
+		if len(errs) == 0 {
+			t.Errorf("%s: expected an error", it.src)
+		} else if actual := strconv.Itoa(errs[0].Span.Start.Line) + ":" + strconv.Itoa(errs[0].Span.Start.Char); actual != it.expected {
+			t.Errorf("%s: expected error at %s, got %s (%s)", it.src, it.expected, actual, errs[0].Message)
+		}
+	}
+}
+
+func TestReplInputIsIncomplete(t *testing.T) {
+	for _, it := range []struct {
+		src        string
+		incomplete bool
+	}{
+		{"", false},
+		{"x := 1", false},
+		{"print(x) // done", false},
+		{"f := (a) ->\n  a * 2\n\n", false}, // the indented block ended by an empty line
+		{"?| x > 1\n  print(x)\n\n", false},
+		{"print(1, [2, 3])", false},
+		{`print("a ${n} b")`, false},
+		// awaiting more lines
+		{"f := (a) ->", true},
+		{"x :=", true},
+		{"x := 1 +", true},
+		{"x := 1 + // more to come", true},
+		{"print(1,", true},
+		{"xs := [1,\n  2", true},
+		{"d := {\n  a: 1,\n", true},
+		{"f := (a) ->\n  a * 2", true}, // the indented block not yet ended by an empty line
+		{"?| x > 1\n  print(x)\n", true},
+		{"s := `multi\nline", true},
+		{`s := "a ${f(`, true},
+	} {
+		if actual := ReplInputIsIncomplete(it.src); actual != it.incomplete {
+			t.Errorf("%q: expected %v, got %v", it.src, it.incomplete, actual)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"loon/util/str"
+)
+
+// SrcNotebook is the content of a `.lsrepl` notebook file, which on disk is a JSON list of `SrcNotebookCell`s.
+// Each cell is lexed and parsed as its own chunk, but all cells share the one scope of their `SrcFile`.
+type SrcNotebook struct {
+	Cells []*SrcNotebookCell
+}
+
+type SrcNotebookCell struct {
+	Src     string   `json:"src"`
+	Outputs []string `json:"outputs,omitempty"` // as captured from the last evaluation of `Src`, if any
+
+	lineOffset int // number of lines in the `SrcFile.Src.Text` before this cell's `Src`
+	byteOffset int // number of bytes in the `SrcFile.Src.Text` before this cell's `Src`
+	toks       Toks
+}
+
+func (me *SrcFile) IsNotebook() bool { return IsSrcFilePathOfNotebook(me.FilePath) }
+func IsSrcFilePathOfNotebook(srcFilePath string) bool {
+	return filepath.Ext(srcFilePath) == ".lsrepl"
+}
+
+// only called by `ensureSrcFiles` right after setting `Src.Text` from the file's (JSON) content: for notebooks,
+// sets `Notebook` and replaces `Src.Text` with all of its cells' `Src`s, one after another, each on its own lines
+func (me *SrcFile) notebookFromSrcText() {
+	if !me.IsNotebook() {
+		return
+	}
+	me.Notebook = &SrcNotebook{}
+	if err := json.Unmarshal([]byte(me.Src.Text), &me.Notebook.Cells); err != nil {
+		me.Notebook.Cells, me.diags.LastReadErr = nil, errToDiag(err, ErrCodeFileReadError, me.Span())
+		return
+	}
+	var buf str.Buf
+	for _, cell := range me.Notebook.Cells {
+		cell.byteOffset, cell.lineOffset = buf.Len(), strings.Count(buf.String(), "\n")
+		buf.WriteString(cell.Src)
+		if !str.Ends(cell.Src, "\n") {
+			buf.WriteByte('\n')
+		}
+	}
+	me.Src.Text = buf.String()
+}
+
+// tokenizes every cell on its own, so that mis-indentations or unclosed brackets in one won't affect the next
+func (me *SrcNotebook) tokenize(srcFilePath string) (ret Toks, errs Diags) {
+	for _, cell := range me.Cells {
+		toks, cell_errs := tokenize(srcFilePath, cell.Src)
+		for _, tok := range toks {
+			tok.byteOffset, tok.Pos.Line = tok.byteOffset+cell.byteOffset, tok.Pos.Line+cell.lineOffset
+		}
+		for _, err := range cell_errs {
+			err.Span.Start.Line, err.Span.End.Line = err.Span.Start.Line+cell.lineOffset, err.Span.End.Line+cell.lineOffset
+		}
+		cell.toks = toks
+		ret, errs = append(ret, toks...), append(errs, cell_errs...)
+	}
+	return
+}
+
+// CellSpan returns the index of the cell containing `span` (from the `SrcFile` of `me`) and that same span relative to that cell.
+func (me *SrcNotebook) CellSpan(span *SrcFileSpan) (cellIdx int, cellSpan SrcFileSpan) {
+	for i, cell := range me.Cells {
+		if cell.lineOffset < span.Start.Line {
+			cellIdx = i
+		}
+	}
+	cellSpan = *span
+	if len(me.Cells) > 0 {
+		line_offset := me.Cells[cellIdx].lineOffset
+		cellSpan.Start.Line, cellSpan.End.Line = cellSpan.Start.Line-line_offset, cellSpan.End.Line-line_offset
+	}
+	return
+}
+
+// FilePos returns the position (in the `SrcFile` of `me`) of `cellPos`, which is relative to the cell at `cellIdx`:
+// the reverse of `CellSpan`.
+func (me *SrcNotebook) FilePos(cellIdx int, cellPos SrcFilePos) SrcFilePos {
+	if (cellIdx >= 0) && (cellIdx < len(me.Cells)) {
+		cellPos.Line += me.Cells[cellIdx].lineOffset
+	}
+	return cellPos
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"loon/util/str"
+)
+
+func TestNotebook(t *testing.T) {
+	for _, it := range []struct {
+		cells    string
+		text     string   // the `Src.Text` of all cells
+		expected []string // each diag as `Code@span` of the whole file, then as `#cellIdx@span` relative to its cell
+	}{
+		{`[{"src": "x := 1\n"}, {"src": "y := x + 1\ny", "outputs": ["2"]}]`, "x := 1\ny := x + 1\ny\n", nil}, // one shared scope
+		{`[{"src": "x := 1\n"}, {"src": "y := 2"}, {"src": "print(x, y, 1 +)"}]`, "x := 1\ny := 2\nprint(x, y, 1 +)\n",
+			[]string{"Unexpected@3,16 #2@1,16"}},
+		{`[{"src": "y := 2\n\n"}, {"src": "print(\n  y, 1 +)"}]`, "y := 2\n\nprint(\n  y, 1 +)\n",
+			[]string{"Unexpected@4,9 #1@2,9"}},
+		{`[{"src": "x := 1\n"}, {"src": "y := 2"}, {"src": "print(x, y, z)"}]`, "x := 1\ny := 2\nprint(x, y, z)\n",
+			[]string{"NotDefined@3,13-3,14 #2@1,13-1,14"}},
+		{`[{"src": "y := 2\n\n"}, {"src": "print(\n  y, z)"}]`, "y := 2\n\nprint(\n  y, z)\n",
+			[]string{"NotDefined@4,6-4,7 #1@2,6-2,7"}},
+		// an unclosed bracket ends with its cell, not spilling into the next
+		{`[{"src": "x := (1 +"}, {"src": "print(x)"}]`, "x := (1 +\nprint(x)\n",
+			[]string{"BracketingMismatch@1,6-1,10 #0@1,6-1,10"}},
+		{`[{"src": "x := 1"},`, "", []string{"FileReadError@1,1-2,1 #0@1,1-2,1"}},
+	} {
+		file := &SrcFile{FilePath: filepath.Join(t.TempDir(), "notebook.lsrepl")}
+		file.Src.Text = it.cells
+		file.notebookFromSrcText()
+		if (file.diags.LastReadErr == nil) && (file.Src.Text != it.text) {
+			t.Errorf("%s: expected text %q, got %q", it.cells, it.text, file.Src.Text)
+		}
+		file.Src.Toks, file.diags.LexErrs = file.tokenize()
+		file.Src.Ast = file.parse()
+		file.pack = newSrcPack(filepath.Dir(file.FilePath))
+		file.pack.Files = []*SrcFile{file}
+		file.pack.treesRefresh()
+		var actual []string
+		for _, diag := range file.allDiags() {
+			cell_idx, cell_span := file.Notebook.CellSpan(&diag.Span)
+			actual = append(actual, string(diag.Code)+"@"+diag.Span.String()+" #"+str.FromInt(cell_idx)+"@"+cell_span.String())
+			if file_pos := file.Notebook.FilePos(cell_idx, cell_span.Start); file_pos != diag.Span.Start {
+				t.Errorf("%s: expected %s back from FilePos, got %s", it.cells, diag.Span.Start.String(), file_pos.String())
+			}
+		}
+		if !slices.Equal(actual, it.expected) {
+			t.Errorf("%s:\nexpected %q\n     got %q", it.cells, it.expected, actual)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package session
 import (
 	"cmp"
 	"errors"
+	"sort"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 
 	"loon/util"
@@ -36,12 +38,20 @@ const (
 
 // only called by EnsureSrcFile, just after tokenization, with `.diags.LexErrs` freshly set.
 // mutates me.Content.TopLevelAstNodes and me.diags.ParseErrs.
-func (me *SrcFile) parse() AstNodes {
-	parsed := me.parseNodes(me.Src.Toks)
+func (me *SrcFile) parse() (parsed AstNodes) {
+	if me.Notebook == nil {
+		parsed = me.parseNodes(me.Src.Toks)
+	} else { // every cell is its own chunk
+		for _, cell := range me.Notebook.Cells {
+			parsed = append(parsed, me.parseNodes(cell.toks)...)
+		}
+	}
 
 	// group huddled exprs: `foo x+z y` right now is `foo x + z y` BUT lets make it `foo (x + 1) y`:
 	parsed.walk(nil, func(node *AstNode) {
-		node.Nodes = node.Nodes.huddled(me, node)
+		if node.Kind != AstNodeKindLit { // its `Nodes`, if any, are the parts of an interpolated string
+			node.Nodes = node.Nodes.huddled(me, node)
+		}
 	})
 
 	// set all `AstNode.parent`s only after above re-arrangements; also
@@ -78,8 +88,20 @@ func (me *SrcFile) parseNodes(toks Toks) (ret AstNodes) {
 			ret = append(ret, &AstNode{Kind: AstNodeKindComment, Toks: toks[:1], Src: tok.Src, Lit: tok.Src})
 			toks = toks[1:]
 		case TokKindLitStr:
-			ret = append(ret, parseLit(toks, AstNodeKindLit, strconv.Unquote))
-			toks = toks[1:]
+			num_toks := 1 // the string literal, then the toks of its `${}` exprs (if any, see `Tok.strInterpToks`)
+			for (num_toks < len(toks)) && (toks[num_toks].byteOffset < (tok.byteOffset + len(tok.Src))) {
+				num_toks++
+			}
+			var node *AstNode
+			if embeds := strInterpEmbeds(tok.Src); embeds != nil { // not `unquote`d whole, as its `${}`s may well contain string literals of the same quote char
+				node = &AstNode{Kind: AstNodeKindLit, Toks: toks[:1], Src: tok.Src, Lit: ""}
+				me.parseStrInterp(node, embeds, toks[1:num_toks])
+			} else if node = parseLit(toks, AstNodeKindLit, unquote); (node.Kind == AstNodeKindLit) && str.Has(tok.Src, "${") {
+				// still a (non-interpolated) `AstNodeKindLit`, as the rest of its expr may well be fine
+				node.errParsing = tok.newErr(ErrCodeExpectedFoo, "closing `}` for the `${` in this string")
+			}
+			ret = append(ret, node)
+			toks = toks[num_toks:]
 		case TokKindLitFloat:
 			ret = append(ret, parseLit(toks, AstNodeKindLit, func(src string) (float64, error) {
 				return str.ToF(src, 64)
@@ -120,6 +142,13 @@ func (me *SrcFile) parseNodes(toks Toks) (ret AstNodes) {
 				node.Src = node.Toks.src(me.Src.Text)
 				if len(toks_inner) > 0 {
 					split_by_comma, is_curly, is_square := toks_inner.split(','), node.IsCurlyBraces(), node.IsSquareBrackets()
+					if is_curly { // multi-line braces can also separate their pairs by line breaks instead of commas
+						var split_by_line []Toks
+						for _, item_toks := range split_by_comma {
+							split_by_line = append(split_by_line, item_toks.splitPairLines()...)
+						}
+						split_by_comma = split_by_line
+					}
 					if (!is_curly) && (!is_square) && ((len(toks_inner) == 0) || (len(split_by_comma) == 1)) {
 						node.Nodes = me.parseNodes(toks_inner)
 					} else {
@@ -133,14 +162,21 @@ func (me *SrcFile) parseNodes(toks Toks) (ret AstNodes) {
 									errParsing: err_toks[util.If(is_curly, 0, len(err_toks)-1)].newErr(ErrCodeExpectedFoo, "expression before the superfluous comma")})
 							} else {
 								err_toks = item_toks[len(item_toks)-1:]
-								if !is_curly {
+								pair := util.If(is_curly, item_toks.split(':'), nil)
+								switch {
+								case (!is_curly) || ((len(pair) == 1) && (len(pair[0]) == len(item_toks))):
 									node.Nodes = append(node.Nodes, me.parseNode(item_toks))
-								} else if pair := item_toks.split(':'); (len(pair) != 2) || (len(pair[0]) == 0) || (len(pair[1]) == 0) {
+								case (len(pair) == 1) && (len(pair[0]) == 1) && (pair[0][0].Kind == TokKindIdentWord):
+									// the `{ foo: }` shorthand for `{ foo: foo }`, same as `{ foo }`
+									node.Nodes = append(node.Nodes, me.parseNode(pair[0]))
+								case (len(pair) != 2) || (len(pair[0]) == 0) || (len(pair[1]) == 0):
 									node.Nodes = append(node.Nodes, &AstNode{Kind: AstNodeKindErr, Toks: err_toks, Src: err_toks.src(me.Src.Text),
 										errParsing: err_toks[0].newErr(ErrCodeExpectedFoo, "expression pair separated by `:`")})
-								} else {
+								default:
 									node_key, node_val := me.parseNode(pair[0]), me.parseNode(pair[1])
-									node.Nodes = append(node.Nodes, AstNodes{node_key, node_val}.toGroupNode(me, node, true, true))
+									node_pair := AstNodes{node_key, node_val}.toGroupNode(me, node, false, true)
+									node_pair.Lit = byte(':')
+									node.Nodes = append(node.Nodes, node_pair)
 								}
 							}
 						}
@@ -182,6 +218,52 @@ func parseLit[T cmp.Ordered](toks Toks, kind AstNodeKind, parseFunc func(string)
 	return &AstNode{Kind: kind, Toks: toks[:1], Src: tok.Src, Lit: lit}
 }
 
+func unquote(src string) (string, error) {
+	if src[0] == '"' { // unlike in Go, line breaks are allowed in double-quoted string literals
+		src = strings.ReplaceAll(src, "\n", "\\n")
+	}
+	return strconv.Unquote(src)
+}
+
+// splits the string literal `node` into its `Nodes`: an `AstNodeKindLit` for each literal fragment, and an
+// `AstNodeKindGroup` for each of its `embeds` (parsed from its `toks`, as lexed by `Tok.strInterpToks`)
+func (me *SrcFile) parseStrInterp(node *AstNode, embeds [][2]int, toks Toks) {
+	tok := node.Toks[0]
+	sub_tok := func(from int, until int) *Tok {
+		return &Tok{Kind: TokKindLitStr, byteOffset: tok.byteOffset + from, Pos: tok.posAt(from), Src: tok.Src[from:until]}
+	}
+	frag := func(from int, until int) {
+		if from < until {
+			frag_tok := sub_tok(from, until)
+			lit, err := unquote(tok.Src[:1] + frag_tok.Src + tok.Src[:1])
+			if err != nil {
+				node.Nodes = append(node.Nodes, &AstNode{Kind: AstNodeKindErr, Toks: Toks{frag_tok}, Src: frag_tok.Src,
+					errParsing: errToDiag(err, ErrCodeLitWontParse, frag_tok.span())})
+			} else {
+				node.Nodes = append(node.Nodes, &AstNode{Kind: AstNodeKindLit, Toks: Toks{frag_tok}, Src: frag_tok.Src, Lit: lit})
+			}
+		}
+	}
+	from := 1
+	for _, embed := range embeds {
+		idx_dollar := strings.LastIndex(tok.Src[:embed[0]], "${")
+		frag(from, idx_dollar)
+		from = embed[1] + 1
+		embed_toks := sl.Where(toks, func(it *Tok) bool {
+			return (it.byteOffset >= (tok.byteOffset + embed[0])) && (it.byteOffset < (tok.byteOffset + embed[1]))
+		})
+		if len(embed_toks) > 0 {
+			node.Nodes = append(node.Nodes, &AstNode{Kind: AstNodeKindGroup, Toks: embed_toks, Src: embed_toks.src(me.Src.Text),
+				Nodes: me.parseNodes(embed_toks)})
+		} else if embed[0] == embed[1] { // else, not lexed due to errs already reported by `Tok.strInterpToks`
+			err_tok := sub_tok(idx_dollar, from)
+			node.Nodes = append(node.Nodes, &AstNode{Kind: AstNodeKindErr, Toks: Toks{err_tok}, Src: err_tok.Src,
+				errParsing: err_tok.newErr(ErrCodeExpectedFoo, "expression inside `${}`")})
+		}
+	}
+	frag(from, len(tok.Src)-1)
+}
+
 func (me *SrcFile) NodeAtPos(pos SrcFilePos, orAncestor bool) (ret *AstNode) {
 	for _, node := range me.Src.Ast {
 		if node.Toks.Span().Contains(&pos) {
@@ -286,6 +368,7 @@ func (me *AstNode) IsCurlyBraces() bool    { return me.IsBracketingWith('{') }
 func (me *AstNode) IsSquareBrackets() bool { return me.IsBracketingWith('[') }
 func (me *AstNode) IsParensCallish() bool  { return me.IsBracketingWith('(') }
 func (me *AstNode) IsParensTuplish() bool  { return me.IsBracketingWith(',') }
+func (me *AstNode) IsCurlyPair() bool      { return me.IsBracketingWith(':') }
 
 func (me *AstNode) IsIdentOpish() bool {
 	return (me.Kind == AstNodeKindIdent) && (me.Toks[0].Kind == TokKindIdentOpish)
@@ -432,12 +515,14 @@ func (me AstNodes) toks(srcFile *SrcFile) Toks {
 	}
 	node_first, node_last := me[0], me[len(me)-1]
 	tok_first, tok_last := node_first.Toks[0], node_last.Toks[len(node_last.Toks)-1]
-	idx_first := -1
-	for i, tok := range srcFile.Src.Toks {
-		if tok == tok_first {
+	idx_first, idx_from := -1, sort.Search(len(srcFile.Src.Toks), func(i int) bool {
+		return srcFile.Src.Toks[i].byteOffset >= tok_first.byteOffset // toks are sorted by byteOffset
+	})
+	for i := idx_from; i < len(srcFile.Src.Toks); i++ {
+		if tok := srcFile.Src.Toks[i]; tok == tok_first {
 			idx_first = i
 		}
-		if (tok == tok_last) && (idx_first >= 0) {
+		if (srcFile.Src.Toks[i] == tok_last) && (idx_first >= 0) {
 			return srcFile.Src.Toks[idx_first : i+1]
 		}
 	}
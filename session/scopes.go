@@ -0,0 +1,328 @@
+package session
+
+import (
+	"cmp"
+
+	"loon/session/ty"
+	"loon/util"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+// Decl is a name introduced by a `:=` declaration or by a func param (including loop-body params).
+type Decl struct {
+	Name    string
+	File    *SrcFile
+	Ident   *ExprIdent // the declaring occurrence, whose `Decl` is `me`
+	Expr    Expr       // the introducing `ExprAssign` or `ExprFunc`
+	Scope   *Scope
+	NumRefs int
+	Type    *ty.TypeScheme // as inferred by `SrcPack.typesRefresh`, nil for type decls
+	Struct  *Struct        // for struct type decls, as built by `SrcPack.structsRefresh`
+}
+
+func (me *Decl) IsTopLevel() bool { return me.Scope.Parent == nil }
+
+// IsUnused reports whether `me` is a non-top-level decl never referred to and without effects, such as an unused local
+// `x := 1`: reported as `Unused`, and discarded by code generation
+func (me *Decl) IsUnused() bool {
+	assign, _ := me.Expr.(*ExprAssign)
+	return (me.NumRefs == 0) && (!me.IsTopLevel()) && (assign != nil) && (assign.Lhs == Expr(me.Ident)) && ExprIsPure(assign.Rhs)
+}
+
+func (me *Decl) relLocs(hint string) []*SrcFileLocs {
+	return []*SrcFileLocs{{File: me.File, Spans: []*SrcFileSpan{util.Ptr(me.Ident.Toks.Span())}, Hints: []string{hint}}}
+}
+
+// Scope is either the top-level scope of a `SrcPack` (across all its files), or a func body's or indented block's.
+type Scope struct {
+	Parent *Scope
+	Decls  map[string]*Decl
+}
+
+func (me *Scope) sub() *Scope { return &Scope{Parent: me, Decls: map[string]*Decl{}} }
+
+func (me *Scope) Lookup(name string) *Decl {
+	for scope := me; scope != nil; scope = scope.Parent {
+		if decl := scope.Decls[name]; decl != nil {
+			return decl
+		}
+	}
+	return nil
+}
+
+// names usable without declaration: loon's primitive types and those globals of the
+// Lua standard library (that loon code targets) which aren't superseded by loon constructs
+var scopeBuiltins = []string{
+	"Bool", "Int", "Float", "Str",
+	"assert", "collectgarbage", "coroutine", "debug", "dofile", "error", "getmetatable", "io", "ipairs", "load",
+	"loadfile", "math", "next", "os", "package", "pairs", "pcall", "print", "rawequal", "rawget", "rawlen", "rawset",
+	"require", "select", "setmetatable", "string", "table", "tonumber", "tostring", "type", "utf8", "xpcall",
+}
+
+func IsBuiltinName(name string) bool { return sl.Has(scopeBuiltins, name) }
+
+type scopeResolver struct {
+	file   *SrcFile
+	diags  Diags
+	locals []*Decl // all non-top-level decls, for reporting those that are `Decl.IsUnused` once all are resolved
+}
+
+// only called by `SrcPack.treesRefresh`, right after `desugarRefresh`: resolves all
+// `ExprIdent`s of all `me.Files` against the pack-wide top-level `Scope` and their nested ones
+func (me *SrcPack) scopesRefresh() {
+	me.Trees.Scope = &Scope{Decls: map[string]*Decl{}}
+	resolvers := sl.To(me.filesWithExprs(), func(it *SrcFile) *scopeResolver { return &scopeResolver{file: it} })
+	// first, all top-level decls, so that all are usable anywhere in the pack regardless of their order
+	for _, r := range resolvers {
+		for _, expr := range r.file.Trees.Exprs {
+			if assign, _ := expr.(*ExprAssign); (assign != nil) && (assign.Op == exprOpDecl) {
+				if _, is_member := assign.Lhs.(*ExprMember); !is_member { // those are resolved (not declared) with the rest below
+					r.declare(me.Trees.Scope, assign.Lhs, assign)
+				}
+			}
+		}
+	}
+	// then, everything else
+	for _, r := range resolvers {
+		r.stmts(me.Trees.Scope, r.file.Trees.Exprs, false)
+		for _, decl := range r.locals {
+			if decl.IsUnused() {
+				r.diags.Add(decl.Expr.Base().Toks.newDiagHint(false, HintCodeUnused))
+			}
+		}
+		r.file.diags.TreesDiags.Add(r.diags...)
+	}
+}
+
+// those `me.Files` that have `Trees.Exprs`, sorted by path, except for the faux file coming last
+func (me *SrcPack) filesWithExprs() []*SrcFile {
+	return sl.SortedPer(sl.Where(me.Files, func(it *SrcFile) bool { return it.Trees.Exprs != nil }), func(file1 *SrcFile, file2 *SrcFile) int {
+		if file1.IsFauxFile() != file2.IsFauxFile() { // the faux file's decls come last, so that they're the DuplTopDecls
+			return util.If(file1.IsFauxFile(), 1, -1)
+		}
+		return cmp.Compare(file1.FilePath, file2.FilePath)
+	})
+}
+
+// `lastIsValue` is whether the last of `stmts` is the value of the func body or block they belong to
+func (me *scopeResolver) stmts(scope *Scope, stmts Exprs, lastIsValue bool) {
+	for i, stmt := range stmts {
+		if _, is_ret := stmt.(*ExprReturn); is_ret && (i < len(stmts)-1) {
+			unreachable := stmts[i+1:]
+			span := unreachable[0].Base().Toks.Span()
+			me.diags.Add(span.Expanded(util.Ptr(unreachable[len(unreachable)-1].Base().Toks.Span())).newDiagHint(HintCodeUnused))
+			me.stmt(scope, stmt, false)
+			break
+		}
+		me.stmt(scope, stmt, lastIsValue && (i == len(stmts)-1))
+	}
+}
+
+func (me *scopeResolver) stmt(scope *Scope, stmt Expr, isValue bool) {
+	is_repl_output := (scope.Parent == nil) && (me.file.IsFauxFile() || me.file.IsNotebook())
+	if (stmt != nil) && (!isValue) && (!is_repl_output) && ExprIsPure(stmt) {
+		me.diags.Add(stmt.Base().Toks.newDiagHint(false, HintCodeUnused))
+	}
+	switch it := stmt.(type) {
+	case *ExprBlock: // a stand-alone scoped block
+		me.stmts(scope.sub(), it.Stmts, isValue)
+	default:
+		me.expr(scope, stmt)
+	}
+}
+
+func (me *scopeResolver) expr(scope *Scope, expr Expr) {
+	switch it := expr.(type) {
+	case nil:
+	case *ExprIdent:
+		if it.Decl = scope.Lookup(it.Name); it.Decl != nil {
+			it.Decl.NumRefs++
+		} else if (!str.Begins(it.Name, "_")) && !IsBuiltinName(it.Name) {
+			me.diags.Add(it.Toks.newDiagErr(false, ErrCodeNotDefined, it.Name))
+		}
+	case *ExprAssign:
+		switch {
+		case (it.Op == exprOpDecl) && (scope.Parent == nil): // already declared by `scopesRefresh`, other than `Foo.bar := ...` methods
+			if _, is_member := it.Lhs.(*ExprMember); is_member {
+				me.expr(scope, it.Lhs)
+			}
+			me.expr(scope, it.Rhs)
+		case it.Op == exprOpDecl:
+			if _, is_func := it.Rhs.(*ExprFunc); is_func { // so that local funcs can recurse
+				me.declare(scope, it.Lhs, it)
+				me.expr(scope, it.Rhs)
+			} else {
+				me.expr(scope, it.Rhs)
+				me.declare(scope, it.Lhs, it)
+			}
+		default:
+			ExprWalk(it.Lhs, func(lhs Expr) bool {
+				if ident, _ := lhs.(*ExprIdent); (ident != nil) && str.Begins(ident.Name, "_") {
+					me.diags.Add(ident.Toks.newDiagErr(false, ErrCodeReserved, ident.Name, "_"))
+				}
+				return true
+			})
+			me.expr(scope, it.Lhs)
+			me.expr(scope, it.Rhs)
+		}
+	case *ExprFunc:
+		for _, param_type := range it.ParamTypes {
+			me.expr(scope, param_type)
+		}
+		scope = scope.sub()
+		for i, param := range it.Params { // a param's default can refer to the params before it
+			me.expr(scope, it.ParamDefaults[i])
+			me.declare(scope, param, it)
+		}
+		me.stmts(scope, it.Body, true)
+	case *ExprBlock:
+		me.stmts(scope.sub(), it.Stmts, true)
+	case *ExprSwitch:
+		me.expr(scope, it.Subj)
+		for _, case_ := range it.Cases {
+			scope_case := scope.sub()
+			for _, cond := range case_.Conds {
+				me.switchCond(scope_case, cond, it)
+			}
+			me.expr(scope_case, case_.Body)
+		}
+	default:
+		ExprWalk(expr, func(sub Expr) bool {
+			if sub != expr {
+				me.expr(scope, sub)
+			}
+			return (sub == expr)
+		})
+	}
+}
+
+// declares in `scope` the name(s) in `lhs` (the left-hand side of a `:=`, or a func param) introduced by `expr`
+func (me *scopeResolver) declare(scope *Scope, lhs Expr, expr Expr) {
+	switch it := lhs.(type) {
+	case *ExprIdent:
+		fn, _ := expr.(*ExprFunc)
+		is_desugared := (fn != nil) && fn.IsDesugared // its `__a0__`-like params may shadow those of enclosing ones
+		switch existing := scope.Lookup(it.Name); {
+		case it.Name == "_": // discard
+		case str.Begins(it.Name, "_") && !is_desugared:
+			me.diags.Add(it.Toks.newDiagErr(false, ErrCodeReserved, it.Name, "_"))
+		case (existing != nil) && existing.IsTopLevel() && (scope.Parent == nil):
+			diag := it.Toks.newDiagErr(false, ErrCodeDuplTopDecl, it.Name)
+			diag.Rel = existing.relLocs("already declared here")
+			me.diags.Add(diag)
+		case (existing != nil) && !is_desugared:
+			diag := it.Toks.newDiagErr(false, ErrCodeShadowing, it.Name)
+			diag.Rel = existing.relLocs("already declared here")
+			me.diags.Add(diag)
+		default:
+			it.Decl = &Decl{Name: it.Name, File: me.file, Ident: it, Expr: expr, Scope: scope}
+			scope.Decls[it.Name] = it.Decl
+			if scope.Parent != nil {
+				me.locals = append(me.locals, it.Decl)
+			}
+		}
+	case *ExprTuple:
+		for _, item := range it.Items {
+			me.declare(scope, item, expr)
+		}
+	case *ExprArr:
+		for _, item := range it.Items {
+			me.declare(scope, item, expr)
+		}
+	case *ExprSpread:
+		me.declare(scope, it.Subj, expr)
+	case *ExprDict:
+		for _, entry := range it.Entries {
+			me.declare(scope, entry.Val, expr)
+		}
+	default: // such as `Foo.bar := ...` method decls, or non-patterns already reported by `SrcFile.exprStmt`
+		me.expr(scope, lhs)
+	}
+}
+
+// resolves the `cond` of a case of `expr`, declaring in `scope` (that of the case) the names binding (parts of) the
+// scrutinee: the `_foo` of catch-alls and those in destructuring patterns, and (only for the guard itself) `_`
+func (me *scopeResolver) switchCond(scope *Scope, cond Expr, expr *ExprSwitch) {
+	switch ExprSwitchCondKindOf(cond) {
+	case ExprSwitchCondCatchAll:
+		if ident := cond.(*ExprIdent); ident.Name != "_" {
+			me.declareBinding(scope, ident, expr)
+		}
+	case ExprSwitchCondPattern:
+		me.switchPattern(scope, cond, expr)
+	case ExprSwitchCondGuard:
+		scope_guard := scope.sub()
+		ExprWalk(cond, func(it Expr) bool {
+			if ident, _ := it.(*ExprIdent); (ident != nil) && (ident.Name == "_") && (scope_guard.Decls["_"] == nil) {
+				me.declareBinding(scope_guard, ident, expr)
+			}
+			return true
+		})
+		me.expr(scope_guard, cond)
+	default:
+		me.expr(scope, cond)
+	}
+}
+
+// resolves the values (to compare to) in the destructuring `pattern` of a case of `expr`, and declares the
+// `_foo` names in it
+func (me *scopeResolver) switchPattern(scope *Scope, pattern Expr, expr *ExprSwitch) {
+	switch it := pattern.(type) {
+	case *ExprArr:
+		for _, item := range it.Items {
+			me.switchPattern(scope, item, expr)
+		}
+	case *ExprTuple:
+		for _, item := range it.Items {
+			me.switchPattern(scope, item, expr)
+		}
+	case *ExprSpread:
+		me.switchPattern(scope, it.Subj, expr)
+	case *ExprDict:
+		for _, entry := range it.Entries {
+			me.expr(scope, entry.Key)
+			me.switchPattern(scope, entry.Val, expr)
+		}
+	case *ExprIdent:
+		if it.Name == "_" {
+			break
+		} else if str.Begins(it.Name, "_") {
+			me.declareBinding(scope, it, expr)
+		} else {
+			me.expr(scope, it)
+		}
+	default:
+		me.expr(scope, pattern)
+	}
+}
+
+// declares in `scope` the `_`-prefixed `ident` binding (parts of) the scrutinee of `expr`. Unlike `declare`, allows
+// such names, as these are not assigned to but bound
+func (me *scopeResolver) declareBinding(scope *Scope, ident *ExprIdent, expr *ExprSwitch) {
+	if existing := scope.Decls[ident.Name]; existing != nil {
+		ident.Decl = existing
+		existing.NumRefs++
+		return
+	}
+	ident.Decl = &Decl{Name: ident.Name, File: me.file, Ident: ident, Expr: expr, Scope: scope}
+	scope.Decls[ident.Name] = ident.Decl
+}
+
+// ExprIsPure reports whether `expr` has no effects other than producing its value,
+// so that, as a statement not in a value position, it can be discarded.
+func ExprIsPure(expr Expr) (ret bool) {
+	ret = true
+	ExprWalk(expr, func(it Expr) bool {
+		switch it := it.(type) {
+		case *ExprFunc:
+			return false // declaring a func has no effects, calling it may
+		case *ExprCall, *ExprNilSafeCall, *ExprAssign, *ExprLoop, *ExprCond, *ExprSwitch, *ExprBlock, *ExprReturn, *ExprContinue:
+			ret = false
+		case *ExprOpUnary:
+			ret = (it.Op != exprOpErr) // failing with an error returns from the enclosing func
+		}
+		return ret
+	})
+	return
+}
@@ -42,7 +42,7 @@ func Access(do func(sess StateAccess, intel Intel)) {
 type stateAccess struct{ sync.Mutex }
 
 func (*stateAccess) OnSrcFileEdit(srcFilePath string, curFullContent string) {
-	refreshAndPublishDiags(false, ensureSrcFiles(&curFullContent, true, srcFilePath)...)
+	refreshAndPublishDiags(false, sl.With(ensureSrcFiles(&curFullContent, true, srcFilePath), srcFilePath)...)
 }
 
 func (*stateAccess) OnSrcFileEvents(removed []string, canSkipFileRead bool, current ...string) {
@@ -13,7 +13,9 @@ type SrcPack struct {
 	DirPath string
 	Files   []*SrcFile
 	Trees   struct {
-		last struct {
+		Scope   *Scope    // the pack-wide top-level scope
+		Structs []*Struct // all struct type decls across all `Files`, in order
+		last    struct {
 			files map[string]string
 		}
 	} `json:"-"`
@@ -28,9 +30,14 @@ type SrcFile struct {
 		Ast          AstNodes
 		everOnceRead bool
 	} `json:"-"`
-	diags struct {
+	Trees struct {
+		Exprs Exprs
+	} `json:"-"`
+	Notebook *SrcNotebook `json:"-"` // only for `.lsrepl` files
+	diags    struct {
 		LastReadErr *Diag
 		LexErrs     Diags
+		TreesDiags  Diags
 	}
 }
 
@@ -38,10 +45,13 @@ func (me *SrcFile) IsFauxFile() bool { return IsSrcFilePathOfFauxFile(me.FilePat
 func IsSrcFilePathOfFauxFile(srcFilePath string) bool {
 	return (filepath.Base(srcFilePath) == "<loonfaux>")
 }
-func newFauxFilePath(dirPath string) string { return filepath.Join(dirPath, "<loonfaux>") }
+
+// FauxFilePath returns the path of the `SrcPack` at `dirPath`'s faux file: it has no file-system
+// counterpart and is only ever edited via `StateAccess.OnSrcFileEdit`, eg. by a REPL session.
+func FauxFilePath(dirPath string) string { return filepath.Join(dirPath, "<loonfaux>") }
 
 func IsSrcFilePath(filePath string) bool {
-	return filepath.IsAbs(filePath) && filepath.Ext(filePath) == ".ls" &&
+	return filepath.IsAbs(filePath) && ((filepath.Ext(filePath) == ".ls") || IsSrcFilePathOfNotebook(filePath)) &&
 		(!strings.Contains(filePath, string(filepath.Separator)+".")) && (!util.FsIsDir(filePath))
 }
 
@@ -109,7 +119,6 @@ func ensureSrcFiles(curFullContent *string, canSkipFileRead bool, srcFilePaths .
 		flag_for_diags_refr := func() { encounteredDiagsRelevantChanges = sl.With(encounteredDiagsRelevantChanges, src_file_path) }
 
 		if (!is_faux_file) && !util.FsIsFile(src_file_path) {
-			// TODO for (future) .lsrepl Notebook files
 			removeSrcFiles(src_file_path)
 			flag_for_diags_refr()
 			continue
@@ -134,6 +143,7 @@ func ensureSrcFiles(curFullContent *string, canSkipFileRead bool, srcFilePaths .
 		old_content, had_last_read_err := src_file.Src.Text, (src_file.diags.LastReadErr != nil)
 		if curFullContent != nil {
 			src_file.Src.Text, src_file.diags.LastReadErr = *curFullContent, nil
+			src_file.notebookFromSrcText()
 		} else if (!is_faux_file) && ((!canSkipFileRead) || had_last_read_err || !src_file.Src.everOnceRead) {
 			src_file_bytes, err := os.ReadFile(src_file_path)
 			if os.IsNotExist(err) {
@@ -144,6 +154,7 @@ func ensureSrcFiles(curFullContent *string, canSkipFileRead bool, srcFilePaths .
 				src_file.Src.Text, src_file.diags.LastReadErr = string(src_file_bytes), errToDiag(err, ErrCodeFileReadError, src_file.Span())
 				if src_file.diags.LastReadErr == nil {
 					src_file.Src.everOnceRead = true
+					src_file.notebookFromSrcText()
 				}
 			}
 		}
@@ -158,7 +169,7 @@ func ensureSrcFiles(curFullContent *string, canSkipFileRead bool, srcFilePaths .
 			if src_file.diags.LastReadErr != nil {
 				flag_for_diags_refr()
 			} else {
-				src_file.Src.Toks, src_file.diags.LexErrs = tokenize(src_file.FilePath, src_file.Src.Text)
+				src_file.Src.Toks, src_file.diags.LexErrs = src_file.tokenize()
 				if len(src_file.diags.LexErrs) > 0 {
 					flag_for_diags_refr()
 				} else {
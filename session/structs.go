@@ -0,0 +1,275 @@
+package session
+
+import (
+	"loon/session/ty"
+	"loon/util"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+// StructMemberKind classifies the entries of struct type decls, and the out-of-line `Foo.bar := ...` method decls.
+type StructMemberKind int
+
+const (
+	StructMemberField  StructMemberKind = iota // an instance field, as in `age: Int` or `needsWalking: Bool = false`
+	StructMemberEmbed                          // an embedding, as in `_: Animal { domesticated: true }`
+	StructMemberMethod                         // an instance method: a func using the `.` instance
+	StructMemberStatic                         // any other value, such as a static method or a namespaced const
+)
+
+// Struct is the type record of a struct type decl such as `Person := { age: Int }`, as built by `SrcPack.structsRefresh`.
+type Struct struct {
+	Decl    *Decl
+	Type    *ty.TypeStruct
+	Members []*StructMember // in order of declaration, with the out-of-line ones last
+}
+
+type StructMember struct {
+	Kind   StructMemberKind
+	Name   string   // for `StructMemberEmbed`s, that of the embedded struct
+	Expr   Expr     // the `ExprDictEntry`, or for out-of-line methods, the `ExprAssign`
+	File   *SrcFile // that of `Expr`
+	Embeds *Struct  // for `StructMemberEmbed`s, nil if not resolving to a struct
+	Type   ty.Type  // as inferred by `SrcPack.typesRefresh`
+}
+
+// structConflict is a member `Want` of an interface that a candidate struct fails to implement: either
+// missing (with `Have` nil) or, in `Have`, with a type not accepted by that of `Want`
+type structConflict struct {
+	Want *StructMember
+	Have *StructMember
+}
+
+// StructOf returns the `Struct` (among those of `me`'s pack) of `t`, if it is a struct type as inferred by the last `SrcPack.typesRefresh`.
+func (me *SrcFile) StructOf(t ty.Type) *Struct {
+	if it, _ := t.(*ty.TypeStruct); (it != nil) && (me.pack != nil) {
+		return sl.FirstWhere(me.pack.Trees.Structs, func(s *Struct) bool { return s.Type == it })
+	}
+	return nil
+}
+
+// Member returns the member named `name`, if any: for `static` lookups (as in `Foo.bar`) only among the
+// `StructMemberStatic`s, else among all others. In both cases, including those promoted from embedded
+// structs, searched (after `me`'s own members) in order of embedding, depth-first.
+func (me *Struct) Member(name string, static bool) *StructMember {
+	return me.member(name, static, map[*Struct]bool{})
+}
+
+func (me *Struct) member(name string, static bool, seen map[*Struct]bool) *StructMember {
+	if seen[me] { // cyclic embeddings are reported by `structsRefresh`
+		return nil
+	}
+	seen[me] = true
+	for _, it := range me.Members {
+		if (it.Name == name) && ((it.Kind == StructMemberStatic) == static) {
+			return it
+		}
+	}
+	for _, it := range me.Members {
+		if (it.Kind == StructMemberEmbed) && (it.Embeds != nil) {
+			if found := it.Embeds.member(name, static, seen); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// IsInterface reports whether `me` acts as an interface, as in `Named := { name: () -> Str }`: that
+// is, whether it has instance fields, all of func type, and no embeddings.
+func (me *Struct) IsInterface() bool {
+	return sl.Any(me.Members, func(it *StructMember) bool { return it.Kind == StructMemberField }) &&
+		sl.All(me.Members, func(it *StructMember) bool {
+			if it.Kind == StructMemberField {
+				_, is_func := it.Expr.(*ExprDictEntry).Val.(*ExprFunc)
+				return is_func
+			}
+			return it.Kind != StructMemberEmbed
+		})
+}
+
+// Implements reports whether `me` is another struct than the interface `iface` (see `IsInterface`) that
+// structurally conforms to it, per the member types inferred by the last `typesRefresh`: that is, whether
+// for each of the func fields of `iface`, `me` has a (possibly promoted) method or func field of that name
+// and of a type accepted by that of the field.
+func (me *Struct) Implements(iface *Struct) bool {
+	if (me == iface) || !iface.IsInterface() {
+		return false
+	}
+	ti := ty.NewTypeInference()
+	structsConformance(ti, me.Decl.File.pack.Trees.Structs)
+	return len(me.conflicts(iface, ti)) == 0
+}
+
+// the members of `iface` that `me` fails to implement, in order
+func (me *Struct) conflicts(iface *Struct, ti *ty.TypeInference) (ret []structConflict) {
+	for _, want := range iface.Members {
+		if want.Kind != StructMemberField {
+			continue
+		}
+		have := me.Member(want.Name, false)
+		if (have != nil) && (have.Kind == StructMemberField) {
+			if _, is_func := ti.Resolved(have.Type).(*ty.TypeFun); !is_func {
+				have = nil
+			}
+		}
+		if (have == nil) || (have.Kind == StructMemberEmbed) {
+			ret = append(ret, structConflict{Want: want})
+		} else if (want.Type != nil) && (have.Type != nil) && !ti.Satisfies(&ty.TypeSubsumes{T1: want.Type, T2: have.Type}) {
+			ret = append(ret, structConflict{Want: want, Have: have})
+		}
+	}
+	return
+}
+
+// sets `ti.Implements` to accept, wherever an interface struct type is expected, any of `structs` conforming to it
+func structsConformance(ti *ty.TypeInference, structs []*Struct) {
+	by_type := map[*ty.TypeStruct]*Struct{}
+	for _, it := range structs {
+		by_type[it.Type] = it
+	}
+	checking := map[[2]*Struct]bool{}
+	ti.Implements = func(iface *ty.TypeStruct, impl *ty.TypeStruct) bool {
+		it_iface, it_impl := by_type[iface], by_type[impl]
+		if (it_iface == nil) || (it_impl == nil) || !it_iface.IsInterface() {
+			return false
+		}
+		key := [2]*Struct{it_iface, it_impl}
+		if checking[key] { // assumed to conform while being checked, for interfaces mentioning themselves in their methods
+			return true
+		}
+		checking[key] = true
+		defer delete(checking, key)
+		return len(it_impl.conflicts(it_iface, ti)) == 0
+	}
+}
+
+// only called by `SrcPack.treesRefresh`, right after `scopesRefresh`: builds the `Struct` of every struct
+// type decl in all `me.Files`, and reports any usages of the `.` instance outside of method contexts
+func (me *SrcPack) structsRefresh() {
+	files := me.filesWithExprs()
+	diags := map[*SrcFile]*Diags{}
+	for _, file := range files {
+		diags[file] = &Diags{}
+	}
+
+	var structs []*Struct
+	for _, file := range files {
+		for _, expr := range file.Trees.Exprs {
+			if assign, _ := expr.(*ExprAssign); (assign != nil) && (assign.Op == exprOpDecl) {
+				ident, _ := assign.Lhs.(*ExprIdent)
+				if dict, _ := assign.Rhs.(*ExprDict); (dict != nil) && (ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) && str.IsUp(ident.Name[:1]) &&
+					sl.All(dict.Entries, func(it *ExprDictEntry) bool { return it.Name != "" }) {
+					ident.Decl.Struct = &Struct{Decl: ident.Decl, Type: &ty.TypeStruct{Name: ident.Name}}
+					structs = append(structs, ident.Decl.Struct)
+				}
+			}
+		}
+	}
+	me.Trees.Structs = structs
+	// then their members, now that all embeddable structs are known
+	for _, it := range structs {
+		for _, entry := range it.Decl.Expr.(*ExprAssign).Rhs.(*ExprDict).Entries {
+			member := &StructMember{Name: entry.Name, Expr: entry, File: it.Decl.File}
+			switch {
+			case entry.Name == "_":
+				member.Kind = StructMemberEmbed
+				embedded := entry.Val
+				if call, _ := embedded.(*ExprCall); (call != nil) && call.IsUnary { // with field values, as in `_: Animal { domesticated: true }`
+					embedded = call.Callee
+				}
+				if ident, _ := embedded.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Struct != nil) {
+					member.Name, member.Embeds = ident.Name, ident.Decl.Struct
+					it.Type.Embeds = append(it.Type.Embeds, member.Embeds.Type)
+				} else if entry.Val != nil {
+					diags[it.Decl.File].Add(entry.Val.Base().Toks.newDiagErr(false, ErrCodeExpectedFoo, "an embedded struct type name"))
+				}
+			case ExprIsType(entry.Val):
+				member.Kind = StructMemberField
+			case exprUsesSelf(entry.Val, map[*Decl]bool{}):
+				member.Kind = StructMemberMethod
+			default:
+				member.Kind = StructMemberStatic
+			}
+			it.Members = append(it.Members, member)
+		}
+	}
+	for _, it := range structs {
+		for _, embed := range it.Members {
+			if (embed.Kind == StructMemberEmbed) && (embed.Embeds != nil) && embed.Embeds.Type.Embedding(it.Type) {
+				diags[it.Decl.File].Add(embed.Expr.Base().Toks.newDiagErr(false, ErrCodeTypeInfinite, it.Decl.Name+" = "+embed.Name))
+			}
+		}
+	}
+
+	for _, file := range files {
+		for _, expr := range file.Trees.Exprs {
+			// out-of-line methods, as in `Cat.isLikelyChallenging := () -> .lovesKeyboards`
+			if assign, _ := expr.(*ExprAssign); (assign != nil) && (assign.Op == exprOpDecl) {
+				if member, _ := assign.Lhs.(*ExprMember); member != nil {
+					if ident, _ := member.Subj.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Struct != nil) {
+						ident.Decl.Struct.Members = append(ident.Decl.Struct.Members, &StructMember{Name: member.Name, Expr: assign, File: file,
+							Kind: util.If(exprUsesSelf(assign.Rhs, map[*Decl]bool{}), StructMemberMethod, StructMemberStatic)})
+					}
+				}
+			}
+			// the `.` instance (also implicitly, via funcs using it) outside of any func
+			ExprWalk(expr, func(it Expr) bool {
+				switch it := it.(type) {
+				case *ExprFunc:
+					return false
+				case *ExprSelf:
+					diags[file].Add(it.Toks.newDiagErr(false, ErrCodeNotInMethod, "."))
+				case *ExprCall:
+					if ident, _ := it.Callee.(*ExprIdent); (ident != nil) && exprUsesSelf(ident, map[*Decl]bool{}) {
+						diags[file].Add(it.Toks.newDiagErr(false, ErrCodeNotInMethod, ident.Name+"()"))
+					}
+				}
+				return true
+			})
+		}
+		file.diags.TreesDiags.Add(*diags[file]...)
+	}
+}
+
+// whether `expr` uses the `.` instance: either directly, or by calling (or being) a func declared elsewhere that does
+func exprUsesSelf(expr Expr, seen map[*Decl]bool) (ret bool) {
+	ExprWalk(expr, func(it Expr) bool {
+		switch it := it.(type) {
+		case *ExprSelf:
+			ret = true
+		case *ExprIdent:
+			if decl := it.Decl; (decl != nil) && (decl.Ident != it) && (!seen[decl]) {
+				seen[decl] = true
+				if assign, _ := decl.Expr.(*ExprAssign); assign != nil {
+					if fn, _ := assign.Rhs.(*ExprFunc); (fn != nil) && (assign.Lhs == decl.Ident) {
+						ret = exprUsesSelf(fn, seen)
+					}
+				}
+			}
+		}
+		return !ret
+	})
+	return
+}
+
+// ExprIsType reports whether `expr` is a type expr, such as `Int`, `[Str]`, `{ Int, Str }`, `{ Str: Int }`, `(Int) -> Str` or `Int ?! Str`.
+func ExprIsType(expr Expr) bool {
+	switch it := expr.(type) {
+	case *ExprIdent:
+		return str.IsUp(it.Name[:1])
+	case *ExprArr:
+		return (len(it.Items) == 1) && ExprIsType(it.Items[0])
+	case *ExprTuple:
+		return (len(it.Items) > 0) && sl.All(it.Items, ExprIsType)
+	case *ExprDict:
+		return (len(it.Entries) > 0) && sl.All(it.Entries, func(entry *ExprDictEntry) bool {
+			return ((entry.Key == nil) || ExprIsType(entry.Key)) && ExprIsType(entry.Val)
+		})
+	case *ExprFunc:
+		return sl.All(it.Params, ExprIsType) && (len(it.Body) == 1) && ExprIsType(it.Body[0])
+	case *ExprErrUnion:
+		return ExprIsType(it.Subj) && ExprIsType(it.OnErr)
+	}
+	return false
+}
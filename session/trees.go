@@ -15,11 +15,19 @@ func (me *SrcPack) treesRefresh() (encounteredDiagsRelevantChanges bool) {
 	defer func(timeStarted time.Time) {
 		OnLogMsg(true, "treesRefresh: %s for %s", str.DurationMs(time.Since(timeStarted).Nanoseconds()), me.DirPath)
 	}(time.Now())
-	return
+
+	for _, src_file := range me.Files {
+		src_file.exprsRefresh()
+	}
+	me.desugarRefresh()
+	me.scopesRefresh()
+	me.structsRefresh()
+	me.typesRefresh()
+	return true
 }
 
 func (me *SrcPack) treesRefreshCanSkip() bool {
-	cur_paths := me.srcFilePaths()
+	cur_paths := sl.To(me.Files, func(it *SrcFile) string { return it.FilePath }) // unlike `srcFilePaths`, including the faux file
 	can_skip := (len(cur_paths) == len(me.Trees.last.files))
 	if can_skip {
 		cur_paths := cur_paths
@@ -36,7 +44,7 @@ func (me *SrcPack) treesRefreshCanSkip() bool {
 			}
 		}
 		for _, src_file := range me.Files {
-			if can_skip && (!src_file.IsFauxFile()) && (me.Trees.last.files[src_file.FilePath] != util.ContentHash(src_file.Src.Text)) {
+			if can_skip && (me.Trees.last.files[src_file.FilePath] != util.ContentHash(src_file.Src.Text)) {
 				can_skip = false
 				break
 			}
@@ -53,9 +61,7 @@ func (me *SrcPack) treesRefreshCanSkip() bool {
 	if !can_skip {
 		me.Trees.last.files = map[string]string{}
 		for _, src_file := range me.Files {
-			if !src_file.IsFauxFile() {
-				me.Trees.last.files[src_file.FilePath] = util.ContentHash(src_file.Src.Text)
-			}
+			me.Trees.last.files[src_file.FilePath] = util.ContentHash(src_file.Src.Text)
 		}
 	}
 	return can_skip
@@ -1,7 +1,22 @@
+// Package ty implements Hindley-Milner style type inference: the `Type` algebra of loon's
+// built-in types, `TypeEqual` constraints solved by unification (with occurs check) in a
+// `TypeInference`, and let-polymorphism via `TypeScheme`s. The session's checker generates
+// the constraints from loon's own AST, while `Infer` does the same for the tiny lambda
+// calculus of `Expr` below, which is the reference for (and test bed of) the algorithm.
 package ty
 
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
 type Expr interface{ isExpr() }
-type Type interface{ isType() }
+type Type interface {
+	isType()
+	String() string
+}
 
 type ExprInt int
 
@@ -32,31 +47,718 @@ type ExprVarTyped struct {
 
 func (*ExprVarTyped) isExpr() {}
 
+// let Var = Val in Body
+type ExprLet struct {
+	Var  ExprVar
+	Val  Expr
+	Body Expr
+}
+
+func (*ExprLet) isExpr() {}
+
+type TypeBool struct{}
+
+func (TypeBool) isType()        {}
+func (TypeBool) String() string { return "Bool" }
+
 type TypeInt struct{}
 
-func (TypeInt) isType() {}
+func (TypeInt) isType()        {}
+func (TypeInt) String() string { return "Int" }
+
+type TypeFloat struct{}
+
+func (TypeFloat) isType()        {}
+func (TypeFloat) String() string { return "Float" }
+
+type TypeStr struct{}
+
+func (TypeStr) isType()        {}
+func (TypeStr) String() string { return "Str" }
+
+// the type of `nil`, and so also of statements and of funcs not returning anything
+type TypeNil struct{}
+
+func (TypeNil) isType()        {}
+func (TypeNil) String() string { return "nil" }
+
+// [Item]
+type TypeArr struct {
+	Item Type
+}
+
+func (*TypeArr) isType()           {}
+func (me *TypeArr) String() string { return "[" + me.Item.String() + "]" }
+
+// { Item0, ..., ItemN }
+type TypeTuple struct {
+	Items []Type
+}
+
+func (*TypeTuple) isType() {}
+func (me *TypeTuple) String() string {
+	if len(me.Items) == 0 {
+		return "{}"
+	}
+	return "{ " + typesString(me.Items) + " }"
+}
+
+// { Key: Val }
+type TypeDict struct {
+	Key Type
+	Val Type
+}
+
+func (*TypeDict) isType()           {}
+func (me *TypeDict) String() string { return "{ " + me.Key.String() + ": " + me.Val.String() + " }" }
 
+// (Param0, ..., ParamN) -> Ret
 type TypeFun struct {
-	Param Type
-	Ret   Type
+	Params []Type
+	Ret    Type
 }
 
-func (*TypeFun) isType() {}
+func (*TypeFun) isType()           {}
+func (me *TypeFun) String() string { return "(" + typesString(me.Params) + ") -> " + me.Ret.String() }
+
+// a nominal struct type, as declared by `Name := { ... }`: the same type only as the very same `*TypeStruct`, but
+// also usable wherever any of its `Embeds` (transitively) is expected. Its fields are tracked by the declaring session.
+type TypeStruct struct {
+	Name   string
+	Embeds []*TypeStruct
+}
+
+func (*TypeStruct) isType()           {}
+func (me *TypeStruct) String() string { return me.Name }
+
+// Embedding reports whether `me` is or (transitively) embeds `other`.
+func (me *TypeStruct) Embedding(other *TypeStruct) bool {
+	return me.embedding(other, map[*TypeStruct]bool{})
+}
+
+func (me *TypeStruct) embedding(other *TypeStruct, seen map[*TypeStruct]bool) bool {
+	if me == other {
+		return true
+	} else if seen[me] { // cyclic embeddings are reported by the session
+		return false
+	}
+	seen[me] = true
+	for _, embed := range me.Embeds {
+		if embed.embedding(other, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Type0 | ... | TypeN, as constructed by `TypeInference.Union`: never nested, never just one member type, no duplicates
+type TypeUnion struct {
+	Types []Type
+}
+
+func (*TypeUnion) isType() {}
+func (me *TypeUnion) String() string {
+	strs := make([]string, len(me.Types))
+	for i, it := range me.Types {
+		strs[i] = it.String()
+	}
+	return strings.Join(strs, " | ")
+}
+
+// Val ?! Err: the result of a func that either succeeds with a `Val` or fails with an `Err`
+type TypeErrUnion struct {
+	Val Type
+	Err Type
+}
+
+func (*TypeErrUnion) isType()           {}
+func (me *TypeErrUnion) String() string { return me.Val.String() + " ?! " + me.Err.String() }
 
 type TypeVar string
 
-func (TypeVar) isType() {}
+func (TypeVar) isType()           {}
+func (me TypeVar) String() string { return string(me) }
+
+// TypeScheme is the type of a let-bound (and so possibly polymorphic) name: `Type` with all of
+// `Vars` universally quantified, that is, instantiated afresh (by `TypeInference.Instantiate`) on every use.
+type TypeScheme struct {
+	Vars []TypeVar
+	Type Type
+}
+
+func (me *TypeScheme) String() string { return me.Type.String() }
+
+func typesString(types []Type) string {
+	strs := make([]string, len(types))
+	for i, it := range types {
+		strs[i] = it.String()
+	}
+	return strings.Join(strs, ", ")
+}
 
 type TypeInference struct {
 	unificationTable map[TypeVar]Type
+	levels           map[TypeVar]int    // the `level` at which each unbound `TypeVar` was created, lowered on unification
+	restrictions     map[TypeVar][]Type // see `Restrict`
+	numVars          int
+
+	// the current let-nesting depth: `EnterLevel` right before inferring a generalizable let-bound value and
+	// `LeaveLevel` right after, and `Generalize` will quantify all type vars created (and still unbound) in between
+	level int
+
+	// if set, consulted by `TypeSubsumes` checks wherever a `*TypeStruct` is expected but another one not embedding
+	// it is given: whether `impl` structurally conforms to (the interface) `iface` all the same
+	Implements func(iface *TypeStruct, impl *TypeStruct) bool
+}
+
+func NewTypeInference() *TypeInference {
+	return &TypeInference{unificationTable: map[TypeVar]Type{}, levels: map[TypeVar]int{}, restrictions: map[TypeVar][]Type{}}
 }
 
-type Constraint interface{ isConstraint() }
+func (me *TypeInference) EnterLevel() { me.level++ }
+func (me *TypeInference) LeaveLevel() { me.level-- }
 
+func (me *TypeInference) NewTypeVar() TypeVar {
+	me.numVars++
+	ret := TypeVar("T" + strconv.Itoa(me.numVars))
+	me.levels[ret] = me.level
+	return ret
+}
+
+// Restrict constrains `tv` (and all type vars it gets unified with, or instantiated from, see `Instantiate`)
+// to ever be bound only to one of `types` (or a union of only such), as for the operands of arithmetic operators.
+func (me *TypeInference) Restrict(tv TypeVar, types ...Type) {
+	if existing := me.restrictions[tv]; existing != nil {
+		types = restricted(existing, types)
+	}
+	me.restrictions[tv] = types
+}
+
+// Restriction returns the types that `t`, if an unbound type var, may still be bound to (see `Restrict`), else nil:
+// those allowed for all the type vars bound to it, so that unbinding any of them (as on failed `Solve`s) also lifts theirs.
+func (me *TypeInference) Restriction(t Type) (ret []Type) {
+	tv, is := me.shallow(t).(TypeVar)
+	if !is {
+		return nil
+	}
+	for _, it := range slices.Sorted(maps.Keys(me.restrictions)) { // sorted for a deterministic order of `ret`
+		if types := me.restrictions[it]; (me.shallow(it) == tv) && (ret == nil) {
+			ret = types
+		} else if me.shallow(it) == tv {
+			ret = restricted(ret, types)
+		}
+	}
+	return
+}
+
+// those of `types` also in `allowed`
+func restricted(types []Type, allowed []Type) []Type {
+	ret := []Type{}
+	for _, it := range types {
+		if slices.Contains(allowed, it) {
+			ret = append(ret, it)
+		}
+	}
+	return ret
+}
+
+// Constraint is either a `TypeEqual` or a `TypeSubsumes`. In errors, `T1` is reported as the expected type.
+type Constraint interface {
+	constrained() (nodeId int, t1 Type, t2 Type)
+}
+
+// TypeEqual constrains `T1` and `T2` to be the same type.
 type TypeEqual struct {
 	NodeId int
 	T1     Type
 	T2     Type
 }
 
-func (*TypeEqual) isConstraint() {}
+func (me *TypeEqual) constrained() (int, Type, Type) { return me.NodeId, me.T1, me.T2 }
+
+// TypeSubsumes constrains `T2` to be usable wherever `T1` is expected: like `TypeEqual`, except that a
+// `TypeUnion` `T1` also accepts any of its members (or unions of some of them), and a `TypeStruct` `T1` also any
+// struct embedding it (or, per `TypeInference.Implements`, conforming to it), a `TypeErrUnion` `T1` also its `Val`,
+// and a `TypeFun` `T1` also funcs taking less specific params and returning more specific results, also inside
+// arrays, tuples and dicts.
+type TypeSubsumes struct {
+	NodeId int
+	T1     Type
+	T2     Type
+}
+
+func (me *TypeSubsumes) constrained() (int, Type, Type) { return me.NodeId, me.T1, me.T2 }
+
+// ErrMismatch is returned by `TypeInference.Solve` for a `Constraint` not satisfied.
+type ErrMismatch struct {
+	NodeId   int
+	Expected Type // the fully-resolved `T1` of the `Constraint`, or the types allowed by a violated `Restrict`ion
+	Actual   Type // the fully-resolved `T2` of the `Constraint`, or the type violating a `Restrict`ion
+
+	ofRestriction bool
+}
+
+func (me *ErrMismatch) Error() string {
+	return "expected " + me.Expected.String() + " instead of " + me.Actual.String()
+}
+
+// ErrInfinite is returned by `TypeInference.Solve` for a `Constraint` that would make `Var` a part of its own `Type`.
+type ErrInfinite struct {
+	NodeId int
+	Var    TypeVar
+	Type   Type
+}
+
+func (me *ErrInfinite) Error() string {
+	return "infinite type detected: `" + me.Var.String() + " = " + me.Type.String() + "`"
+}
+
+// Solve unifies the types of each of `constraints` in turn, returning an `*ErrMismatch` or `*ErrInfinite`
+// for every one failing to. A failed constraint leaves no partial unifications behind.
+func (me *TypeInference) Solve(constraints ...Constraint) (errs []error) {
+	for _, constraint := range constraints {
+		node_id, t1, t2 := constraint.constrained()
+		var trail []TypeVar
+		if err := me.solve1(constraint, &trail); err != nil {
+			me.undo(&trail, 0)
+			if infinite, _ := err.(*ErrInfinite); infinite != nil {
+				infinite.NodeId = node_id
+			} else if mismatch, _ := err.(*ErrMismatch); (mismatch != nil) && mismatch.ofRestriction {
+				mismatch.NodeId = node_id
+			} else {
+				err = &ErrMismatch{NodeId: node_id, Expected: me.Resolved(t1), Actual: me.Resolved(t2)}
+			}
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// Satisfies reports whether `constraint` holds (or can be made to by unification), without actually unifying anything.
+func (me *TypeInference) Satisfies(constraint Constraint) bool {
+	var trail []TypeVar
+	err := me.solve1(constraint, &trail)
+	me.undo(&trail, 0)
+	return err == nil
+}
+
+// Unifies reports whether `t1` and `t2` can be unified, without actually unifying them.
+func (me *TypeInference) Unifies(t1 Type, t2 Type) bool {
+	return me.Satisfies(&TypeEqual{T1: t1, T2: t2})
+}
+
+func (me *TypeInference) solve1(constraint Constraint, trail *[]TypeVar) error {
+	_, t1, t2 := constraint.constrained()
+	if _, is_subsumes := constraint.(*TypeSubsumes); is_subsumes {
+		return me.subsume(t1, t2, trail)
+	}
+	return me.unify(t1, t2, trail)
+}
+
+// unbinds all type vars bound since `trail` had length `from`
+func (me *TypeInference) undo(trail *[]TypeVar, from int) {
+	for _, tv := range (*trail)[from:] {
+		delete(me.unificationTable, tv)
+	}
+	*trail = (*trail)[:from]
+}
+
+// whether `unify` (or `subsume`) succeeds, in which case its bindings remain in effect, else they're undone
+func (me *TypeInference) try(trail *[]TypeVar, unify func() error) bool {
+	from := len(*trail)
+	if err := unify(); err != nil {
+		me.undo(trail, from)
+		return false
+	}
+	return true
+}
+
+// records in `trail` all newly bound type vars, so that the caller can undo them on failure
+func (me *TypeInference) unify(t1 Type, t2 Type, trail *[]TypeVar) error {
+	t1, t2 = me.shallow(t1), me.shallow(t2)
+	if tv1, is := t1.(TypeVar); is {
+		if tv2, is := t2.(TypeVar); is && (tv1 == tv2) {
+			return nil
+		}
+		return me.bind(tv1, t2, trail)
+	} else if tv2, is := t2.(TypeVar); is {
+		return me.bind(tv2, t1, trail)
+	}
+
+	mismatch := &ErrMismatch{Expected: t1, Actual: t2}
+	switch it1 := t1.(type) {
+	case TypeBool, TypeInt, TypeFloat, TypeStr, TypeNil, *TypeStruct:
+		if t1 != t2 {
+			return mismatch
+		}
+	case *TypeUnion: // same members, in any order
+		it2, is := t2.(*TypeUnion)
+		if (!is) || (len(it1.Types) != len(it2.Types)) {
+			return mismatch
+		}
+		matched := make([]bool, len(it2.Types))
+		for _, member1 := range it1.Types {
+			idx := -1
+			for i, member2 := range it2.Types {
+				if (!matched[i]) && me.try(trail, func() error { return me.unify(member1, member2, trail) }) {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				return mismatch
+			}
+			matched[idx] = true
+		}
+	case *TypeArr:
+		it2, is := t2.(*TypeArr)
+		if !is {
+			return mismatch
+		}
+		return me.unify(it1.Item, it2.Item, trail)
+	case *TypeTuple:
+		it2, is := t2.(*TypeTuple)
+		if (!is) || (len(it1.Items) != len(it2.Items)) {
+			return mismatch
+		}
+		return me.unifyEach(it1.Items, it2.Items, trail)
+	case *TypeDict:
+		it2, is := t2.(*TypeDict)
+		if !is {
+			return mismatch
+		}
+		return me.unifyEach([]Type{it1.Key, it1.Val}, []Type{it2.Key, it2.Val}, trail)
+	case *TypeFun:
+		it2, is := t2.(*TypeFun)
+		if (!is) || (len(it1.Params) != len(it2.Params)) {
+			return mismatch
+		}
+		return me.unifyEach(append([]Type{it1.Ret}, it1.Params...), append([]Type{it2.Ret}, it2.Params...), trail)
+	case *TypeErrUnion:
+		it2, is := t2.(*TypeErrUnion)
+		if !is {
+			return mismatch
+		}
+		return me.unifyEach([]Type{it1.Val, it1.Err}, []Type{it2.Val, it2.Err}, trail)
+	default:
+		panic(t1)
+	}
+	return nil
+}
+
+// like `unify`, but `t2` need only be usable wherever `t1` is expected, see `TypeSubsumes`
+func (me *TypeInference) subsume(t1 Type, t2 Type, trail *[]TypeVar) error {
+	t1, t2 = me.shallow(t1), me.shallow(t2)
+	_, is_var1 := t1.(TypeVar)
+	_, is_var2 := t2.(TypeVar)
+	if is_var1 || is_var2 {
+		return me.unify(t1, t2, trail)
+	}
+	mismatch := &ErrMismatch{Expected: t1, Actual: t2}
+	if union2, is := t2.(*TypeUnion); is {
+		for _, member := range union2.Types {
+			if err := me.subsume(t1, member, trail); err != nil {
+				return mismatch
+			}
+		}
+		return nil
+	} else if union1, is := t1.(*TypeUnion); is {
+		for _, member := range union1.Types {
+			if me.try(trail, func() error { return me.subsume(member, t2, trail) }) {
+				return nil
+			}
+		}
+		return mismatch
+	}
+
+	switch it1 := t1.(type) {
+	case *TypeArr:
+		if it2, is := t2.(*TypeArr); is {
+			return me.subsume(it1.Item, it2.Item, trail)
+		}
+	case *TypeTuple:
+		if it2, is := t2.(*TypeTuple); is && (len(it1.Items) == len(it2.Items)) {
+			for i := range it1.Items {
+				if err := me.subsume(it1.Items[i], it2.Items[i], trail); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case *TypeDict:
+		if it2, is := t2.(*TypeDict); is {
+			if err := me.subsume(it1.Key, it2.Key, trail); err != nil {
+				return err
+			}
+			return me.subsume(it1.Val, it2.Val, trail)
+		}
+	case *TypeFun:
+		if it2, is := t2.(*TypeFun); is && (len(it1.Params) == len(it2.Params)) {
+			for i := range it1.Params { // a func is usable wherever one taking more specific args is expected
+				if err := me.subsume(it2.Params[i], it1.Params[i], trail); err != nil {
+					return err
+				}
+			}
+			return me.subsume(it1.Ret, it2.Ret, trail)
+		}
+	case *TypeErrUnion:
+		if it2, is := t2.(*TypeErrUnion); is {
+			if err := me.subsume(it1.Val, it2.Val, trail); err != nil {
+				return err
+			}
+			return me.subsume(it1.Err, it2.Err, trail)
+		}
+		return me.subsume(it1.Val, t2, trail) // never failing is fine too
+	case *TypeStruct:
+		if it2, is := t2.(*TypeStruct); is && (it2.Embedding(it1) || ((me.Implements != nil) && me.Implements(it1, it2))) {
+			return nil
+		}
+	}
+	return me.unify(t1, t2, trail)
+}
+
+func (me *TypeInference) unifyEach(types1 []Type, types2 []Type, trail *[]TypeVar) error {
+	for i := range types1 {
+		if err := me.unify(types1[i], types2[i], trail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *TypeInference) bind(tv TypeVar, t Type, trail *[]TypeVar) error {
+	if me.occurs(tv, t) {
+		return &ErrInfinite{Var: tv, Type: me.Resolved(t)}
+	}
+	if allowed := me.Restriction(tv); allowed != nil {
+		if other := me.Restriction(t); other != nil {
+			if len(restricted(allowed, other)) == 0 {
+				return &ErrMismatch{Expected: me.Union(allowed...), Actual: me.Union(other...), ofRestriction: true}
+			}
+		} else if _, is_var := me.shallow(t).(TypeVar); !is_var {
+			for _, member := range me.Members(t) {
+				if _, is_var := member.(TypeVar); !(is_var || slices.Contains(allowed, member)) {
+					return &ErrMismatch{Expected: me.Union(allowed...), Actual: me.Resolved(t), ofRestriction: true}
+				}
+			}
+		}
+	}
+	// any type vars in `t` now also belong to `tv`'s (possibly outer) let-level, and so must not be generalized beyond it
+	level := me.levels[tv]
+	for _, free := range me.FreeVars(t) {
+		if me.levels[free] > level {
+			me.levels[free] = level
+		}
+	}
+	me.unificationTable[tv] = t
+	*trail = append(*trail, tv)
+	return nil
+}
+
+// the occurs check: whether `tv` is part of `t`
+func (me *TypeInference) occurs(tv TypeVar, t Type) bool {
+	for _, free := range me.FreeVars(t) {
+		if free == tv {
+			return true
+		}
+	}
+	return false
+}
+
+// follows `t`'s type-var bindings, if any, until reaching either a non-var type or an unbound var
+func (me *TypeInference) shallow(t Type) Type {
+	for {
+		tv, is := t.(TypeVar)
+		if !is {
+			return t
+		}
+		bound := me.unificationTable[tv]
+		if bound == nil {
+			return t
+		}
+		t = bound
+	}
+}
+
+// Resolved returns `t` with all its bound type vars replaced by what they're bound to, recursively.
+func (me *TypeInference) Resolved(t Type) Type {
+	return me.mapped(t, func(tv TypeVar) Type { return tv })
+}
+
+// returns `t` resolved, with all its unbound type vars replaced by `onVar`'s result
+func (me *TypeInference) mapped(t Type, onVar func(TypeVar) Type) Type {
+	switch it := me.shallow(t).(type) {
+	case TypeVar:
+		return onVar(it)
+	case *TypeArr:
+		return &TypeArr{Item: me.mapped(it.Item, onVar)}
+	case *TypeTuple:
+		return &TypeTuple{Items: me.mappedEach(it.Items, onVar)}
+	case *TypeDict:
+		return &TypeDict{Key: me.mapped(it.Key, onVar), Val: me.mapped(it.Val, onVar)}
+	case *TypeFun:
+		return &TypeFun{Params: me.mappedEach(it.Params, onVar), Ret: me.mapped(it.Ret, onVar)}
+	case *TypeUnion:
+		return me.Union(me.mappedEach(it.Types, onVar)...)
+	case *TypeErrUnion:
+		return &TypeErrUnion{Val: me.mapped(it.Val, onVar), Err: me.mapped(it.Err, onVar)}
+	default:
+		return it
+	}
+}
+
+func (me *TypeInference) mappedEach(types []Type, onVar func(TypeVar) Type) []Type {
+	ret := make([]Type, len(types))
+	for i, it := range types {
+		ret[i] = me.mapped(it, onVar)
+	}
+	return ret
+}
+
+// Union returns the `TypeUnion` of all of `types` (resolved), unless they're all the same type, in which case that one.
+func (me *TypeInference) Union(types ...Type) Type {
+	var members []Type
+	seen := map[string]bool{}
+	for _, it := range types {
+		for _, member := range me.Members(it) {
+			if str := member.String(); !seen[str] {
+				seen[str] = true
+				members = append(members, member)
+			}
+		}
+	}
+	switch len(members) {
+	case 0:
+		return TypeNil{}
+	case 1:
+		return members[0]
+	}
+	return &TypeUnion{Types: members}
+}
+
+// Members returns the members of `t` (resolved) if it's a `TypeUnion`, else just `t` (resolved).
+func (me *TypeInference) Members(t Type) []Type {
+	resolved := me.Resolved(t)
+	if union, is := resolved.(*TypeUnion); is {
+		return union.Types
+	}
+	return []Type{resolved}
+}
+
+// FreeVars returns the unbound type vars in `t`, each once, in order of appearance.
+func (me *TypeInference) FreeVars(t Type) (ret []TypeVar) {
+	seen := map[TypeVar]bool{}
+	me.mapped(t, func(tv TypeVar) Type {
+		if !seen[tv] {
+			seen[tv] = true
+			ret = append(ret, tv)
+		}
+		return tv
+	})
+	return
+}
+
+// Generalize quantifies all type vars in `t` that were created at a deeper level than the current one (see `EnterLevel`).
+func (me *TypeInference) Generalize(t Type) *TypeScheme {
+	ret := &TypeScheme{Type: me.Resolved(t)}
+	for _, tv := range me.FreeVars(t) {
+		if me.levels[tv] > me.level {
+			ret.Vars = append(ret.Vars, tv)
+		}
+	}
+	return ret
+}
+
+// Instantiate returns `scheme`'s type with all its quantified vars replaced by fresh ones.
+func (me *TypeInference) Instantiate(scheme *TypeScheme) Type {
+	if len(scheme.Vars) == 0 {
+		return scheme.Type
+	}
+	fresh := make(map[TypeVar]Type, len(scheme.Vars))
+	for _, tv := range scheme.Vars {
+		fresh_var := me.NewTypeVar()
+		if allowed := me.Restriction(tv); allowed != nil {
+			me.Restrict(fresh_var, allowed...)
+		}
+		fresh[tv] = fresh_var
+	}
+	return me.mapped(scheme.Type, func(tv TypeVar) Type {
+		if it := fresh[tv]; it != nil {
+			return it
+		}
+		return tv
+	})
+}
+
+// ErrNotDefined is returned by `Infer` for an `ExprVar` not bound by any enclosing `ExprFun` or `ExprLet`.
+type ErrNotDefined struct{ Var ExprVar }
+
+func (me *ErrNotDefined) Error() string { return "`" + string(me.Var) + "` is not defined" }
+
+// Infer returns the (fully-resolved) type of `expr`, or the first error encountered.
+func Infer(expr Expr) (Type, error) {
+	me := NewTypeInference()
+	ret, err := me.infer(map[ExprVar]*TypeScheme{}, expr)
+	if err != nil {
+		return nil, err
+	}
+	return me.Resolved(ret), nil
+}
+
+func (me *TypeInference) infer(env map[ExprVar]*TypeScheme, expr Expr) (Type, error) {
+	switch it := expr.(type) {
+	case ExprInt:
+		return TypeInt{}, nil
+	case ExprVar:
+		if scheme := env[it]; scheme != nil {
+			return me.Instantiate(scheme), nil
+		}
+		return nil, &ErrNotDefined{Var: it}
+	case *ExprVarTyped:
+		t, err := me.infer(env, it.Var)
+		if err == nil {
+			err = me.solveOne(&TypeEqual{T1: it.Type, T2: t})
+		}
+		return it.Type, err
+	case *ExprFun:
+		param := me.NewTypeVar()
+		body, err := me.infer(with(env, it.Param, &TypeScheme{Type: param}), it.Body)
+		return &TypeFun{Params: []Type{param}, Ret: body}, err
+	case *ExprApp:
+		callee, err := me.infer(env, it.Callee)
+		if err != nil {
+			return nil, err
+		}
+		arg, err := me.infer(env, it.Arg)
+		if err != nil {
+			return nil, err
+		}
+		ret := me.NewTypeVar()
+		return ret, me.solveOne(&TypeEqual{T1: callee, T2: &TypeFun{Params: []Type{arg}, Ret: ret}})
+	case *ExprLet:
+		me.EnterLevel()
+		val, err := me.infer(env, it.Val)
+		me.LeaveLevel()
+		if err != nil {
+			return nil, err
+		}
+		return me.infer(with(env, it.Var, me.Generalize(val)), it.Body)
+	}
+	panic(expr)
+}
+
+func (me *TypeInference) solveOne(constraint Constraint) error {
+	if errs := me.Solve(constraint); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func with(env map[ExprVar]*TypeScheme, name ExprVar, scheme *TypeScheme) map[ExprVar]*TypeScheme {
+	ret := make(map[ExprVar]*TypeScheme, len(env)+1)
+	for k, v := range env {
+		ret[k] = v
+	}
+	ret[name] = scheme
+	return ret
+}
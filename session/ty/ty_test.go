@@ -0,0 +1,263 @@
+package ty
+
+import (
+	"errors"
+	"testing"
+)
+
+var (
+	x, y, f = ExprVar("x"), ExprVar("y"), ExprVar("f")
+	id      = &ExprFun{Param: x, Body: x} // x -> x
+)
+
+func TestInferLetPolymorphism(t *testing.T) {
+	for _, it := range []struct {
+		expected string
+		expr     Expr
+	}{
+		{"(T1) -> T1", id},
+		{"Int", &ExprApp{Callee: id, Arg: ExprInt(1)}},
+		// let id = x -> x in id id
+		{"(T3) -> T3", &ExprLet{Var: "id", Val: id, Body: &ExprApp{Callee: ExprVar("id"), Arg: ExprVar("id")}}},
+		// let id = x -> x in (y -> id 1) (id id): `id` used at both `Int -> Int` and `(a -> a) -> (a -> a)`
+		{"Int", &ExprLet{Var: "id", Val: id, Body: &ExprApp{
+			Callee: &ExprFun{Param: y, Body: &ExprApp{Callee: ExprVar("id"), Arg: ExprInt(1)}},
+			Arg:    &ExprApp{Callee: ExprVar("id"), Arg: ExprVar("id")},
+		}}},
+		// let const = x -> y -> x in const 1
+		{"(T4) -> Int", &ExprLet{Var: "const", Val: &ExprFun{Param: x, Body: &ExprFun{Param: y, Body: x}},
+			Body: &ExprApp{Callee: ExprVar("const"), Arg: ExprInt(1)}}},
+		// f -> x -> f (f x)
+		{"((T4) -> T4) -> (T4) -> T4", &ExprFun{Param: f, Body: &ExprFun{Param: x,
+			Body: &ExprApp{Callee: f, Arg: &ExprApp{Callee: f, Arg: x}}}}},
+		// x -> (x: Int)
+		{"(Int) -> Int", &ExprFun{Param: x, Body: &ExprVarTyped{Var: x, Type: TypeInt{}}}},
+	} {
+		if ty, err := Infer(it.expr); err != nil {
+			t.Errorf("expected %s, got error: %s", it.expected, err)
+		} else if ty.String() != it.expected {
+			t.Errorf("expected %s, got %s", it.expected, ty)
+		}
+	}
+}
+
+func TestInferErrs(t *testing.T) {
+	var mismatch *ErrMismatch
+	var infinite *ErrInfinite
+	var not_defined *ErrNotDefined
+	for _, it := range []struct {
+		expected string
+		expr     Expr
+	}{
+		// x -> x x
+		{"infinite type detected: `T1 = (T1) -> T2`", &ExprFun{Param: x, Body: &ExprApp{Callee: x, Arg: x}}},
+		// (id -> id id) (x -> x): unlike in the let-bound case, a lambda-bound `id` is monomorphic
+		{"infinite type detected: `T1 = (T1) -> T2`", &ExprApp{
+			Callee: &ExprFun{Param: "id", Body: &ExprApp{Callee: ExprVar("id"), Arg: ExprVar("id")}},
+			Arg:    id,
+		}},
+		// let f = x -> x x in f
+		{"infinite type detected: `T1 = (T1) -> T2`", &ExprLet{Var: "f", Val: &ExprFun{Param: x, Body: &ExprApp{Callee: x, Arg: x}}, Body: f}},
+		// 1 2
+		{"expected Int instead of (Int) -> T1", &ExprApp{Callee: ExprInt(1), Arg: ExprInt(2)}},
+		// f -> (f: Int) 1
+		{"expected Int instead of (Int) -> T2", &ExprFun{Param: f, Body: &ExprApp{Callee: &ExprVarTyped{Var: f, Type: TypeInt{}}, Arg: ExprInt(1)}}},
+		{"`y` is not defined", &ExprFun{Param: x, Body: y}},
+	} {
+		_, err := Infer(it.expr)
+		if err == nil {
+			t.Errorf("expected error %q, got none", it.expected)
+		} else if err.Error() != it.expected {
+			t.Errorf("expected error %q, got %q", it.expected, err)
+		} else if !(errors.As(err, &mismatch) || errors.As(err, &infinite) || errors.As(err, &not_defined)) {
+			t.Errorf("unexpected error type %T", err)
+		}
+	}
+}
+
+func TestSolve(t *testing.T) {
+	ti := NewTypeInference()
+	a, b := ti.NewTypeVar(), ti.NewTypeVar()
+	arr_of_a := &TypeArr{Item: a}
+	if errs := ti.Solve(&TypeEqual{T1: &TypeDict{Key: TypeStr{}, Val: a}, T2: &TypeDict{Key: b, Val: &TypeTuple{Items: []Type{TypeBool{}, TypeFloat{}}}}}); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if resolved := ti.Resolved(&TypeFun{Params: []Type{b}, Ret: arr_of_a}).String(); resolved != "(Str) -> [{ Bool, Float }]" {
+		t.Fatal(resolved)
+	}
+
+	// a failing constraint must not leave any of its partial unifications behind
+	c, d := ti.NewTypeVar(), ti.NewTypeVar()
+	errs := ti.Solve(&TypeEqual{NodeId: 42, T1: &TypeTuple{Items: []Type{c, TypeInt{}}}, T2: &TypeTuple{Items: []Type{TypeStr{}, d, TypeInt{}}}},
+		&TypeEqual{NodeId: 43, T1: &TypeTuple{Items: []Type{c, TypeInt{}}}, T2: &TypeTuple{Items: []Type{TypeStr{}, TypeStr{}}}})
+	if len(errs) != 2 {
+		t.Fatal(errs)
+	}
+	var mismatch *ErrMismatch
+	if !errors.As(errs[1], &mismatch) || (mismatch.NodeId != 43) || (mismatch.Error() != "expected { T3, Int } instead of { Str, Str }") {
+		t.Fatal(errs[1])
+	}
+	if (ti.Resolved(c) != c) || (ti.Resolved(d) != d) {
+		t.Fatal(ti.Resolved(c), ti.Resolved(d))
+	}
+	if !ti.Unifies(c, d) || (ti.Resolved(c) != c) {
+		t.Fatal("Unifies must not unify")
+	}
+}
+
+func TestUnions(t *testing.T) {
+	ti := NewTypeInference()
+	a := ti.NewTypeVar()
+	num := ti.Union(TypeInt{}, TypeFloat{}, TypeInt{})
+	if str := ti.Union(num, TypeStr{}, ti.Union(TypeFloat{}, TypeInt{})).String(); str != "Int | Float | Str" {
+		t.Fatal(str)
+	}
+	if !ti.Unifies(num, ti.Union(TypeFloat{}, TypeInt{})) || ti.Unifies(num, TypeInt{}) || ti.Unifies(num, ti.Union(TypeInt{}, TypeStr{})) {
+		t.Fatal("union unification")
+	}
+
+	for _, it := range []struct {
+		satisfied bool
+		t1        Type
+		t2        Type
+	}{
+		{true, num, TypeInt{}},
+		{true, num, num},
+		{true, &TypeArr{Item: num}, &TypeArr{Item: TypeFloat{}}},
+		{true, &TypeDict{Key: TypeStr{}, Val: ti.Union(num, TypeNil{})}, &TypeDict{Key: TypeStr{}, Val: num}},
+		{false, TypeInt{}, num},
+		{false, num, TypeStr{}},
+		{false, &TypeArr{Item: num}, &TypeArr{Item: TypeBool{}}},
+	} {
+		if ti.Satisfies(&TypeSubsumes{T1: it.t1, T2: it.t2}) != it.satisfied {
+			t.Errorf("expected %v for %s accepting %s", it.satisfied, it.t1, it.t2)
+		}
+	}
+
+	if errs := ti.Solve(&TypeSubsumes{T1: &TypeArr{Item: a}, T2: &TypeArr{Item: num}}); (len(errs) != 0) || (ti.Resolved(a).String() != "Int | Float") {
+		t.Fatal(errs, ti.Resolved(a))
+	}
+}
+
+func TestStructs(t *testing.T) {
+	ti := NewTypeInference()
+	animal := &TypeStruct{Name: "Animal"}
+	pet := &TypeStruct{Name: "Pet", Embeds: []*TypeStruct{animal}}
+	cat := &TypeStruct{Name: "Cat", Embeds: []*TypeStruct{pet}}
+	for _, it := range []struct {
+		satisfied bool
+		t1        Type
+		t2        Type
+	}{
+		{true, animal, cat},
+		{true, &TypeArr{Item: pet}, &TypeArr{Item: cat}},
+		{false, cat, animal},
+		{false, &TypeStruct{Name: "Animal"}, animal},
+	} {
+		if ti.Satisfies(&TypeSubsumes{T1: it.t1, T2: it.t2}) != it.satisfied {
+			t.Errorf("expected %v for %s accepting %s", it.satisfied, it.t1, it.t2)
+		}
+	}
+	if ti.Unifies(animal, cat) {
+		t.Fatal("structs unify only with themselves")
+	}
+
+	named, robot := &TypeStruct{Name: "Named"}, &TypeStruct{Name: "Robot"}
+	if ti.Satisfies(&TypeSubsumes{T1: named, T2: robot}) {
+		t.Fatal("expected no conformance without `Implements`")
+	}
+	ti.Implements = func(iface *TypeStruct, impl *TypeStruct) bool { return (iface == named) && (impl == robot) }
+	if !ti.Satisfies(&TypeSubsumes{T1: &TypeArr{Item: named}, T2: &TypeArr{Item: robot}}) {
+		t.Fatal("expected conformance per `Implements`")
+	}
+	if ti.Satisfies(&TypeSubsumes{T1: robot, T2: named}) || ti.Unifies(named, robot) {
+		t.Fatal("expected conformance to be one-way and not unifying")
+	}
+}
+
+func TestErrUnions(t *testing.T) {
+	ti := NewTypeInference()
+	parse := &TypeFun{Params: []Type{TypeStr{}}, Ret: &TypeErrUnion{Val: TypeInt{}, Err: TypeStr{}}}
+	for _, it := range []struct {
+		satisfied bool
+		t1        Type
+		t2        Type
+	}{
+		{true, parse.Ret, TypeInt{}},
+		{true, parse.Ret, parse.Ret},
+		{true, parse, &TypeFun{Params: []Type{TypeStr{}}, Ret: TypeInt{}}},
+		{true, parse, &TypeFun{Params: []Type{ti.Union(TypeStr{}, TypeNil{})}, Ret: TypeInt{}}},
+		{false, TypeInt{}, parse.Ret},
+		{false, parse, &TypeFun{Params: []Type{TypeInt{}}, Ret: TypeInt{}}},
+		{false, parse, &TypeFun{Params: []Type{TypeStr{}}, Ret: &TypeErrUnion{Val: TypeInt{}, Err: TypeBool{}}}},
+	} {
+		if ti.Satisfies(&TypeSubsumes{T1: it.t1, T2: it.t2}) != it.satisfied {
+			t.Errorf("expected %v for %s accepting %s", it.satisfied, it.t1, it.t2)
+		}
+	}
+	if str := parse.String(); str != "(Str) -> Int ?! Str" {
+		t.Fatal(str)
+	}
+}
+
+func TestRestrictions(t *testing.T) {
+	ti := NewTypeInference()
+	nums := []Type{TypeInt{}, TypeFloat{}}
+	// the schemes of `(a, b) -> a * b` and `(a) -> a * 2` (or `(a) -> -a`), as generalized by the session's checker
+	ti.EnterLevel()
+	a, b, ret := ti.NewTypeVar(), ti.NewTypeVar(), ti.NewTypeVar()
+	for _, tv := range []TypeVar{a, b, ret} {
+		ti.Restrict(tv, nums...)
+	}
+	ti.LeaveLevel()
+	mul, twice := ti.Generalize(&TypeFun{Params: []Type{a, b}, Ret: ret}), ti.Generalize(&TypeFun{Params: []Type{a}, Ret: a})
+
+	call := func(scheme *TypeScheme, args ...Type) (Type, []error) {
+		ret := ti.NewTypeVar()
+		errs := ti.Solve(&TypeEqual{T1: ti.Instantiate(scheme), T2: &TypeFun{Params: args, Ret: ret}})
+		return ti.Resolved(ret), errs
+	}
+	for _, it := range []struct {
+		scheme   *TypeScheme
+		args     []Type
+		expected string
+	}{
+		{twice, []Type{TypeFloat{}}, "Float"},
+		{twice, []Type{TypeInt{}}, "Int"},
+		{twice, []Type{ti.Union(TypeInt{}, TypeFloat{})}, "Int | Float"},
+		{twice, []Type{TypeStr{}}, "expected Int | Float instead of Str"},
+		{mul, []Type{TypeInt{}, TypeFloat{}}, "T"},
+		{mul, []Type{TypeBool{}, TypeBool{}}, "expected Int | Float instead of Bool"},
+		{twice, []Type{ti.Union(TypeInt{}, TypeStr{})}, "expected Int | Float instead of Int | Str"},
+	} {
+		t_ret, errs := call(it.scheme, it.args...)
+		if len(errs) > 0 {
+			if errs[0].Error() != it.expected {
+				t.Errorf("%s %v: expected %q, got %q", it.scheme, it.args, it.expected, errs[0])
+			}
+		} else if str := t_ret.String(); (str != it.expected) && !((it.expected == "T") && (str[0] == 'T')) {
+			t.Errorf("%s %v: expected %s, got %s", it.scheme, it.args, it.expected, str)
+		}
+	}
+
+	// unified type vars are restricted to what all of theirs allow, until a failed `Solve` unbinds them again
+	c, d, e := ti.NewTypeVar(), ti.NewTypeVar(), ti.NewTypeVar()
+	ti.Restrict(c, nums...)
+	ti.Restrict(d, TypeInt{}, TypeStr{})
+	ti.Restrict(e, TypeStr{})
+	if errs := ti.Solve(&TypeEqual{T1: c, T2: d}); len(errs) > 0 {
+		t.Fatal(errs)
+	} else if restriction := typesString(ti.Restriction(d)); restriction != "Int" {
+		t.Fatal(restriction)
+	}
+	if errs := ti.Solve(&TypeEqual{T1: &TypeTuple{Items: []Type{e, d}}, T2: &TypeTuple{Items: []Type{TypeStr{}, TypeFloat{}}}}); (len(errs) != 1) ||
+		(errs[0].Error() != "expected Int instead of Float") || (ti.Resolved(e) != e) {
+		t.Fatal(errs, ti.Resolved(e))
+	}
+	if errs := ti.Solve(&TypeEqual{T1: c, T2: e}); (len(errs) != 1) || (errs[0].Error() != "expected Int instead of Str") {
+		t.Fatal(errs)
+	}
+	if ti.Restriction(TypeInt{}) != nil {
+		t.Fatal("only type vars have restrictions")
+	}
+}
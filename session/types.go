@@ -0,0 +1,1423 @@
+package session
+
+import (
+	"loon/session/ty"
+	"loon/util"
+	"loon/util/sl"
+	"loon/util/str"
+)
+
+type typeChecker struct {
+	ti    *ty.TypeInference
+	file  *SrcFile
+	nodes []typeCheckerNode // by `ty.ErrMismatch.NodeId` and `ty.ErrInfinite.NodeId`
+	funcs []*typeCheckerFunc
+	diags map[*SrcFile]*Diags
+	// for mono-typed `Decl`s, their narrower types inside the branches of type-test or nil-test `ExprCond`s, or
+	// after an `=` assignment. Never mutated, only replaced (see `narrow`), so saving and restoring it is cheap
+	narrowed map[*Decl]ty.Type
+	structs  map[*ty.TypeStruct]*Struct
+	nextSelf ty.Type // the type of the `.` instance in the method func about to be checked
+	handled  Expr    // the `Subj` of the `ExprErrUnion` being checked, whose errors are not to be propagated
+	stmt     Expr    // the statement being checked, to tell `ExprSwitch` and `ExprLoop` statements from such exprs
+	// for the block exprs being checked (innermost last), the types of their `<~` results. Like `loops` (the number
+	// of `ExprLoop`s being checked), only those of the current func
+	blocks [][]ty.Type
+	loops  int
+}
+
+type typeCheckerNode struct {
+	file *SrcFile
+	expr Expr
+}
+
+// an `ExprFunc` being checked
+type typeCheckerFunc struct {
+	ret     ty.Type
+	returns []ty.Type // the types of all `<-` return values, to be joined with that of the body (if any)
+	self    ty.Type   // for methods, the type of the `.` instance, else nil (until used, for standalone funcs using it)
+	errs    []ty.Type // the errors of all calls (and `?!` failings) not handled by `?!`, propagating to the caller
+}
+
+var (
+	typeNums = []ty.Type{ty.TypeInt{}, ty.TypeFloat{}}
+	// by `ExprCall.TypeTest` type names
+	typePrims = map[string]ty.Type{"Bool": ty.TypeBool{}, "Int": ty.TypeInt{}, "Float": ty.TypeFloat{}, "Str": ty.TypeStr{}}
+)
+
+// only called by `SrcPack.treesRefresh`, right after `scopesRefresh`: infers (Hindley-Milner style, see package `ty`)
+// the types of all `Decl`s and `Expr`s in all `me.Files`, reporting `TypeMismatch`es and `TypeInfinite`s. Where values
+// of different types meet (in array and dict literals, conditional branches, returns and `=` assignments), their
+// types are joined into unions, which type tests (such as `Int foo`) and nil tests narrow inside `ExprCond` branches
+func (me *SrcPack) typesRefresh() {
+	files := me.filesWithExprs()
+	checker := typeChecker{ti: ty.NewTypeInference(), diags: map[*SrcFile]*Diags{}, structs: map[*ty.TypeStruct]*Struct{}}
+	for _, file := range files {
+		checker.diags[file] = &Diags{}
+	}
+	// first, the types of all struct members: those of fields right away, those of methods and statics to be inferred
+	structs := me.Trees.Structs
+	for _, it := range structs {
+		checker.structs[it.Type] = it
+	}
+	structsConformance(checker.ti, structs)
+	for _, it := range structs {
+		for _, member := range it.Members {
+			switch {
+			case member.Kind == StructMemberField:
+				member.Type = checker.typeFromTypeExpr(member.Expr.(*ExprDictEntry).Val)
+			case (member.Kind == StructMemberEmbed) && (member.Embeds != nil):
+				member.Type = member.Embeds.Type
+			default:
+				member.Type = checker.ti.NewTypeVar()
+			}
+		}
+	}
+	for _, it := range structs {
+		checker.file = it.Decl.File
+		checker.structDecl(it)
+	}
+	// then, all top-level func decls, in order, but each on demand if used (in another one) before then
+	for _, file := range files {
+		checker.file = file
+		for _, expr := range file.Trees.Exprs {
+			if assign, _ := expr.(*ExprAssign); (assign != nil) && (assign.Op == exprOpDecl) {
+				if _, is_func := assign.Rhs.(*ExprFunc); is_func {
+					checker.decl(assign)
+				}
+			}
+		}
+	}
+	// then, everything else, in order, so that other top-level decls see the `=` assignments preceding them
+	for _, file := range files {
+		checker.file = file
+		checker.stmts(file.Trees.Exprs)
+	}
+
+	for _, file := range files {
+		file.Trees.Exprs.Walk(func(expr Expr) bool {
+			if base := expr.Base(); base.Type != nil {
+				base.Type = checker.ti.Resolved(base.Type)
+			}
+			if ident, _ := expr.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) && (ident.Decl.Type != nil) {
+				ident.Decl.Type = &ty.TypeScheme{Vars: ident.Decl.Type.Vars, Type: checker.ti.Resolved(ident.Decl.Type.Type)}
+			}
+			return true
+		})
+		file.diags.TreesDiags.Add(*checker.diags[file]...)
+	}
+	for _, it := range structs {
+		for _, member := range it.Members {
+			if member.Type != nil {
+				member.Type = checker.ti.Resolved(member.Type)
+			}
+		}
+	}
+}
+
+// reports a `TypeMismatch` or `TypeInfinite` at `expr` unless `actual` (the type of `expr`) unifies with `expected`
+func (me *typeChecker) constrain(expr Expr, expected ty.Type, actual ty.Type) bool {
+	return me.solve(&ty.TypeEqual{NodeId: me.node(expr), T1: expected, T2: actual})
+}
+
+// like `constrain`, but `actual` need only be usable where `expected` is, such as an `Int` where an `Int | Str` is
+func (me *typeChecker) accept(expr Expr, expected ty.Type, actual ty.Type) bool {
+	if iface, impl := me.structOfType(expected), me.structOfType(actual); (iface != nil) && (impl != nil) && (iface != impl) &&
+		iface.IsInterface() && !impl.Type.Embedding(iface.Type) {
+		if conflicts := impl.conflicts(iface, me.ti); len(conflicts) > 0 {
+			me.diagConflicts(expr, iface, impl, conflicts)
+			return false
+		}
+	}
+	return me.solve(&ty.TypeSubsumes{NodeId: me.node(expr), T1: expected, T2: actual})
+}
+
+// reports at `expr` a `NotImplementing`, listing all `conflicts` and relating each to both the interface
+// field and (unless missing) the candidate member
+func (me *typeChecker) diagConflicts(expr Expr, iface *Struct, impl *Struct, conflicts []structConflict) {
+	toks := expr.Base().Toks
+	if len(toks) == 0 {
+		return
+	}
+	var rel []*SrcFileLocs
+	rel_loc := func(member *StructMember, hint string) {
+		rel = append(rel, &SrcFileLocs{File: member.File, Spans: []*SrcFileSpan{util.Ptr(member.Expr.Base().Toks.Span())}, Hints: []string{hint}})
+	}
+	details := sl.To(conflicts, func(it structConflict) string {
+		want := me.ti.Resolved(it.Want.Type).String()
+		rel_loc(it.Want, str.Fmt("required by `%s` as `%s`", iface.Decl.Name, want))
+		if it.Have == nil {
+			return str.Fmt("missing `%s`", it.Want.Name)
+		}
+		have := me.ti.Resolved(it.Have.Type).String()
+		rel_loc(it.Have, str.Fmt("but of type `%s` here", have))
+		return str.Fmt("mismatching `%s` (`%s` instead of `%s`)", it.Want.Name, have, want)
+	})
+	diag := toks.newDiagErr(false, ErrCodeNotImplementing, impl.Decl.Name, iface.Decl.Name, str.Join(details, ", "))
+	diag.Rel = rel
+	me.diags[me.file].Add(diag)
+}
+
+func (me *typeChecker) node(expr Expr) int {
+	me.nodes = append(me.nodes, typeCheckerNode{file: me.file, expr: expr})
+	return len(me.nodes) - 1
+}
+
+func (me *typeChecker) solve(constraint ty.Constraint) bool {
+	errs := me.ti.Solve(constraint)
+	for _, err := range errs {
+		switch err := err.(type) {
+		case *ty.ErrMismatch:
+			me.diag(me.nodes[err.NodeId], ErrCodeTypeMismatch, err.Expected, err.Actual)
+		case *ty.ErrInfinite:
+			me.diag(me.nodes[err.NodeId], ErrCodeTypeInfinite, err.Var.String()+" = "+err.Type.String())
+		}
+	}
+	return len(errs) == 0
+}
+
+func (me *typeChecker) diag(node typeCheckerNode, code DiagCode, args ...any) {
+	if node.expr == nil {
+		return
+	}
+	if toks := node.expr.Base().Toks; len(toks) > 0 {
+		me.diags[node.file].Add(toks.newDiagErr(false, code, args...))
+	}
+}
+
+// the type of all of `types` together, as for the `[ Int | Float ]` of `[ 1, 2.0 ]`: each (member) type
+// is unified with the first one before it that it unifies with, if any, else joined with the first one
+// of the same shape (such as `{ Int, Str }` and `{ Float, Str }` into `{ Int | Float, Str }`), else becomes a member of the union.
+// But `nil` and a not-yet-known type (as of the `foo?.bar` of an unknown `foo`) are kept apart as `T | nil`, not unified.
+func (me *typeChecker) join(types ...ty.Type) ty.Type {
+	var members []ty.Type
+	for _, it := range types {
+		for _, member := range me.ti.Members(it) {
+			if idx := sl.IdxWhere(members, func(t ty.Type) bool { return me.ti.Unifies(t, member) && !me.isVarAndNil(t, member) }); idx >= 0 {
+				_ = me.ti.Solve(&ty.TypeEqual{T1: members[idx], T2: member})
+			} else if idx = sl.IdxWhere(members, func(t ty.Type) bool { return me.sameShape(t, member) }); idx >= 0 {
+				members[idx] = me.joinShaped(members[idx], member)
+			} else {
+				members = append(members, member)
+			}
+		}
+	}
+	return me.ti.Union(members...)
+}
+
+func (me *typeChecker) isVarAndNil(t1 ty.Type, t2 ty.Type) bool {
+	_, is_var1 := me.ti.Resolved(t1).(ty.TypeVar)
+	_, is_var2 := me.ti.Resolved(t2).(ty.TypeVar)
+	return (is_var1 && me.is(t2, ty.TypeNil{})) || (is_var2 && me.is(t1, ty.TypeNil{}))
+}
+
+// whether both are arrays, or both dicts, or both tuples of the same arity
+func (me *typeChecker) sameShape(t1 ty.Type, t2 ty.Type) bool {
+	switch it1 := me.ti.Resolved(t1).(type) {
+	case *ty.TypeArr:
+		_, is := me.ti.Resolved(t2).(*ty.TypeArr)
+		return is
+	case *ty.TypeDict:
+		_, is := me.ti.Resolved(t2).(*ty.TypeDict)
+		return is
+	case *ty.TypeTuple:
+		it2, is := me.ti.Resolved(t2).(*ty.TypeTuple)
+		return is && (len(it1.Items) == len(it2.Items))
+	}
+	return false
+}
+
+// the component-wise `join` of `t1` and `t2`, which must be of the `sameShape`
+func (me *typeChecker) joinShaped(t1 ty.Type, t2 ty.Type) ty.Type {
+	switch it1 := me.ti.Resolved(t1).(type) {
+	case *ty.TypeArr:
+		return &ty.TypeArr{Item: me.join(it1.Item, me.ti.Resolved(t2).(*ty.TypeArr).Item)}
+	case *ty.TypeDict:
+		it2 := me.ti.Resolved(t2).(*ty.TypeDict)
+		return &ty.TypeDict{Key: me.join(it1.Key, it2.Key), Val: me.join(it1.Val, it2.Val)}
+	default:
+		it2 := me.ti.Resolved(t2).(*ty.TypeTuple)
+		items := make([]ty.Type, len(it2.Items))
+		for i := range items {
+			items[i] = me.join(it1.(*ty.TypeTuple).Items[i], it2.Items[i])
+		}
+		return &ty.TypeTuple{Items: items}
+	}
+}
+
+// `narrowed` with `decl` (if mono-typed) narrowed to `t`
+func (me *typeChecker) narrow(narrowed map[*Decl]ty.Type, decl *Decl, t ty.Type) map[*Decl]ty.Type {
+	if (decl.Type != nil) && (len(decl.Type.Vars) > 0) {
+		return narrowed
+	}
+	ret := make(map[*Decl]ty.Type, len(narrowed)+1)
+	for k, v := range narrowed {
+		ret[k] = v
+	}
+	ret[decl] = t
+	return ret
+}
+
+// the type of the value of `stmts` (that of the last one, unless that is no value), or `nil` if none
+func (me *typeChecker) stmts(stmts Exprs) (ret ty.Type) {
+	for i, stmt := range stmts {
+		me.stmt = stmt
+		ret = me.typeOf(stmt)
+		switch stmt.(type) {
+		case *ExprAssign, *ExprLoop, *ExprReturn, *ExprContinue:
+			ret = nil
+		}
+		if _, is_ret := stmt.(*ExprReturn); is_ret && (i < len(stmts)-1) {
+			break // the rest is unreachable, and so also wasn't scope-resolved by `scopesRefresh`
+		}
+	}
+	return
+}
+
+func (me *typeChecker) decl(assign *ExprAssign) {
+	if ident, _ := assign.Lhs.(*ExprIdent); (ident != nil) && str.IsUp(ident.Name[:1]) {
+		return // type decls' right-hand sides are type exprs, not value exprs
+	} else if it := me.structOf(assign.Lhs); it != nil {
+		if member := sl.FirstWhere(it.Members, func(member *StructMember) bool { return member.Expr == assign }); (member != nil) && (assign.Rhs.Base().Type == nil) {
+			me.structMember(it, member, assign.Rhs)
+		}
+		return
+	}
+	var is_done bool // top-level decls are done before all else, or on demand (also while being done, if recursive)
+	ExprWalk(assign.Lhs, func(it Expr) bool {
+		ident, _ := it.(*ExprIdent)
+		is_done = is_done || ((ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) && (ident.Decl.Type != nil))
+		return !is_done
+	})
+	if is_done {
+		return
+	}
+	_, is_func := assign.Rhs.(*ExprFunc)
+	if is_func { // only funcs are generalized, as other values (such as `[]`) might later be mutated at different types
+		me.ti.EnterLevel()
+	}
+	lhs := me.declLhs(assign.Lhs)
+	rhs := me.typeOf(assign.Rhs)
+	if is_func {
+		me.ti.LeaveLevel()
+	}
+	if _, is_member := assign.Lhs.(*ExprMember); is_member {
+		me.constrain(assign.Rhs, lhs, rhs)
+	} else {
+		me.destructure(assign.Lhs, assign.Rhs, rhs, func(name Expr, node Expr, t ty.Type) {
+			me.constrain(node, name.Base().Type, t)
+		})
+	}
+	if is_func {
+		ExprWalk(assign.Lhs, func(it Expr) bool {
+			if ident, _ := it.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) {
+				ident.Decl.Type = me.ti.Generalize(ident.Decl.Type.Type)
+			}
+			return true
+		})
+	}
+}
+
+// the type of the left-hand side of a `:=`, with all names declared in it getting (for now) monomorphic
+// fresh-type-var types, so that the right-hand side can refer to them (as in recursive funcs)
+func (me *typeChecker) declLhs(lhs Expr) (ret ty.Type) {
+	switch it := lhs.(type) {
+	case *ExprIdent:
+		ret = me.ti.NewTypeVar()
+		if (it.Decl != nil) && (it.Decl.Ident == it) {
+			it.Decl.Type = &ty.TypeScheme{Type: ret}
+		}
+		it.Type = ret
+	case *ExprTuple:
+		items := sl.To(it.Items, me.declLhs)
+		if ret = me.ti.NewTypeVar(); !sl.Any(it.Items, exprIsSpread) {
+			ret = &ty.TypeTuple{Items: items}
+		}
+		it.Type = ret
+	case *ExprArr, *ExprDict, *ExprSpread: // destructuring patterns, see `destructure`
+		ExprWalk(lhs, func(sub Expr) bool {
+			if ident, _ := sub.(*ExprIdent); ident != nil {
+				me.declLhs(ident)
+			}
+			return true
+		})
+		ret = me.ti.NewTypeVar()
+		it.Base().Type = ret
+	default: // such as `Foo.bar := ...` method decls
+		ret = me.typeOf(lhs)
+	}
+	return
+}
+
+func (me *typeChecker) declType(decl *Decl) *ty.TypeScheme {
+	if assign, _ := decl.Expr.(*ExprAssign); (decl.Type == nil) && (assign != nil) && decl.IsTopLevel() {
+		file, funcs := me.file, me.funcs
+		me.file, me.funcs = decl.File, nil
+		me.decl(assign)
+		me.file, me.funcs = file, funcs
+	}
+	if decl.Type == nil {
+		decl.Type = &ty.TypeScheme{Type: me.ti.NewTypeVar()}
+	}
+	return decl.Type
+}
+
+func (me *typeChecker) typeOf(expr Expr) (ret ty.Type) {
+	if expr == nil {
+		return me.ti.NewTypeVar()
+	}
+	switch it := expr.(type) {
+	case *ExprIdent:
+		if (it.Decl == nil) || str.IsUp(it.Name[:1]) { // builtins and (until there are type values) type names
+			ret = me.ti.NewTypeVar()
+		} else if narrowed := me.narrowed[it.Decl]; (narrowed != nil) && (it.Decl.Ident != it) {
+			ret = narrowed
+		} else {
+			ret = me.ti.Instantiate(me.declType(it.Decl))
+		}
+	case *ExprLit:
+		switch it.Val.(type) {
+		case bool:
+			ret = ty.TypeBool{}
+		case int64, uint64:
+			ret = ty.TypeInt{}
+		case float64:
+			ret = ty.TypeFloat{}
+		case string, rune:
+			ret = ty.TypeStr{}
+		default:
+			ret = ty.TypeNil{}
+		}
+	case *ExprMember:
+		ret = me.typeOfMember(it)
+	case *ExprSelf:
+		for i := len(me.funcs) - 1; (i >= 0) && (ret == nil); i-- {
+			ret = me.funcs[i].self
+		}
+		if ret == nil { // in a standalone func (or outside any, as reported by `structsRefresh`), the instance can be of any type
+			ret = me.ti.NewTypeVar()
+			if len(me.funcs) > 0 {
+				me.funcs[0].self = ret
+			}
+		}
+	case *ExprIndex:
+		ret = me.typeOfIndex(it)
+	case *ExprCall:
+		if _, subj := it.TypeTest(); subj != nil {
+			me.typeOf(subj)
+			ret = ty.TypeBool{}
+		} else if type_name, subj := it.Conversion(); subj != nil {
+			// anything converts to `Str`, and constants not converting are reported by `foldConversion` instead
+			if t := me.typeOf(subj); (type_name != "Str") && (subj.Base().Const == nil) {
+				me.operand(subj, t, ty.TypeInt{}, ty.TypeFloat{}, ty.TypeStr{})
+			}
+			ret = typePrims[type_name]
+		} else if callee := me.structOf(it.Callee); (callee != nil) && it.IsUnary && (len(it.Args) == 1) && me.isDict(it.Args[0]) {
+			me.typeOfStructLit(callee, it.Args[0].(*ExprDict))
+			ret = callee.Type
+		} else {
+			ret = me.propagated(it, me.typeOfCall(it))
+		}
+	case *ExprOpUnary:
+		ret = me.propagated(it, me.typeOfOpUnary(it))
+	case *ExprErrUnion:
+		ret = me.typeOfErrUnion(it)
+	case *ExprNilSafeCall:
+		ret = me.typeOfNilSafeCall(it)
+	case *ExprOpBinary:
+		ret = me.typeOfOpBinary(it.Op, it.Lhs, it.Rhs, me.typeOf(it.Lhs), me.typeOf(it.Rhs))
+	case *ExprTuple:
+		ret = &ty.TypeTuple{Items: me.typeOfItems(it.Items, false)}
+	case *ExprArr:
+		if len(it.Items) == 0 {
+			ret = &ty.TypeArr{Item: me.ti.NewTypeVar()}
+		} else if _, is_range := it.Items[0].(*ExprRange); is_range && (len(it.Items) == 1) {
+			ret = me.typeOf(it.Items[0]) // `[foo...bar]` is the same as just `foo...bar`
+		} else {
+			ret = &ty.TypeArr{Item: me.join(me.typeOfItems(it.Items, true)...)}
+		}
+	case *ExprDict:
+		ret = me.typeOfDict(it)
+	case *ExprSpread: // its container's type includes its subject's items (see `typeOfItems` and `typeOfDict`)
+		ret = me.typeOf(it.Subj)
+	case *ExprRange:
+		if (it.From == nil) || (it.To == nil) {
+			me.diag(typeCheckerNode{file: me.file, expr: it}, ErrCodeMisplaced, it.Toks.src(me.file.Src.Text), "slicing indices")
+		}
+		from := me.operand(it.From, me.typeOf(it.From), typeNums...)
+		for _, bound := range []Expr{it.To, it.Step} {
+			if bound != nil {
+				me.constrain(bound, from, me.operand(bound, me.typeOf(bound), typeNums...))
+			}
+		}
+		me.checkRange(it)
+		ret = &ty.TypeArr{Item: from}
+	case *ExprStrInterp:
+		for _, part := range it.Parts {
+			me.typeOf(part)
+		}
+		ret = ty.TypeStr{}
+	case *ExprFunc:
+		ret = me.typeOfFunc(it)
+	case *ExprCond:
+		ret = me.typeOfCond(it)
+	case *ExprSwitch:
+		ret = me.typeOfSwitch(it)
+	case *ExprLoop:
+		ret = me.typeOfLoop(it)
+	case *ExprBlock:
+		ret = me.typeOfBlock(it, true)
+	case *ExprContinue:
+		if me.loops == 0 {
+			me.diag(typeCheckerNode{file: me.file, expr: it}, ErrCodeMisplaced, exprOpNext, "loop bodies")
+		}
+		ret = me.ti.NewTypeVar() // never has a value of its own, so can be used anywhere
+	case *ExprAssign:
+		me.typeOfAssign(it)
+		ret = ty.TypeNil{}
+	case *ExprReturn:
+		val := ty.Type(ty.TypeNil{})
+		if it.Val != nil {
+			val = me.typeOf(it.Val)
+		}
+		if it.OfBlock && (len(me.blocks) == 0) {
+			me.diag(typeCheckerNode{file: me.file, expr: it}, ErrCodeMisplaced, exprOpResult, "block exprs")
+		} else if it.OfBlock {
+			me.blocks[len(me.blocks)-1] = append(me.blocks[len(me.blocks)-1], val)
+		} else if len(me.funcs) > 0 {
+			fn := me.funcs[len(me.funcs)-1]
+			fn.returns = append(fn.returns, val)
+		}
+		ret = me.ti.NewTypeVar() // never has a value of its own, so can be used anywhere
+	default:
+		panic(expr)
+	}
+	expr.Base().Type = ret
+	me.fold(expr)
+	return
+}
+
+// `t` (the type of `expr`) if it is one of `allowed` (or a union of only `allowed` ones, or not yet known, in which
+// case it gets `ty.TypeInference.Restrict`ed to `allowed`), else a fresh type var after reporting a `TypeMismatch`
+func (me *typeChecker) operand(expr Expr, t ty.Type, allowed ...ty.Type) ty.Type {
+	resolved := me.ti.Resolved(t)
+	if tv, is_var := resolved.(ty.TypeVar); is_var {
+		if restriction := me.ti.Restriction(tv); (restriction == nil) || sl.Any(restriction, func(it ty.Type) bool { return sl.Has(allowed, it) }) {
+			me.ti.Restrict(tv, allowed...)
+			return t
+		}
+	} else if me.isAll(resolved, allowed...) {
+		return t
+	}
+	names := sl.To(allowed, ty.Type.String)
+	me.diag(typeCheckerNode{file: me.file, expr: expr}, ErrCodeTypeMismatch,
+		str.Join(names[:len(names)-1], ", ")+util.If(len(names) > 1, " or ", "")+names[len(names)-1], resolved)
+	return me.ti.NewTypeVar()
+}
+
+func (me *typeChecker) is(t ty.Type, prim ty.Type) bool { return me.ti.Resolved(t) == prim }
+
+// whether `t` is one of `types` or else a union of only such
+func (me *typeChecker) isAll(t ty.Type, types ...ty.Type) bool {
+	return sl.All(me.ti.Members(t), func(member ty.Type) bool { return sl.Has(types, member) })
+}
+
+// whether `t` is an `Int` or a `Float` (or a union of only such), or a type var restricted to those
+func (me *typeChecker) isNum(t ty.Type) bool {
+	if restriction := me.ti.Restriction(t); restriction != nil {
+		return sl.All(restriction, func(it ty.Type) bool { return sl.Has(typeNums, it) })
+	}
+	return me.isAll(t, typeNums...)
+}
+
+// whether `t` is `prim` or else a union with `prim` as one of its members
+func (me *typeChecker) isAny(t ty.Type, prim ty.Type) bool { return sl.Has(me.ti.Members(t), prim) }
+
+func (me *typeChecker) isArr(t ty.Type) bool {
+	_, is := me.ti.Resolved(t).(*ty.TypeArr)
+	return is
+}
+
+func (me *typeChecker) typeOfOpUnary(it *ExprOpUnary) ty.Type {
+	operand := me.typeOf(it.Operand)
+	switch it.Op {
+	case "-":
+		return me.operand(it.Operand, operand, typeNums...)
+	case "~":
+		return me.operand(it.Operand, operand, ty.TypeInt{})
+	case "!":
+		return ty.TypeBool{}
+	case exprOpErr:
+		return &ty.TypeErrUnion{Val: me.ti.NewTypeVar(), Err: operand}
+	default: // "#"
+		return ty.TypeInt{}
+	}
+}
+
+// also used for the update assignments such as `foo += bar`
+func (me *typeChecker) typeOfOpBinary(op string, lhsExpr Expr, rhsExpr Expr, lhs ty.Type, rhs ty.Type) ty.Type {
+	if constIsZeroDivisor(op, rhsExpr.Base().Const) {
+		me.diag(typeCheckerNode{file: me.file, expr: rhsExpr}, ErrCodeDivModZero)
+	}
+	switch {
+	case (op == "==") || (op == "!="): // any operands
+		return ty.TypeBool{}
+	case (op == "&&") || (op == "||"):
+		me.constrain(lhsExpr, ty.TypeBool{}, lhs)
+		me.constrain(rhsExpr, ty.TypeBool{}, rhs)
+		return ty.TypeBool{}
+	case (op == "+") && (me.isArr(lhs) || me.isArr(rhs)): // concatenation
+		me.accept(rhsExpr, lhs, rhs)
+		return lhs
+	case (op == "+") && (me.is(lhs, ty.TypeStr{}) || me.is(rhs, ty.TypeStr{})): // concatenation, with numbers converted implicitly
+		me.operand(lhsExpr, lhs, ty.TypeStr{}, ty.TypeInt{}, ty.TypeFloat{})
+		me.operand(rhsExpr, rhs, ty.TypeStr{}, ty.TypeInt{}, ty.TypeFloat{})
+		return ty.TypeStr{}
+	case ((op == "&") || (op == "|")) && (me.is(lhs, ty.TypeBool{}) || me.is(rhs, ty.TypeBool{})): // non-short-circuiting `&&` and `||`
+		me.constrain(lhsExpr, ty.TypeBool{}, lhs)
+		me.constrain(rhsExpr, ty.TypeBool{}, rhs)
+		return ty.TypeBool{}
+	}
+
+	prec, allowed := exprOpsBinary[op], typeNums
+	if prec == exprOpsBinary["<"] {
+		allowed = []ty.Type{ty.TypeInt{}, ty.TypeFloat{}, ty.TypeStr{}}
+	} else if prec < exprOpsBinary["+"] {
+		allowed = []ty.Type{ty.TypeInt{}}
+	}
+	lhs, rhs = me.operand(lhsExpr, lhs, allowed...), me.operand(rhsExpr, rhs, allowed...)
+	if !(me.isNum(lhs) && me.isNum(rhs)) { // other than `Int`s and `Float`s mixing, operands must be of the same type
+		me.constrain(rhsExpr, lhs, rhs)
+	}
+	switch {
+	case prec == exprOpsBinary["<"]:
+		return ty.TypeBool{}
+	case (op == "/") || (op == "^"):
+		return ty.TypeFloat{}
+	case me.isAny(lhs, ty.TypeFloat{}) || me.isAny(rhs, ty.TypeFloat{}):
+		return ty.TypeFloat{}
+	case me.isAll(lhs, ty.TypeInt{}) && me.isAll(rhs, ty.TypeInt{}):
+		return ty.TypeInt{}
+	case me.isAll(lhs, ty.TypeInt{}): // so `Int` with `Int` and `Float` with `Float`, as with `Int`s and `Float`s mixing
+		return rhs
+	case me.isAll(rhs, ty.TypeInt{}):
+		return lhs
+	case !(me.isNum(lhs) && me.isNum(rhs)): // constrained to be the same above
+		return lhs
+	}
+	ret := me.ti.NewTypeVar() // two not-yet-known numbers, each either `Int` or `Float`
+	me.ti.Restrict(ret, allowed...)
+	return ret
+}
+
+func (me *typeChecker) typeOfIndex(it *ExprIndex) ty.Type {
+	if fn, _ := it.Index.(*ExprFunc); fn != nil { // `foo[_ > 0]`-like filtering, into a new arr
+		subj, item := me.typeOf(it.Subj), me.ti.NewTypeVar()
+		me.constrain(it.Subj, &ty.TypeArr{Item: item}, subj)
+		me.constrain(it.Index, &ty.TypeFun{Params: []ty.Type{item}, Ret: me.ti.NewTypeVar()}, me.typeOf(fn))
+		return subj
+	}
+	if rng, _ := it.Index.(*ExprRange); rng != nil {
+		return me.typeOfSlice(it, rng)
+	}
+	index := me.typeOf(it.Index)
+	switch subj := me.ti.Resolved(me.typeOf(it.Subj)).(type) {
+	case *ty.TypeArr:
+		me.constrain(it.Index, ty.TypeInt{}, index)
+		me.checkIndex(it.Index, constLen(it.Subj.Base().Const), false)
+		return subj.Item
+	case *ty.TypeDict:
+		me.accept(it.Index, subj.Key, index)
+		return subj.Val
+	case *ty.TypeTuple:
+		if idx, is_const := it.Index.Base().Const.(int64); is_const && me.checkIndex(it.Index, len(subj.Items), false) {
+			return subj.Items[idx]
+		}
+	}
+	return me.ti.NewTypeVar()
+}
+
+// the type of `subj[rng]`, as in `items[1..3]` or `name[..3]`: that of `subj`, which is either an arr or a `Str`
+func (me *typeChecker) typeOfSlice(it *ExprIndex, rng *ExprRange) ty.Type {
+	for _, bound := range []Expr{rng.From, rng.To, rng.Step} {
+		if bound != nil {
+			me.constrain(bound, ty.TypeInt{}, me.typeOf(bound))
+		}
+	}
+	me.checkRange(rng)
+	subj := me.typeOf(it.Subj)
+	if _, is_str := me.ti.Resolved(subj).(ty.TypeStr); !is_str {
+		me.constrain(it.Subj, &ty.TypeArr{Item: me.ti.NewTypeVar()}, subj)
+	}
+	if length := constLen(it.Subj.Base().Const); (length >= 0) && ((rng.From == nil) || me.checkIndex(rng.From, length, true)) && (rng.To != nil) {
+		me.checkIndex(rng.To, length, rng.IsExclusive)
+	}
+	rng.Type = subj
+	return subj
+}
+
+// reports `RangeNegative` for `foo...bar` (without a negative `\step`) where both `foo` and `bar` are constants and `bar < foo`
+func (me *typeChecker) checkRange(rng *ExprRange) {
+	from, is_from_const := constOf(rng.From).(int64)
+	to, is_to_const := constOf(rng.To).(int64)
+	step, is_step_const := constOf(rng.Step).(int64)
+	if is_from_const && is_to_const && ((rng.Step == nil) || (is_step_const && (step > 0))) && (to < from) {
+		me.diag(typeCheckerNode{file: me.file, expr: rng}, ErrCodeRangeNegative, to, from)
+	}
+}
+
+// reports `IndexOutOfBounds` if `index` is a constant outside of `0..length` (or `0...length` if `inclusive`),
+// with `length` being negative if not known at compile-time. Returns false if so reported.
+func (me *typeChecker) checkIndex(index Expr, length int, inclusive bool) bool {
+	if idx, is_const := index.Base().Const.(int64); is_const && (length >= 0) && ((idx < 0) || (idx > int64(length)) || ((idx == int64(length)) && !inclusive)) {
+		me.diag(typeCheckerNode{file: me.file, expr: index}, ErrCodeIndexOutOfBounds, idx, length)
+		return false
+	}
+	return true
+}
+
+func (me *typeChecker) typeOfCall(it *ExprCall) ty.Type {
+	if filter, callee := it.FilterLoop(); filter != nil {
+		item := ty.Type(me.ti.NewTypeVar())
+		if arr, _ := me.ti.Resolved(me.typeOf(filter)).(*ty.TypeArr); arr != nil { // else already reported by `typeOfIndex`
+			item = arr.Item
+		}
+		me.constrain(callee, &ty.TypeFun{Params: []ty.Type{item}, Ret: me.ti.NewTypeVar()}, me.typeOf(callee))
+		return ty.TypeNil{}
+	}
+	arg_exprs := it.Args
+	if it.IsUnary && (len(it.Args) == 1) {
+		if tuple, _ := it.Args[0].(*ExprTuple); tuple != nil { // `foo (bar, baz)` is the same as `foo(bar, baz)`
+			arg_exprs = tuple.Items
+		}
+	}
+	callee, args := me.typeOf(it.Callee), sl.To(arg_exprs, me.typeOf)
+	if fn := exprFuncOf(it.Callee); fn != nil {
+		for i := len(args); (i < len(fn.Params)) && (fn.ParamDefaults[i] != nil); i++ { // trailing args with defaults can be omitted
+			args = append(args, me.ti.NewTypeVar())
+		}
+	}
+	switch fn := me.ti.Resolved(callee).(type) {
+	case ty.TypeVar:
+	case *ty.TypeFun:
+		if len(fn.Params) == len(args) { // then the more precise per-arg mismatches
+			for i, arg_expr := range arg_exprs {
+				me.accept(arg_expr, fn.Params[i], args[i])
+			}
+			return fn.Ret
+		}
+	default:
+		me.diag(typeCheckerNode{file: me.file, expr: it.Callee}, ErrCodeNotCallable, it.Callee.Base().Toks.src(me.file.Src.Text))
+		return me.ti.NewTypeVar()
+	}
+	ret := me.ti.NewTypeVar()
+	me.constrain(it, callee, &ty.TypeFun{Params: args, Ret: ret})
+	return ret
+}
+
+// the func literal declared (as in `foo := (bar) -> baz`) by the name `callee`, else nil
+func exprFuncOf(callee Expr) *ExprFunc {
+	if ident, _ := callee.(*ExprIdent); (ident != nil) && (ident.Decl != nil) {
+		if assign, _ := ident.Decl.Expr.(*ExprAssign); (assign != nil) && (assign.Lhs == ident.Decl.Ident) {
+			fn, _ := assign.Rhs.(*ExprFunc)
+			return fn
+		}
+	}
+	return nil
+}
+
+// the types of the `items` of an arr (if `isArr`) or tuple literal, with those of any `...foo` spreads being
+// those of the items of `foo`
+func (me *typeChecker) typeOfItems(items Exprs, isArr bool) (ret []ty.Type) {
+	for _, item := range items {
+		t := me.typeOf(item)
+		if spread, _ := item.(*ExprSpread); (spread == nil) || isArr {
+			if spread != nil {
+				t = me.arrOf(spread.Subj, t).Item
+			}
+			ret = append(ret, t)
+		} else if tuple, _ := me.ti.Resolved(t).(*ty.TypeTuple); tuple != nil {
+			ret = append(ret, tuple.Items...)
+		} else {
+			me.constrain(spread.Subj, &ty.TypeTuple{}, t)
+		}
+	}
+	return
+}
+
+func (me *typeChecker) typeOfDict(it *ExprDict) ty.Type {
+	if len(it.Entries) == 0 {
+		return &ty.TypeDict{Key: me.ti.NewTypeVar(), Val: me.ti.NewTypeVar()}
+	}
+	keys, vals := make([]ty.Type, len(it.Entries)), make([]ty.Type, len(it.Entries))
+	for i, entry := range it.Entries {
+		vals[i] = me.typeOf(entry.Val)
+		switch spread, _ := entry.Val.(*ExprSpread); {
+		case entry.Name != "":
+			keys[i] = ty.TypeStr{}
+		case entry.Key != nil:
+			keys[i] = me.typeOf(entry.Key)
+		case spread != nil: // as in `{ ...foo, bar: baz }`
+			dict := me.dictOf(spread.Subj, vals[i])
+			keys[i], vals[i] = dict.Key, dict.Val
+		default: // positional, as in tuple types `{ Int, Str }`
+			keys[i] = me.ti.NewTypeVar()
+		}
+	}
+	return &ty.TypeDict{Key: me.join(keys...), Val: me.join(vals...)}
+}
+
+// `t` (the type of `expr`) as an arr type: constrained to one if not yet known, else (and on mismatch) a fresh one
+func (me *typeChecker) arrOf(expr Expr, t ty.Type) *ty.TypeArr {
+	if arr, _ := me.ti.Resolved(t).(*ty.TypeArr); arr != nil {
+		return arr
+	}
+	ret := &ty.TypeArr{Item: me.ti.NewTypeVar()}
+	me.constrain(expr, ret, t)
+	return ret
+}
+
+// `t` (the type of `expr`) as a dict type: constrained to one if not yet known, else (and on mismatch) a fresh one
+func (me *typeChecker) dictOf(expr Expr, t ty.Type) *ty.TypeDict {
+	if dict, _ := me.ti.Resolved(t).(*ty.TypeDict); dict != nil {
+		return dict
+	}
+	ret := &ty.TypeDict{Key: me.ti.NewTypeVar(), Val: me.ti.NewTypeVar()}
+	me.constrain(expr, ret, t)
+	return ret
+}
+
+func (me *typeChecker) typeOfFunc(it *ExprFunc) ty.Type {
+	params := sl.To(it.Params, me.declLhs)
+	for i, param_type := range it.ParamTypes {
+		if param_type != nil {
+			me.constrain(param_type, me.typeFromTypeExpr(param_type), params[i])
+		}
+	}
+	for i, param_default := range it.ParamDefaults {
+		if param_default != nil {
+			me.accept(param_default, params[i], me.typeOf(param_default))
+		}
+	}
+	me.destructureParams(it.Params, params)
+	fn := &typeCheckerFunc{ret: me.ti.NewTypeVar(), self: me.nextSelf}
+	me.nextSelf = nil
+	me.funcs = append(me.funcs, fn)
+	blocks, loops := me.blocks, me.loops
+	me.blocks, me.loops = nil, 0
+	body := me.stmts(it.Body)
+	me.blocks, me.loops = blocks, loops
+	me.funcs = me.funcs[:len(me.funcs)-1]
+	if body != nil {
+		fn.returns = append(fn.returns, body)
+	} else if len(fn.returns) == 0 {
+		fn.returns = append(fn.returns, ty.TypeNil{})
+	}
+	if len(fn.errs) > 0 {
+		me.constrain(it, fn.ret, &ty.TypeErrUnion{Val: me.join(fn.returns...), Err: me.join(fn.errs...)})
+	} else {
+		me.constrain(it, fn.ret, me.join(fn.returns...))
+	}
+	return &ty.TypeFun{Params: params, Ret: fn.ret}
+}
+
+func (me *typeChecker) typeOfCond(it *ExprCond) ty.Type {
+	me.typeOf(it.Cond) // any, not just `Bool`: `nil`ables are fine as conditions
+	narrowed := me.narrowed
+	narrowed_then, narrowed_else := me.narrowings(it.Cond, narrowed)
+	me.narrowed = narrowed_then
+	ret := me.typeOfBranch(it.Then)
+	me.narrowed = narrowed_else
+	if it.Else != nil { // also for `elseif`s, which are nested `ExprCond`s, and so get narrowed further
+		ret = me.join(ret, me.typeOfBranch(it.Else))
+	} else {
+		ret = me.join(ret, ty.TypeNil{})
+	}
+	me.narrowed = narrowed
+	return ret
+}
+
+// the type of the value of the block `it`: that of its last statement (or `nil` if none), joined (if `isResultTarget`)
+// with those of the `<~` results in it
+func (me *typeChecker) typeOfBlock(it *ExprBlock, isResultTarget bool) ty.Type {
+	if isResultTarget {
+		me.blocks = append(me.blocks, nil)
+	}
+	ret := me.stmts(it.Stmts)
+	if !isResultTarget {
+		return util.If(ret == nil, ty.Type(ty.TypeNil{}), ret)
+	}
+	results := me.blocks[len(me.blocks)-1]
+	me.blocks = me.blocks[:len(me.blocks)-1]
+	var last *ExprReturn
+	if len(it.Stmts) > 0 {
+		last, _ = it.Stmts[len(it.Stmts)-1].(*ExprReturn)
+	}
+	if ret != nil {
+		results = append(results, ret)
+	} else if (last == nil) || !last.OfBlock {
+		results = append(results, ty.TypeNil{})
+	}
+	return me.join(results...)
+}
+
+// the type of the `Then` or `Else` of an `ExprCond`, or of the body of an `ExprSwitchCase`: if a block, unlike others
+// not the target of the `<~` results in it (but the enclosing block expr is)
+func (me *typeChecker) typeOfBranch(branch Expr) ty.Type {
+	if block, _ := branch.(*ExprBlock); block != nil {
+		block.Type = me.typeOfBlock(block, false)
+		return block.Type
+	}
+	return me.typeOf(branch)
+}
+
+// `foo ?.. cases`: the join of the types of the case bodies and, unless exhaustive, `nil`. It is exhaustive with a
+// `_foo` catch-all case, or when the cases cover all members of the scrutinee's union type (by `nil` and `true` and
+// `false` values, or by `Int _`-like type-test guards, which also narrow an ident scrutinee in their case bodies).
+// When used as an expr (rather than as a statement), not being exhaustive is reported as `ElseCaseMissing`
+func (me *typeChecker) typeOfSwitch(it *ExprSwitch) ty.Type {
+	is_stmt := (me.stmt == it)
+	subj := me.typeOf(it.Subj)
+	remaining := me.ti.Members(subj)
+	_, is_var := remaining[0].(ty.TypeVar)
+	var has_else, has_true, has_false bool
+	var bodies []ty.Type
+	scrutinee, _ := it.Subj.(*ExprIdent)
+	narrowed := me.narrowed
+	for _, case_ := range it.Cases {
+		var covered []ty.Type
+		is_type_tests := len(case_.Conds) > 0
+		for _, cond := range case_.Conds {
+			kind := ExprSwitchCondKindOf(cond)
+			is_type_tests = is_type_tests && (kind == ExprSwitchCondGuard)
+			switch kind {
+			case ExprSwitchCondCatchAll:
+				has_else, cond.Base().Type = true, subj
+				if len(remaining) > 0 {
+					cond.Base().Type = me.ti.Union(remaining...)
+				}
+				if ident := cond.(*ExprIdent); (ident.Decl != nil) && (ident.Decl.Ident == ident) {
+					ident.Decl.Type = &ty.TypeScheme{Type: ident.Type}
+				}
+			case ExprSwitchCondGuard:
+				ExprWalk(cond, func(it Expr) bool {
+					if ident, _ := it.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Ident == ident) && (ident.Name == "_") {
+						ident.Decl.Type = &ty.TypeScheme{Type: subj}
+					}
+					return true
+				})
+				me.typeOf(cond)
+				var type_name string
+				var test_subj Expr
+				if call, _ := cond.(*ExprCall); call != nil {
+					type_name, test_subj = call.TypeTest()
+				}
+				if ident, _ := test_subj.(*ExprIdent); (ident != nil) && (ident.Name == "_") {
+					covered = append(covered, typePrims[type_name])
+				} else {
+					is_type_tests = false
+				}
+			case ExprSwitchCondPattern:
+				me.destructure(cond, cond, subj, func(name Expr, node Expr, t ty.Type) {
+					if ident, _ := name.(*ExprIdent); (ident != nil) && str.Begins(ident.Name, "_") {
+						if ident.Type = t; (ident.Decl != nil) && (ident.Decl.Ident == ident) {
+							ident.Decl.Type = &ty.TypeScheme{Type: t}
+						}
+					} else {
+						me.typeOf(name) // compared (with `==`) to its part of the scrutinee
+					}
+				})
+			default:
+				me.typeOf(cond) // compared (with `==`) to the scrutinee
+				if lit, _ := cond.(*ExprLit); lit != nil {
+					switch lit.Val {
+					case nil:
+						covered = append(covered, ty.TypeNil{})
+					case true:
+						has_true = true
+					case false:
+						has_false = true
+					}
+				}
+			}
+		}
+		if has_true && has_false {
+			covered = append(covered, ty.TypeBool{})
+		}
+		if is_type_tests && (scrutinee != nil) && (scrutinee.Decl != nil) && (scrutinee.Type != nil) {
+			me.narrowed = me.narrow(narrowed, scrutinee.Decl, me.ti.Union(covered...))
+		}
+		bodies = append(bodies, me.typeOfBranch(case_.Body))
+		me.narrowed = narrowed
+		if !is_var {
+			remaining = sl.Where(remaining, func(it ty.Type) bool { return !sl.Has(covered, it) })
+		}
+	}
+	if is_exhaustive := has_else || ((!is_var) && (len(remaining) == 0)); !is_exhaustive {
+		if !is_stmt {
+			me.diag(typeCheckerNode{file: me.file, expr: it}, ErrCodeNoElseCase)
+		}
+		bodies = append(bodies, ty.TypeNil{})
+	}
+	return me.join(bodies...)
+}
+
+// the narrowings (of `narrowed`) to apply inside the then and else branches of an `ExprCond` with the (already
+// typed) `cond`: for type tests such as `Int foo`, nil tests such as `foo`, `foo != nil` or `foo == nil`, and their `!` negations
+func (me *typeChecker) narrowings(cond Expr, narrowed map[*Decl]ty.Type) (narrowedThen map[*Decl]ty.Type, narrowedElse map[*Decl]ty.Type) {
+	narrowedThen, narrowedElse = narrowed, narrowed
+	var ident *ExprIdent
+	var is_nil_test, is_truthiness, is_negated bool
+	switch it := cond.(type) {
+	case *ExprOpUnary:
+		if it.Op == "!" {
+			narrowedElse, narrowedThen = me.narrowings(it.Operand, narrowed)
+		}
+		return
+	case *ExprIdent:
+		ident, is_nil_test, is_truthiness = it, true, true
+	case *ExprOpBinary:
+		if (it.Op == "==") || (it.Op == "!=") {
+			for _, operands := range [][2]Expr{{it.Lhs, it.Rhs}, {it.Rhs, it.Lhs}} {
+				if lit, _ := operands[1].(*ExprLit); (lit != nil) && (lit.Val == nil) {
+					ident, _ = operands[0].(*ExprIdent)
+				}
+			}
+			is_nil_test, is_negated = true, (it.Op == "==")
+		}
+	case *ExprCall:
+		_, subj := it.TypeTest()
+		ident, _ = subj.(*ExprIdent)
+	}
+	if (ident == nil) || (ident.Decl == nil) || (ident.Decl.Ident == ident) || (ident.Type == nil) {
+		return
+	}
+
+	members := me.ti.Members(ident.Type)
+	if is_nil_test {
+		if sl.Has(members, ty.Type(ty.TypeNil{})) && (len(members) > 1) {
+			narrowedThen = me.narrow(narrowed, ident.Decl, me.sansNil(ident.Type))
+			if (!is_truthiness) || !sl.Has(members, ty.Type(ty.TypeBool{})) { // a `false` value would also go into the else branch
+				narrowedElse = me.narrow(narrowed, ident.Decl, ty.TypeNil{})
+			}
+			if is_negated {
+				narrowedThen, narrowedElse = narrowedElse, narrowedThen
+			}
+		}
+		return
+	}
+
+	type_name, _ := cond.(*ExprCall).TypeTest()
+	prim := typePrims[type_name]
+	if _, is_var := members[0].(ty.TypeVar); is_var && (len(members) == 1) {
+		narrowedThen = me.narrow(narrowed, ident.Decl, prim)
+	} else if sl.Has(members, prim) {
+		narrowedThen = me.narrow(narrowed, ident.Decl, prim)
+		if others := sl.Where(members, func(it ty.Type) bool { return it != prim }); len(others) > 0 {
+			narrowedElse = me.narrow(narrowed, ident.Decl, me.ti.Union(others...))
+		}
+	}
+	return
+}
+
+// `t` without its `nil`, if a union with it
+func (me *typeChecker) sansNil(t ty.Type) ty.Type {
+	members := me.ti.Members(t)
+	if others := sl.Where(members, func(it ty.Type) bool { return it != ty.TypeNil{} }); (len(others) > 0) && (len(others) < len(members)) {
+		return me.ti.Union(others...)
+	}
+	return t
+}
+
+// `foo ?> bar`: `bar`'s result for the non-`nil` `foo`, or else `nil`
+func (me *typeChecker) typeOfNilSafeCall(it *ExprNilSafeCall) ty.Type {
+	subj, callee, ret := me.sansNil(me.typeOf(it.Subj)), me.typeOf(it.Callee), me.ti.NewTypeVar()
+	switch me.ti.Resolved(callee).(type) {
+	case ty.TypeVar, *ty.TypeFun:
+		me.constrain(it.Callee, callee, &ty.TypeFun{Params: []ty.Type{subj}, Ret: ret})
+	default:
+		me.diag(typeCheckerNode{file: me.file, expr: it.Callee}, ErrCodeNotCallable, it.Callee.Base().Toks.src(me.file.Src.Text))
+	}
+	return me.join(ret, ty.TypeNil{})
+}
+
+// `foo ?! bar`: either `foo`'s value or, on error, that of `bar` (for handler funcs, their result)
+func (me *typeChecker) typeOfErrUnion(it *ExprErrUnion) ty.Type {
+	handled := me.handled
+	me.handled = it.Subj
+	subj := me.typeOf(it.Subj)
+	me.handled = handled
+	val, err := subj, ty.Type(me.ti.NewTypeVar())
+	switch t := me.ti.Resolved(subj).(type) {
+	case *ty.TypeErrUnion:
+		val, err = t.Val, t.Err
+	case ty.TypeVar:
+		val = me.ti.NewTypeVar()
+		me.constrain(it.Subj, subj, &ty.TypeErrUnion{Val: val, Err: err})
+	}
+	if fn, _ := it.OnErr.(*ExprFunc); (fn != nil) && (len(fn.Params) == 1) {
+		ret := me.ti.NewTypeVar()
+		me.constrain(fn, &ty.TypeFun{Params: []ty.Type{err}, Ret: ret}, me.typeOf(fn))
+		return me.join(val, ret)
+	}
+	return me.join(val, me.typeOf(it.OnErr))
+}
+
+// for `expr`s (calls and `?!` failings) resulting in a `ty.TypeErrUnion`, unless handled by `?!`: its `Val`, with
+// its `Err` propagating to the caller of the enclosing func, or reported as ignored if outside of any
+func (me *typeChecker) propagated(expr Expr, t ty.Type) ty.Type {
+	err_union, _ := me.ti.Resolved(t).(*ty.TypeErrUnion)
+	if (err_union == nil) || (expr == me.handled) {
+		return t
+	}
+	if len(me.funcs) > 0 {
+		fn := me.funcs[len(me.funcs)-1]
+		fn.errs = append(fn.errs, err_union.Err)
+	} else {
+		me.diag(typeCheckerNode{file: me.file, expr: expr}, ErrCodeErrIgnored, expr.Base().Toks.src(me.file.Src.Text))
+	}
+	return err_union.Val
+}
+
+// as a statement `nil`, else (as an expr) the array of the values of each iteration's body (its last statement)
+// other than those skipped by `~>`
+func (me *typeChecker) typeOfLoop(it *ExprLoop) ty.Type {
+	is_stmt := (me.stmt == it)
+	subj := me.typeOf(it.Subj) // for `IsWhile`, any (as in `ExprCond`s) condition
+	params := sl.To(it.Body.Params, me.declLhs)
+	it.Body.Type = &ty.TypeFun{Params: params, Ret: ty.TypeNil{}}
+	var idx, val ty.Type
+	switch subj := me.ti.Resolved(subj).(type) {
+	case *ty.TypeArr:
+		idx, val = ty.TypeInt{}, subj.Item
+	case *ty.TypeDict:
+		idx, val = subj.Key, subj.Val
+	}
+	if (val != nil) && (len(params) > 0) {
+		me.constrain(it.Body.Params[len(params)-1], val, params[len(params)-1])
+		if len(params) > 1 {
+			me.constrain(it.Body.Params[0], idx, params[0])
+		}
+	}
+	me.destructureParams(it.Body.Params, params)
+	me.loops++
+	body := me.stmts(it.Body.Body) // not a func of its own, so any `<-` returns from the enclosing one
+	me.loops--
+	if is_stmt {
+		return ty.TypeNil{}
+	}
+	return &ty.TypeArr{Item: util.If(body == nil, ty.Type(ty.TypeNil{}), body)}
+}
+
+func (me *typeChecker) typeOfAssign(it *ExprAssign) {
+	switch {
+	case it.Op == exprOpDecl:
+		me.decl(it)
+	case (it.Op == exprOpAssign) && exprIsPattern(it.Lhs):
+		me.destructure(it.Lhs, it.Rhs, me.typeOf(it.Rhs), func(lhs Expr, node Expr, t ty.Type) {
+			me.assign(lhs, node, me.typeOf(lhs), t)
+		})
+	case it.Op == exprOpAssign:
+		me.assign(it.Lhs, it.Rhs, me.typeOf(it.Lhs), me.typeOf(it.Rhs))
+	case it.Op == exprOpUpdate:
+		me.typeOfUpdate(it)
+	default:
+		lhs := me.typeOf(it.Lhs)
+		me.assign(it.Lhs, it.Rhs, lhs, me.typeOfOpBinary(str.TrimSuff(it.Op, "="), it.Lhs, it.Rhs, lhs, me.typeOf(it.Rhs)))
+	}
+}
+
+// as in lang.md's `hello = 123` after `hello := "world"`, the types of a (mono-typed) var's values need not be
+// the same: its decl's type is widened (to a union) as needed, and narrowed to `rhs` for the code that follows
+func (me *typeChecker) assign(lhsExpr Expr, rhsExpr Expr, lhs ty.Type, rhs ty.Type) {
+	if ident, _ := lhsExpr.(*ExprIdent); (ident != nil) && (ident.Decl != nil) && (ident.Decl.Type != nil) && (len(ident.Decl.Type.Vars) == 0) {
+		if decl := ident.Decl; !me.ti.Satisfies(&ty.TypeSubsumes{T1: decl.Type.Type, T2: rhs}) {
+			decl.Type = &ty.TypeScheme{Type: me.join(decl.Type.Type, rhs)}
+		} else {
+			me.accept(rhsExpr, decl.Type.Type, rhs)
+		}
+		me.narrowed = me.narrow(me.narrowed, ident.Decl, rhs)
+		return
+	}
+	me.accept(rhsExpr, lhs, rhs)
+}
+
+// `foo .= { bar: baz }`, the same as `foo = { ...foo, bar: baz }` but keeping `foo`'s type: on structs, only (also
+// promoted) instance fields of it, of their types; on dicts, only keys and values of its key and value types
+func (me *typeChecker) typeOfUpdate(it *ExprAssign) {
+	lhs := me.typeOf(it.Lhs)
+	dict, _ := it.Rhs.(*ExprDict)
+	if subj := me.structOfType(lhs); (subj != nil) && (dict != nil) {
+		me.typeOfStructLit(subj, dict)
+		return
+	}
+	rhs := me.dictOf(it.Rhs, me.typeOf(it.Rhs))
+	if subj, _ := me.ti.Resolved(lhs).(*ty.TypeDict); (subj != nil) && (dict != nil) && !sl.Any(dict.Entries, func(entry *ExprDictEntry) bool { return exprIsSpread(entry.Val) }) {
+		for _, entry := range dict.Entries { // for diags at the offending entries, rather than the whole dict
+			if entry.Key != nil {
+				me.accept(entry.Key, subj.Key, entry.Key.Base().Type)
+			} else {
+				me.accept(entry, subj.Key, ty.TypeStr{})
+			}
+			me.accept(entry.Val, subj.Val, entry.Val.Base().Type)
+		}
+	} else {
+		me.accept(it.Rhs, lhs, rhs)
+	}
+}
+
+func (me *typeChecker) destructureParams(params Exprs, types []ty.Type) {
+	for i, param := range params {
+		if exprIsPattern(param) {
+			me.destructure(param, param, types[i], func(name Expr, node Expr, t ty.Type) {
+				me.constrain(node, name.Base().Type, t)
+			})
+		}
+	}
+}
+
+// matches the destructuring `pattern` against `t`, the type of `node` (such as the right-hand side of the `:=` or
+// `=`), calling `onName` for each name (or, for `=`, each assignable) in it with the type of its part of `t`.
+// Reports `IndexOutOfBounds` and `NoSuchField` where `pattern` cannot match the shape of `t` or, for arr and dict
+// literals, that of `node` (whose items' own types then are those of the matching names)
+func (me *typeChecker) destructure(pattern Expr, node Expr, t ty.Type, onName func(name Expr, node Expr, t ty.Type)) {
+	if exprIsPattern(pattern) {
+		pattern.Base().Type = t
+	}
+	switch it := pattern.(type) {
+	case *ExprArr:
+		arr := me.arrOf(node, t)
+		lit, _ := node.(*ExprArr)
+		if (lit == it) || ((lit != nil) && sl.Any(lit.Items, exprIsSpread)) {
+			lit = nil
+		}
+		for i, item := range it.Items {
+			if spread, _ := item.(*ExprSpread); spread != nil {
+				spread.Type = arr
+				onName(spread.Subj, spread, arr)
+			} else if lit == nil {
+				me.destructure(item, item, arr.Item, onName)
+			} else if idx, ok := me.itemIdx(it.Items, i, len(lit.Items)); ok {
+				me.destructure(item, lit.Items[idx], lit.Items[idx].Base().Type, onName)
+			} else {
+				me.diag(typeCheckerNode{file: me.file, expr: item}, ErrCodeIndexOutOfBounds, i, len(lit.Items))
+				me.destructure(item, item, me.ti.NewTypeVar(), onName)
+			}
+		}
+	case *ExprTuple:
+		tuple, _ := me.ti.Resolved(t).(*ty.TypeTuple)
+		if _, is_var := me.ti.Resolved(t).(ty.TypeVar); (tuple == nil) && !(is_var && sl.Any(it.Items, exprIsSpread)) {
+			// unless of a yet-unknown arity, as when matching a `...foo` spread
+			fresh := &ty.TypeTuple{Items: sl.To(it.Items, func(Expr) ty.Type { return me.ti.NewTypeVar() })}
+			if me.constrain(node, fresh, t) && is_var {
+				tuple = fresh
+			}
+		}
+		for i, item := range it.Items {
+			spread, _ := item.(*ExprSpread)
+			idx, ok := 0, false
+			if tuple != nil {
+				idx, ok = me.itemIdx(it.Items, i, len(tuple.Items))
+			}
+			switch {
+			case (spread != nil) && (tuple != nil):
+				num_before := util.Min(i, len(tuple.Items))
+				spread.Type = &ty.TypeTuple{Items: tuple.Items[num_before:util.Max(num_before, len(tuple.Items)-(len(it.Items)-i-1))]}
+				onName(spread.Subj, spread, spread.Type)
+			case spread != nil:
+				spread.Type = me.ti.NewTypeVar()
+				onName(spread.Subj, spread, spread.Type)
+			case ok:
+				me.destructure(item, item, tuple.Items[idx], onName)
+			default:
+				if tuple != nil {
+					me.diag(typeCheckerNode{file: me.file, expr: item}, ErrCodeIndexOutOfBounds, i, len(tuple.Items))
+				}
+				me.destructure(item, item, me.ti.NewTypeVar(), onName)
+			}
+		}
+	case *ExprDict:
+		var dict *ty.TypeDict
+		subj := me.structOfType(t)
+		if subj == nil {
+			dict = me.dictOf(node, t)
+		}
+		lit, _ := node.(*ExprDict)
+		if (lit == it) || ((lit != nil) && !sl.All(lit.Entries, func(it *ExprDictEntry) bool { return it.Name != "" })) {
+			lit = nil // only for literals with only named entries is it known which keys are missing
+		}
+		for _, entry := range it.Entries {
+			if entry.Name == "_" { // skipped
+				continue
+			}
+			var lit_entry *ExprDictEntry
+			if lit != nil {
+				lit_entry = sl.FirstWhere(lit.Entries, func(it *ExprDictEntry) bool { return it.Name == entry.Name })
+			}
+			var member *StructMember
+			if subj != nil {
+				member = subj.Member(entry.Name, false)
+			}
+			switch {
+			case (subj != nil) && (member != nil) && (member.Kind == StructMemberField):
+				me.destructure(entry.Val, entry.Val, member.Type, onName)
+			case lit_entry != nil:
+				me.destructure(entry.Val, lit_entry.Val, lit_entry.Val.Base().Type, onName)
+			case (subj == nil) && (lit == nil):
+				me.accept(entry, dict.Key, ty.TypeStr{})
+				me.destructure(entry.Val, entry.Val, dict.Val, onName)
+			default:
+				me.diag(typeCheckerNode{file: me.file, expr: entry}, ErrCodeNoSuchField, entry.Name)
+				me.destructure(entry.Val, entry.Val, me.ti.NewTypeVar(), onName)
+			}
+		}
+	default:
+		onName(pattern, node, t)
+	}
+}
+
+// for the `items` of an arr or tuple pattern matching `length` values, the index of the value for the item at `i`:
+// counted from the start if before any `...foo` spread, else from the end. Not `ok` if out of bounds
+func (me *typeChecker) itemIdx(items Exprs, i int, length int) (idx int, ok bool) {
+	if spread := sl.IdxWhere(items, exprIsSpread); (spread >= 0) && (i > spread) {
+		idx = length - (len(items) - i)
+		return idx, idx >= spread
+	}
+	return i, i < length
+}
+
+// the `Struct` that `expr` names: either the type name `Foo` itself, or the subject of a member access `Foo.bar`
+func (me *typeChecker) structOf(expr Expr) *Struct {
+	if member, _ := expr.(*ExprMember); member != nil {
+		expr = member.Subj
+	}
+	if ident, _ := expr.(*ExprIdent); (ident != nil) && (ident.Decl != nil) {
+		return ident.Decl.Struct
+	}
+	return nil
+}
+
+// the `Struct` of `t`, if it resolves to a struct type
+func (me *typeChecker) structOfType(t ty.Type) *Struct {
+	if it, _ := me.ti.Resolved(t).(*ty.TypeStruct); it != nil {
+		return me.structs[it]
+	}
+	return nil
+}
+
+func (me *typeChecker) isDict(expr Expr) bool {
+	_, is := expr.(*ExprDict)
+	return is
+}
+
+// checks the default field values, the embeddings' field values, and the methods and statics of `it` (other
+// than the out-of-line ones, which are done by `decl` as they're not necessarily in the same `SrcFile`)
+func (me *typeChecker) structDecl(it *Struct) {
+	for _, member := range it.Members {
+		if entry, _ := member.Expr.(*ExprDictEntry); entry != nil {
+			me.structMember(it, member, entry.Val)
+		}
+	}
+}
+
+func (me *typeChecker) structMember(it *Struct, member *StructMember, val Expr) {
+	switch member.Kind {
+	case StructMemberField:
+		if entry := member.Expr.(*ExprDictEntry); entry.Default != nil {
+			me.accept(entry.Default, member.Type, me.typeOf(entry.Default))
+		}
+	case StructMemberEmbed:
+		if call, _ := val.(*ExprCall); (call != nil) && (member.Embeds != nil) && (len(call.Args) == 1) && me.isDict(call.Args[0]) {
+			me.typeOfStructLit(member.Embeds, call.Args[0].(*ExprDict))
+		}
+	case StructMemberMethod:
+		me.nextSelf = it.Type
+		me.constrain(val, member.Type, me.typeOf(val))
+		me.nextSelf = nil
+	default:
+		me.constrain(val, member.Type, me.typeOf(val))
+	}
+}
+
+// checks the `entries` of a struct literal `Foo { foo: bar }`, which must all be (also promoted) instance fields of `it`
+func (me *typeChecker) typeOfStructLit(it *Struct, dict *ExprDict) {
+	for _, entry := range dict.Entries {
+		val := me.typeOf(entry.Val)
+		if member := it.Member(entry.Name, false); (member != nil) && (member.Kind == StructMemberField) {
+			me.accept(entry.Val, member.Type, val)
+		} else {
+			me.diag(typeCheckerNode{file: me.file, expr: entry}, ErrCodeNoSuchField, util.If(entry.Name != "", entry.Name, "_"))
+		}
+	}
+	dict.Type = it.Type
+}
+
+// `foo.bar`: on structs (also `.bar` on the `.` instance), a (promoted) member; on struct type names, a static
+// member; on dicts, the value at key `"bar"`
+func (me *typeChecker) typeOfMember(it *ExprMember) ty.Type {
+	if static := me.structOf(it.Subj); static != nil {
+		if member := static.Member(it.Name, true); member != nil {
+			return member.Type
+		}
+		me.diag(typeCheckerNode{file: me.file, expr: it}, ErrCodeNoSuchField, it.Name)
+		return me.ti.NewTypeVar()
+	}
+	subj := me.typeOf(it.Subj)
+	if it.IsNilSafe { // `foo?.bar`: `nil` if `foo` is, else `foo.bar`
+		return me.join(me.typeOfField(it, me.sansNil(subj)), ty.TypeNil{})
+	}
+	return me.typeOfField(it, subj)
+}
+
+// the type of the field `it.Name` of (the non-static) `subj`
+func (me *typeChecker) typeOfField(it *ExprMember, subj ty.Type) ty.Type {
+	switch subj := me.ti.Resolved(subj).(type) {
+	case *ty.TypeStruct:
+		if member := me.structs[subj].Member(it.Name, false); member != nil {
+			return member.Type
+		}
+		me.diag(typeCheckerNode{file: me.file, expr: it}, ErrCodeNoSuchField, it.Name)
+	case *ty.TypeDict:
+		me.accept(it, subj.Key, ty.TypeStr{})
+		return subj.Val
+	case *ty.TypeUnion: // the joined field types of its struct and dict members, as for dicts of differently-typed values
+		var fields []ty.Type
+		for _, member := range subj.Types {
+			switch member.(type) {
+			case *ty.TypeStruct, *ty.TypeDict:
+				fields = append(fields, me.typeOfField(it, member))
+			}
+		}
+		if len(fields) > 0 {
+			return me.ti.Union(fields...)
+		}
+	}
+	return me.ti.NewTypeVar()
+}
+
+// the type denoted by the type expr `expr` (see `ExprIsType`), with a fresh type var for any unknown or unsupported parts
+func (me *typeChecker) typeFromTypeExpr(expr Expr) ty.Type {
+	switch it := expr.(type) {
+	case *ExprIdent:
+		if prim := typePrims[it.Name]; prim != nil {
+			return prim
+		} else if (it.Decl != nil) && (it.Decl.Struct != nil) {
+			return it.Decl.Struct.Type
+		}
+	case *ExprArr:
+		return &ty.TypeArr{Item: me.typeFromTypeExpr(it.Items[0])}
+	case *ExprTuple:
+		return &ty.TypeTuple{Items: sl.To(it.Items, me.typeFromTypeExpr)}
+	case *ExprDict:
+		if sl.All(it.Entries, func(entry *ExprDictEntry) bool { return (entry.Name == "") && (entry.Key == nil) }) {
+			return &ty.TypeTuple{Items: sl.To(it.Entries, func(entry *ExprDictEntry) ty.Type { return me.typeFromTypeExpr(entry.Val) })}
+		} else if (len(it.Entries) == 1) && (it.Entries[0].Key != nil) {
+			return &ty.TypeDict{Key: me.typeFromTypeExpr(it.Entries[0].Key), Val: me.typeFromTypeExpr(it.Entries[0].Val)}
+		}
+	case *ExprFunc:
+		return &ty.TypeFun{Params: sl.To(it.Params, me.typeFromTypeExpr), Ret: me.typeFromTypeExpr(it.Body[0])}
+	case *ExprErrUnion:
+		return &ty.TypeErrUnion{Val: me.typeFromTypeExpr(it.Subj), Err: me.typeFromTypeExpr(it.OnErr)}
+	}
+	return me.ti.NewTypeVar()
+}
@@ -177,6 +177,19 @@ func IsEmailishEnough(str string) bool {
 		(idx_last_dot > idx_at) && (idx_last_dot < l-1))
 }
 
+// whether all runes of `pattern` occur in `str` in the same order, case-insensitively
+func IsFuzzyMatch(str string, pattern string) bool {
+	runes := []rune(Lo(pattern))
+	for _, r := range Lo(str) {
+		if len(runes) == 0 {
+			break
+		} else if r == runes[0] {
+			runes = runes[1:]
+		}
+	}
+	return len(runes) == 0
+}
+
 func In[T ~string](str T, set ...T) bool {
 	return slices.Contains(set, str)
 }
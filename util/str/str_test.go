@@ -17,3 +17,19 @@ func TestInterpolation(t *testing.T) {
 		t.Log(">>>" + Repl(s, m) + "<<<")
 	}
 }
+
+func TestFuzzyMatch(t *testing.T) {
+	for pattern, expected := range map[string]bool{
+		"":         true,
+		"describe": true,
+		"dscr":     true,
+		"DESC":     true,
+		"anim.d":   true,
+		"scribed":  false,
+		"xyz":      false,
+	} {
+		if IsFuzzyMatch("Animal.describe", pattern) != expected {
+			t.Errorf("expected %v for %q", expected, pattern)
+		}
+	}
+}